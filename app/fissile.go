@@ -2,11 +2,16 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hpcloud/fissile/builder"
 	"github.com/hpcloud/fissile/compilator"
@@ -14,6 +19,8 @@ import (
 	"github.com/hpcloud/fissile/kube"
 	"github.com/hpcloud/fissile/model"
 	"github.com/hpcloud/fissile/scripts/compilation"
+	"github.com/hpcloud/fissile/scripts/offline"
+	"github.com/hpcloud/fissile/secrets"
 	"github.com/hpcloud/fissile/util"
 
 	"github.com/fatih/color"
@@ -23,6 +30,14 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// deploymentNameRegexp matches valid deployment names, which have to be DNS
+// labels as they prefix the names of the secret and the config map
+var deploymentNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// invalidDeploymentNameRegexp matches what has to be replaced in release names
+// to derive deployment names from them
+var invalidDeploymentNameRegexp = regexp.MustCompile(`[^a-z0-9-]+`)
+
 // Fissile represents a fissile application
 type Fissile struct {
 	Version                    string
@@ -31,16 +46,75 @@ type Fissile struct {
 	releases                   []*model.Release // Only applies for some commands
 	patchPropertiesReleaseName string           // Only applies for some commands
 	patchPropertiesJobName     string           // Only applies for some commands
+	stemcellOS                 string
+	offline                    bool
+	offlineAssetsDir           string
+	workerCount                int
+	jobSpecCacheDir            string
+	verifiedArchivesDir        string
 }
 
 // NewFissileApplication creates a new app.Fissile
 func NewFissileApplication(version string, ui *termui.UI) *Fissile {
 	return &Fissile{
-		Version: version,
-		UI:      ui,
+		Version:     version,
+		UI:          ui,
+		stemcellOS:  compilation.UbuntuBase,
+		workerCount: runtime.NumCPU(),
 	}
 }
 
+// SetWorkerCount sets the number of workers used by commands which do not
+// take a worker count of their own, e.g. for verifying release archives
+func (f *Fissile) SetWorkerCount(workerCount int) error {
+	if workerCount < 1 {
+		return fmt.Errorf("Invalid worker count %d", workerCount)
+	}
+	f.workerCount = workerCount
+	return nil
+}
+
+// SetJobSpecCacheDir sets the directory in which the specs of job archives
+// are cached when loading releases; an empty directory disables the cache
+func (f *Fissile) SetJobSpecCacheDir(jobSpecCacheDir string) {
+	f.jobSpecCacheDir = jobSpecCacheDir
+}
+
+// SetVerifiedArchivesDir sets the directory remembering the job and package
+// archives verified when loading releases, so that unchanged archives aren't
+// hashed again; an empty directory disables it
+func (f *Fissile) SetVerifiedArchivesDir(verifiedArchivesDir string) {
+	f.verifiedArchivesDir = verifiedArchivesDir
+}
+
+// SetStemcellOS selects the OS of the compilation and stemcell layers, and
+// of the images built on top of them
+func (f *Fissile) SetStemcellOS(stemcellOS string) error {
+	if err := compilation.ValidateStemcellOS(stemcellOS); err != nil {
+		return err
+	}
+	f.stemcellOS = stemcellOS
+	return nil
+}
+
+// SetOffline enables offline builds of the compilation and stemcell layers:
+// all external artifacts are taken from the assets directory (if given) or
+// the assets embedded into fissile, instead of being downloaded
+func (f *Fissile) SetOffline(assetsDir string) {
+	f.offline = true
+	f.offlineAssetsDir = assetsDir
+}
+
+// loadOfflineAssets returns the verified artifacts for offline builds, or nil
+// when building online
+func (f *Fissile) loadOfflineAssets() (offline.Assets, error) {
+	if !f.offline {
+		return nil, nil
+	}
+
+	return offline.Load(f.offlineAssetsDir, f.stemcellOS)
+}
+
 // SetPatchPropertiesDirective saves the patch-properties release and job names, if specified.
 func (f *Fissile) SetPatchPropertiesDirective(patchPropertiesDirective string) error {
 	if patchPropertiesDirective == "" {
@@ -69,7 +143,7 @@ func (f *Fissile) ShowBaseImage(repository string) error {
 		return fmt.Errorf("Error connecting to docker: %s", err.Error())
 	}
 
-	comp, err := compilator.NewCompilator(dockerManager, "", "", repository, compilation.UbuntuBase, f.Version, false, f.UI)
+	comp, err := compilator.NewCompilator(dockerManager, "", "", repository, f.stemcellOS, f.Version, false, f.UI)
 	if err != nil {
 		return fmt.Errorf("Error creating a new compilator: %s", err.Error())
 	}
@@ -83,7 +157,7 @@ func (f *Fissile) ShowBaseImage(repository string) error {
 	f.UI.Printf("ID: %s\n", color.GreenString(image.ID))
 	f.UI.Printf("Virtual Size: %sMB\n", color.YellowString("%.2f", float64(image.VirtualSize)/(1024*1024)))
 
-	baseImageName := builder.GetBaseImageName(repository, f.Version)
+	baseImageName := builder.GetBaseImageName(repository, f.Version, f.stemcellOS)
 	image, err = dockerManager.FindImage(baseImageName)
 	f.UI.Printf("\nStemcell Layer: %s\n", color.GreenString(baseImageName))
 	f.UI.Printf("ID: %s\n", color.GreenString(image.ID))
@@ -92,13 +166,23 @@ func (f *Fissile) ShowBaseImage(repository string) error {
 	return nil
 }
 
-// CreateBaseCompilationImage will recompile the base BOSH image for a release
+// CreateBaseCompilationImage will recompile the base BOSH image for a release.
+// Without a base image name, the default image of the stemcell OS is used.
 func (f *Fissile) CreateBaseCompilationImage(baseImageName, repository, metricsPath string, keepContainer bool) error {
 	if metricsPath != "" {
 		stampy.Stamp(metricsPath, "fissile", "create-compilation-image", "start")
 		defer stampy.Stamp(metricsPath, "fissile", "create-compilation-image", "done")
 	}
 
+	if baseImageName == "" {
+		baseImageName = compilation.StemcellOSes[f.stemcellOS]
+	}
+
+	offlineAssets, err := f.loadOfflineAssets()
+	if err != nil {
+		return err
+	}
+
 	dockerManager, err := docker.NewImageManager()
 	if err != nil {
 		return fmt.Errorf("Error connecting to docker: %s", err.Error())
@@ -111,10 +195,11 @@ func (f *Fissile) CreateBaseCompilationImage(baseImageName, repository, metricsP
 
 	f.UI.Println(color.GreenString("Base image with ID %s found", color.YellowString(baseImage.ID)))
 
-	comp, err := compilator.NewCompilator(dockerManager, "", "", repository, compilation.UbuntuBase, f.Version, keepContainer, f.UI)
+	comp, err := compilator.NewCompilator(dockerManager, "", "", repository, f.stemcellOS, f.Version, keepContainer, f.UI)
 	if err != nil {
 		return fmt.Errorf("Error creating a new compilator: %s", err.Error())
 	}
+	comp.SetOfflineAssets(offlineAssets)
 
 	if _, err := comp.CreateCompilationBase(baseImageName); err != nil {
 		return fmt.Errorf("Error creating compilation base image: %s", err.Error())
@@ -123,19 +208,29 @@ func (f *Fissile) CreateBaseCompilationImage(baseImageName, repository, metricsP
 	return nil
 }
 
-// GenerateBaseDockerImage generates a base docker image to be used as a FROM for role images
+// GenerateBaseDockerImage generates a base docker image to be used as a FROM for role images.
+// Without a base image, the default image of the stemcell OS is used.
 func (f *Fissile) GenerateBaseDockerImage(targetPath, baseImage, metricsPath string, noBuild bool, repository string) error {
 	if metricsPath != "" {
 		stampy.Stamp(metricsPath, "fissile", "create-role-base", "start")
 		defer stampy.Stamp(metricsPath, "fissile", "create-role-base", "done")
 	}
 
+	if baseImage == "" {
+		baseImage = compilation.StemcellOSes[f.stemcellOS]
+	}
+
+	offlineAssets, err := f.loadOfflineAssets()
+	if err != nil {
+		return err
+	}
+
 	dockerManager, err := docker.NewImageManager()
 	if err != nil {
 		return fmt.Errorf("Error connecting to docker: %s", err.Error())
 	}
 
-	baseImageName := builder.GetBaseImageName(repository, f.Version)
+	baseImageName := builder.GetBaseImageName(repository, f.Version, f.stemcellOS)
 
 	image, err := dockerManager.FindImage(baseImageName)
 	if err == docker.ErrImageNotFound {
@@ -155,7 +250,17 @@ func (f *Fissile) GenerateBaseDockerImage(targetPath, baseImage, metricsPath str
 		targetPath = fmt.Sprintf("%s%c", targetPath, os.PathSeparator)
 	}
 
-	baseImageBuilder := builder.NewBaseImageBuilder(baseImage)
+	if offlineAssets != nil {
+		// Docker would try to pull a missing base image
+		if hasImage, err := dockerManager.HasImage(baseImage); err != nil {
+			return fmt.Errorf("Error looking up image: %s", err.Error())
+		} else if !hasImage {
+			return fmt.Errorf("Base image %s is not available locally, offline builds can't pull it", baseImage)
+		}
+	}
+
+	baseImageBuilder := builder.NewBaseImageBuilder(baseImage, f.stemcellOS)
+	baseImageBuilder.Offline = offlineAssets
 
 	if noBuild {
 		f.UI.Println("Skipping image build because of flag.")
@@ -180,6 +285,74 @@ func (f *Fissile) GenerateBaseDockerImage(targetPath, baseImage, metricsPath str
 	return nil
 }
 
+// GenerateBaseDockerImageFromStemcell generates the base docker image for role
+// images from an existing stemcell image, adding only the fissile assets. The
+// stemcell image must be available locally, and is validated through its labels.
+func (f *Fissile) GenerateBaseDockerImageFromStemcell(stemcellImage, metricsPath string, noBuild bool, repository string) error {
+	if metricsPath != "" {
+		stampy.Stamp(metricsPath, "fissile", "create-role-base", "start")
+		defer stampy.Stamp(metricsPath, "fissile", "create-role-base", "done")
+	}
+
+	dockerManager, err := docker.NewImageManager()
+	if err != nil {
+		return fmt.Errorf("Error connecting to docker: %s", err.Error())
+	}
+
+	stemcell, err := dockerManager.FindImage(stemcellImage)
+	if err == docker.ErrImageNotFound {
+		return fmt.Errorf("Stemcell image %s not found, it has to be pulled or loaded first", stemcellImage)
+	} else if err != nil {
+		return fmt.Errorf("Error looking up stemcell image: %s", err.Error())
+	}
+
+	var labels map[string]string
+	if stemcell.Config != nil {
+		labels = stemcell.Config.Labels
+	}
+	if err := builder.ValidateStemcellLabels(stemcellImage, labels, f.stemcellOS); err != nil {
+		return err
+	}
+
+	baseImageName := builder.GetBaseImageName(repository, f.Version, f.stemcellOS)
+
+	image, err := dockerManager.FindImage(baseImageName)
+	if err == docker.ErrImageNotFound {
+		f.UI.Println("Image doesn't exist, it will be created ...")
+	} else if err != nil {
+		return fmt.Errorf("Error looking up image: %s", err.Error())
+	} else {
+		f.UI.Println(color.GreenString(
+			"Base role image %s with ID %s already exists. Doing nothing.",
+			color.YellowString(baseImageName),
+			color.YellowString(image.ID),
+		))
+		return nil
+	}
+
+	if noBuild {
+		f.UI.Println("Skipping image build because of flag.")
+		return nil
+	}
+
+	f.UI.Printf("Building base docker image from stemcell %s ...\n", color.YellowString(stemcellImage))
+	log := new(bytes.Buffer)
+	stdoutWriter := docker.NewFormattingWriter(
+		log,
+		docker.ColoredBuildStringFunc(baseImageName),
+	)
+
+	tarPopulator := builder.NewStemcellImageBuilder(stemcellImage).NewDockerPopulator()
+	err = dockerManager.BuildImageFromCallback(baseImageName, stdoutWriter, tarPopulator)
+	if err != nil {
+		log.WriteTo(f.UI)
+		return fmt.Errorf("Error building base image: %s", err)
+	}
+	f.UI.Println(color.GreenString("Done."))
+
+	return nil
+}
+
 // ListPackages will list all BOSH packages within a list of dev releases
 func (f *Fissile) ListPackages() error {
 	if len(f.releases) == 0 {
@@ -296,8 +469,12 @@ func (f *Fissile) collectProperties() map[string]map[string]map[string]interface
 	return result
 }
 
-// Compile will compile a list of dev BOSH releases
-func (f *Fissile) Compile(repository, targetPath, roleManifestPath, metricsPath string, workerCount int, skipDev bool) error {
+// Compile will compile a list of dev BOSH releases. If a package cache
+// location is given, compiled packages are shared through that cache. A
+// journal of the run is kept in journalDir; with retryFailed, only the
+// packages which failed in the previous run are compiled. With verbose, the
+// compilation output is streamed to the UI.
+func (f *Fissile) Compile(repository, targetPath, roleManifestPath, metricsPath string, workerCount int, skipDev bool, packageCacheLocation, packageCacheAccessKey, packageCacheSecretKey, packageCacheRegion, journalDir string, retryFailed, verbose bool) error {
 	if len(f.releases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
@@ -322,11 +499,37 @@ func (f *Fissile) Compile(repository, targetPath, roleManifestPath, metricsPath
 		f.UI.Printf("         %s (%s)\n", color.YellowString(release.Name), color.MagentaString(release.Version))
 	}
 
-	comp, err := compilator.NewCompilator(dockerManager, targetPath, metricsPath, repository, compilation.UbuntuBase, f.Version, false, f.UI)
+	comp, err := compilator.NewCompilator(dockerManager, targetPath, metricsPath, repository, f.stemcellOS, f.Version, false, f.UI)
 	if err != nil {
 		return fmt.Errorf("Error creating a new compilator: %s", err.Error())
 	}
 
+	if packageCacheLocation != "" {
+		packageCache, err := compilator.NewPackageCache(packageCacheLocation, packageCacheAccessKey, packageCacheSecretKey, packageCacheRegion)
+		if err != nil {
+			return fmt.Errorf("Error creating the package cache: %s", err.Error())
+		}
+		comp.SetPackageCache(packageCache)
+	}
+
+	comp.SetJournalDir(journalDir)
+	comp.SetVerbose(verbose)
+
+	if retryFailed {
+		journal, err := compilator.LoadLatestJournal(journalDir)
+		if err != nil {
+			return err
+		}
+		if journal == nil {
+			return fmt.Errorf("No compilation journal found in %s, nothing to retry", journalDir)
+		}
+
+		f.UI.Printf("Retrying %s failed package(s) from %s\n",
+			color.YellowString("%d", len(journal.Unsuccessful())),
+			color.MagentaString(journal.Path()))
+		comp.RetryFailed(journal)
+	}
+
 	if err := comp.Compile(workerCount, f.releases, roleManifest); err != nil {
 		return fmt.Errorf("Error compiling packages: %s", err.Error())
 	}
@@ -334,6 +537,185 @@ func (f *Fissile) Compile(repository, targetPath, roleManifestPath, metricsPath
 	return nil
 }
 
+// ShowLog prints the log of the latest compilation of a package (given as
+// <release>/<package>), or of the latest image build of a role
+func (f *Fissile) ShowLog(target, compilationDir, dockerDir string) error {
+	var logPath string
+
+	if parts := strings.Split(target, "/"); len(parts) == 2 {
+		if len(f.releases) == 0 {
+			return fmt.Errorf("Releases not loaded")
+		}
+
+		var pkg *model.Package
+		for _, release := range f.releases {
+			if release.Name != parts[0] {
+				continue
+			}
+
+			var err error
+			if pkg, err = release.LookupPackage(parts[1]); err != nil {
+				return err
+			}
+		}
+
+		if pkg == nil {
+			return fmt.Errorf("Release %s not found", parts[0])
+		}
+
+		logPath = pkg.GetPackageCompileLogPath(compilationDir)
+	} else if len(parts) == 1 {
+		logPath = builder.GetRoleBuildLogPath(dockerDir, target)
+	} else {
+		return fmt.Errorf("Invalid log name '%s', expected <release>/<package> or <role>", target)
+	}
+
+	contents, err := ioutil.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No log found for %s at %s", target, logPath)
+	} else if err != nil {
+		return err
+	}
+
+	f.UI.Printf("%s", contents)
+
+	return nil
+}
+
+// ShowCompilation prints the journal of the most recent compilation run
+func (f *Fissile) ShowCompilation(journalDir, outputFormat string) error {
+	journal, err := compilator.LoadLatestJournal(journalDir)
+	if err != nil {
+		return err
+	}
+	if journal == nil {
+		return fmt.Errorf("No compilation journal found in %s", journalDir)
+	}
+
+	switch outputFormat {
+	case "human":
+		f.UI.Printf("Compilation run started %s (%s)\n",
+			color.MagentaString(journal.StartTime.Local().Format(time.RFC1123)),
+			journal.Path())
+
+		for _, entry := range journal.Packages {
+			var status string
+			switch entry.Status {
+			case compilator.JournalStatusSucceeded:
+				status = color.GreenString("%s", entry.Status)
+			case compilator.JournalStatusFailed:
+				status = color.RedString("%s (exit code %d)", entry.Status, entry.ExitCode)
+			default:
+				status = color.YellowString("%s", entry.Status)
+			}
+
+			var duration string
+			if entry.StartTime != nil && entry.EndTime != nil {
+				duration = fmt.Sprintf(" in %s", entry.EndTime.Sub(*entry.StartTime))
+			}
+
+			f.UI.Printf("%s/%s (%s): %s%s\n",
+				color.YellowString(entry.Release),
+				color.YellowString(entry.Package),
+				color.WhiteString(entry.Fingerprint),
+				status,
+				duration)
+
+			if entry.Status == compilator.JournalStatusFailed && entry.Error != "" {
+				f.UI.Printf("    %s\n", entry.Error)
+			}
+		}
+
+		if journal.EndTime == nil {
+			f.UI.Println(color.RedString("The compilation run did not finish"))
+		}
+	case "json":
+		buf, err := json.MarshalIndent(journal, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s\n", buf)
+	case "yaml":
+		buf, err := yaml.Marshal(journal)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	return nil
+}
+
+// roleManifestValidation is the machine readable result of ValidateRoleManifest
+type roleManifestValidation struct {
+	Manifest string                 `json:"manifest" yaml:"manifest"`
+	Valid    bool                   `json:"valid" yaml:"valid"`
+	Errors   model.ValidationErrors `json:"errors" yaml:"errors"`
+}
+
+// ValidateRoleManifest checks the role manifest against the loaded releases,
+// reporting all problems found instead of stopping at the first one
+func (f *Fissile) ValidateRoleManifest(roleManifestPath, outputFormat string) error {
+	if len(f.releases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	validationErrors, err := model.ValidateRoleManifest(roleManifestPath, f.releases)
+	if err != nil {
+		return fmt.Errorf("Error reading role manifest: %s", err.Error())
+	}
+
+	result := roleManifestValidation{
+		Manifest: roleManifestPath,
+		Valid:    len(validationErrors) == 0,
+		Errors:   validationErrors,
+	}
+	if result.Errors == nil {
+		result.Errors = model.ValidationErrors{}
+	}
+
+	switch outputFormat {
+	case "human":
+		for _, validationError := range validationErrors {
+			location := roleManifestPath
+			if validationError.Line != 0 {
+				location = fmt.Sprintf("%s:%d", roleManifestPath, validationError.Line)
+			}
+			f.UI.Printf("%s: %s\n", color.YellowString(location), validationError.Message)
+		}
+
+		if result.Valid {
+			f.UI.Println(color.GreenString("Role manifest %s is valid", roleManifestPath))
+		}
+	case "json":
+		buf, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s\n", buf)
+	case "yaml":
+		buf, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	if !result.Valid {
+		return fmt.Errorf("Role manifest %s has %d problems", roleManifestPath, len(validationErrors))
+	}
+
+	return nil
+}
+
 // CleanCache inspects the compilation cache and removes all packages
 // which are not referenced (anymore).
 func (f *Fissile) CleanCache(targetPath string) error {
@@ -392,6 +774,39 @@ func (f *Fissile) CleanCache(targetPath string) error {
 	return nil
 }
 
+// ExportCompiledReleases writes a BOSH compiled release tarball for each of
+// the loaded releases, from the packages found in the compilation directory
+func (f *Fissile) ExportCompiledReleases(compilationDir, roleManifestPath, stemcell, outputDir string, skipDev bool) error {
+	if len(f.releases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	roleManifest, err := model.LoadRoleManifest(roleManifestPath, f.releases, skipDev)
+	if err != nil {
+		return fmt.Errorf("Error loading roles manifest: %s", err.Error())
+	}
+
+	// Nothing is compiled here, so no docker connection is needed
+	comp, err := compilator.NewCompilator(nil, compilationDir, "", "", f.stemcellOS, f.Version, false, f.UI)
+	if err != nil {
+		return fmt.Errorf("Error creating a new compilator: %s", err.Error())
+	}
+
+	for _, release := range f.releases {
+		tarballPath, err := comp.ExportCompiledRelease(release, roleManifest, stemcell, outputDir)
+		if err != nil {
+			return fmt.Errorf("Error exporting compiled release %s: %s", release.Name, err.Error())
+		}
+
+		f.UI.Printf("Wrote compiled release %s (%s) to %s\n",
+			color.YellowString(release.Name),
+			color.MagentaString(release.Version),
+			color.GreenString(tarballPath))
+	}
+
+	return nil
+}
+
 // GeneratePackagesRoleImage builds the docker image for the packages layer
 // where all packages are included
 func (f *Fissile) GeneratePackagesRoleImage(repository string, roleManifest *model.RoleManifest, noBuild, force bool, packagesImageBuilder *builder.PackagesImageBuilder) error {
@@ -412,7 +827,7 @@ func (f *Fissile) GeneratePackagesRoleImage(repository string, roleManifest *mod
 		}
 	}
 
-	baseImageName := builder.GetBaseImageName(repository, f.Version)
+	baseImageName := builder.GetBaseImageName(repository, f.Version, f.stemcellOS)
 	if hasImage, err := dockerManager.HasImage(baseImageName); err != nil {
 		return fmt.Errorf("Error getting base image: %s", err)
 	} else if !hasImage {
@@ -444,7 +859,7 @@ func (f *Fissile) GeneratePackagesRoleImage(repository string, roleManifest *mod
 }
 
 // GenerateRoleImages generates all role images using dev releases
-func (f *Fissile) GenerateRoleImages(targetPath, repository, metricsPath string, noBuild, force bool, workerCount int, rolesManifestPath, compiledPackagesPath, lightManifestPath, darkManifestPath string, skipDev bool) error {
+func (f *Fissile) GenerateRoleImages(targetPath, repository, metricsPath string, noBuild, force bool, workerCount int, rolesManifestPath, compiledPackagesPath, lightManifestPath, darkManifestPath string, skipDev, verbose bool) error {
 	if len(f.releases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
@@ -464,6 +879,7 @@ func (f *Fissile) GenerateRoleImages(targetPath, repository, metricsPath string,
 		compiledPackagesPath,
 		targetPath,
 		f.Version,
+		f.stemcellOS,
 		f.UI,
 	)
 	if err != nil {
@@ -486,19 +902,69 @@ func (f *Fissile) GenerateRoleImages(targetPath, repository, metricsPath string,
 		metricsPath,
 		"",
 		f.Version,
+		f.stemcellOS,
 		f.UI,
 	)
 	if err != nil {
 		return err
 	}
 
-	if err := roleBuilder.BuildRoleImages(roleManifest.Roles, repository, packagesLayerImageName, force, noBuild, workerCount); err != nil {
+	if err := roleBuilder.BuildRoleImages(roleManifest.Roles, repository, packagesLayerImageName, force, noBuild, verbose, workerCount); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// ListRoles will list the roles of a role manifest, with their type and
+// flight stage; with graph set, the roles are listed in the order of their
+// dependencies, with the roles they depend on
+func (f *Fissile) ListRoles(rolesManifestPath string, graph, skipDev bool) error {
+	if len(f.releases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	rolesManifest, err := model.LoadRoleManifest(rolesManifestPath, f.releases, skipDev)
+	if err != nil {
+		return fmt.Errorf("Error loading roles manifest: %s", err.Error())
+	}
+
+	if !graph {
+		for _, role := range rolesManifest.Roles {
+			stage := model.FlightStageFlight
+			if role.Run != nil {
+				stage = role.Run.FlightStage
+			}
+			f.UI.Printf("%s (%s, %s)\n", color.YellowString(role.Name), role.Type, stage)
+		}
+
+		f.UI.Printf(
+			"There are %s roles present.\n",
+			color.GreenString("%d", len(rolesManifest.Roles)),
+		)
+		return nil
+	}
+
+	order, err := rolesManifest.DependencyOrder()
+	if err != nil {
+		return err
+	}
+
+	for i, role := range order {
+		f.UI.Printf("%d. %s", i+1, color.YellowString(role.Name))
+		if dependencies := role.DependsOnRoles(); len(dependencies) > 0 {
+			names := make([]string, len(dependencies))
+			for j, dependency := range dependencies {
+				names[j] = dependency.Name
+			}
+			f.UI.Printf(" (depends on %s)", strings.Join(names, ", "))
+		}
+		f.UI.Println()
+	}
+
+	return nil
+}
+
 // ListRoleImages lists all dev role images
 func (f *Fissile) ListRoleImages(repository string, rolesManifestPath string, existingOnDocker, withVirtualSize bool, skipDev bool) error {
 	if withVirtualSize && !existingOnDocker {
@@ -525,7 +991,7 @@ func (f *Fissile) ListRoleImages(repository string, rolesManifestPath string, ex
 	}
 
 	for _, role := range rolesManifest.Roles {
-		imageName := builder.GetRoleDevImageName(repository, role, role.GetRoleDevVersion())
+		imageName := builder.GetRoleDevImageName(repository, f.stemcellOS, role, role.GetRoleDevVersion())
 
 		if !existingOnDocker {
 			f.UI.Println(imageName)
@@ -554,8 +1020,42 @@ func (f *Fissile) ListRoleImages(repository string, rolesManifestPath string, ex
 	return nil
 }
 
-//LoadReleases loads information about BOSH releases
+// LoadReleases loads information about BOSH releases, and verifies the
+// archives of their jobs and packages against the release manifests. Missing
+// package archives are not reported here, as only compilation needs them;
+// ValidateReleases reports them. Archives verified by earlier runs are not
+// hashed again while they are unchanged.
 func (f *Fissile) LoadReleases(releasePaths, releaseNames, releaseVersions []string, cacheDir string) error {
+	releases, err := f.loadReleases(releasePaths, releaseNames, releaseVersions, cacheDir)
+	if err != nil {
+		return err
+	}
+
+	var corrupt []string
+	for _, problem := range model.VerifyArchives(releases, f.workerCount, f.verifiedArchivesDir) {
+		if !problem.Missing {
+			corrupt = append(corrupt, problem.Error())
+		}
+	}
+	if len(corrupt) > 0 {
+		return fmt.Errorf("Error loading release information: corrupt archives found:\n  %s", strings.Join(corrupt, "\n  "))
+	}
+
+	f.releases = releases
+	err = f.injectPatchPropertiesJobSpec()
+	if err != nil {
+		return fmt.Errorf("Error loading release information: %s", err)
+	}
+	return nil
+}
+
+// loadReleases loads the releases without verifying their archives
+func (f *Fissile) loadReleases(releasePaths, releaseNames, releaseVersions []string, cacheDir string) ([]*model.Release, error) {
+	options := &model.ReleaseOptions{
+		JobSpecCacheDir: f.jobSpecCacheDir,
+		JobLoadWorkers:  f.workerCount,
+	}
+
 	releases := make([]*model.Release, len(releasePaths))
 
 	for idx, releasePath := range releasePaths {
@@ -569,19 +1069,67 @@ func (f *Fissile) LoadReleases(releasePaths, releaseNames, releaseVersions []str
 			releaseVersion = releaseVersions[idx]
 		}
 
-		release, err := model.NewDevRelease(releasePath, releaseName, releaseVersion, cacheDir)
+		release, err := model.NewRelease(releasePath, releaseName, releaseVersion, cacheDir, options)
 		if err != nil {
-			return fmt.Errorf("Error loading release information: %s", err.Error())
+			return nil, fmt.Errorf("Error loading release information: %s", err.Error())
 		}
 
 		releases[idx] = release
 	}
 
-	f.releases = releases
-	err := f.injectPatchPropertiesJobSpec()
+	return releases, nil
+}
+
+// ValidateReleases verifies the archives of all jobs and packages of the
+// releases against the release manifests, and reports all that are missing
+// or corrupt. All archives are hashed, whether verified before or not.
+func (f *Fissile) ValidateReleases(releasePaths, releaseNames, releaseVersions []string, cacheDir, outputFormat string) error {
+	releases, err := f.loadReleases(releasePaths, releaseNames, releaseVersions, cacheDir)
 	if err != nil {
-		return fmt.Errorf("Error loading release information: %s", err)
+		return err
+	}
+
+	problems := model.VerifyArchives(releases, f.workerCount, "")
+	if problems == nil {
+		problems = []*model.ArchiveProblem{}
 	}
+
+	switch outputFormat {
+	case "human":
+		for _, problem := range problems {
+			status := color.RedString("corrupt")
+			if problem.Missing {
+				status = color.YellowString("missing")
+			}
+			f.UI.Printf("%s/%s (%s): %s\n", color.YellowString(problem.Release), color.YellowString(problem.Name), problem.Kind, status)
+			f.UI.Printf("    %s\n", problem.Message)
+		}
+
+		if len(problems) == 0 {
+			f.UI.Println(color.GreenString("All job and package archives are valid"))
+		}
+	case "json":
+		buf, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s\n", buf)
+	case "yaml":
+		buf, err := yaml.Marshal(problems)
+		if err != nil {
+			return err
+		}
+
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", outputFormat)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d job and package archives are missing or corrupt", len(problems))
+	}
+
 	return nil
 }
 
@@ -716,35 +1264,215 @@ func compareHashes(v1Hash, v2Hash keyHash) *HashDiffs {
 	return &HashDiffs{AddedKeys: added, DeletedKeys: deleted, ChangedValues: changed}
 }
 
-// GenerateKube will create a set of configuration files suitable for deployment
-// on Kubernetes
-func (f *Fissile) GenerateKube(rolesManifestPath, outputDir, repository, registry, organization string, defaultFiles []string, useMemoryLimits bool, skipDev bool) error {
+// GenerateSecrets writes values for all configuration variables with a
+// generator to secretsPath, either as an env file (for --defaults-file) or as
+// a Kubernetes secret. Values already in secretsPath are kept, unless rotate
+// is set. Kubernetes secrets are named after the deployment.
+func (f *Fissile) GenerateSecrets(rolesManifestPath, secretsPath, format, deploymentName string, rotate, skipDev bool) error {
+	if len(f.releases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	if format != "env" && format != "kube" {
+		return fmt.Errorf("Invalid secrets format '%s', expected one of env or kube", format)
+	}
+
+	deploymentName, err := f.deploymentName(deploymentName)
+	if err != nil {
+		return err
+	}
 
 	rolesManifest, err := model.LoadRoleManifest(rolesManifestPath, f.releases, skipDev)
 	if err != nil {
 		return fmt.Errorf("Error loading roles manifest: %s", err.Error())
 	}
 
-	f.UI.Println("Loading defaults from env files")
-	defaults, err := godotenv.Read(defaultFiles...)
+	existing := secrets.Values{}
+	if _, err := os.Stat(secretsPath); err == nil {
+		f.UI.Printf("Loading existing secrets from %s\n", color.CyanString(secretsPath))
+		if existing, err = readSecrets(secretsPath, format); err != nil {
+			return fmt.Errorf("Error reading existing secrets: %s", err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	serviceNames := map[string][]string{}
+	for _, role := range rolesManifest.Roles {
+		serviceNames[role.Name] = kube.ServiceNames(role)
+	}
+
+	var variables model.ConfigurationVariableSlice
+	if rolesManifest.Configuration != nil {
+		variables = rolesManifest.Configuration.Variables
+	}
+
+	values, err := secrets.Generate(variables, serviceNames, existing, rotate)
 	if err != nil {
 		return err
 	}
 
-	settings := &kube.ExportSettings{
-		Defaults:        defaults,
-		Registry:        registry,
-		Organization:    organization,
-		Repository:      repository,
-		UseMemoryLimits: useMemoryLimits,
+	f.UI.Printf("Writing %d secrets to %s\n", len(values), color.CyanString(secretsPath))
+
+	secretsFile, err := os.OpenFile(secretsPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
 	}
+	defer secretsFile.Close()
+
+	if format == "kube" {
+		return kube.WriteYamlConfig(kube.NewSecret(kube.SecretName(deploymentName), values), secretsFile)
+	}
+
+	return values.WriteEnvFile(secretsFile)
+}
+
+// readSecrets loads the values of a secrets file written by GenerateSecrets
+func readSecrets(secretsPath, format string) (secrets.Values, error) {
+	if format == "env" {
+		return godotenv.Read(secretsPath)
+	}
+
+	secretsFile, err := os.Open(secretsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer secretsFile.Close()
+
+	return kube.ReadSecretValues(secretsFile)
+}
+
+// deploymentName returns the name of the deployment, which the secret and the
+// config map are named after. Unless given, it is derived from the name of the
+// first release.
+func (f *Fissile) deploymentName(name string) (string, error) {
+	if name == "" && len(f.releases) > 0 {
+		name = strings.Trim(invalidDeploymentNameRegexp.ReplaceAllString(strings.ToLower(f.releases[0].Name), "-"), "-")
+	}
+	if !deploymentNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("Invalid deployment name '%s', expected lowercase letters, digits and dashes", name)
+	}
+	return name, nil
+}
+
+// generateKubeConfiguration writes the secret and the config map holding the
+// values of the configuration variables, which the role containers reference
+func (f *Fissile) generateKubeConfiguration(rolesManifest *model.RoleManifest, outputDir, deploymentName string, defaults map[string]string) error {
+	var variables model.ConfigurationVariableSlice
+	if rolesManifest.Configuration != nil {
+		variables = rolesManifest.Configuration.Variables
+	}
+	secretValues, configValues := kube.GetVariableValues(variables, defaults)
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	secretPath := filepath.Join(outputDir, fmt.Sprintf("%s.yml", kube.SecretName(deploymentName)))
+	f.UI.Printf("Writing secret %s\n", color.CyanString(secretPath))
+
+	secretFile, err := os.OpenFile(secretPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer secretFile.Close()
+
+	if err := kube.WriteYamlConfig(kube.NewSecret(kube.SecretName(deploymentName), secretValues), secretFile); err != nil {
+		return err
+	}
+
+	configMapPath := filepath.Join(outputDir, fmt.Sprintf("%s.yml", kube.ConfigMapName(deploymentName)))
+	f.UI.Printf("Writing config map %s\n", color.CyanString(configMapPath))
+
+	configMapFile, err := os.Create(configMapPath)
+	if err != nil {
+		return err
+	}
+	defer configMapFile.Close()
+
+	return kube.WriteYamlConfig(kube.NewConfigMap(kube.ConfigMapName(deploymentName), configValues), configMapFile)
+}
+
+// GenerateKube will create a set of configuration files suitable for deployment
+// on Kubernetes. The values of the configuration variables are written into a
+// secret (for variables marked as secret) and a config map, instead of the
+// role manifests, so that only the secret has to be kept out of version control.
+// With the helm output format, a helm chart is created instead, taking the
+// values of the variables, the instance counts and memory of the roles, and the
+// docker registry settings from the values of the chart.
+// The settings only need to hold the options given to fissile build kube; the
+// defaults and the stemcell are filled in here.
+func (f *Fissile) GenerateKube(rolesManifestPath, outputDir, outputFormat string, defaultFiles []string, skipDev bool, settings *kube.ExportSettings) error {
+
+	if outputFormat != "kube" && outputFormat != "helm" {
+		return fmt.Errorf("Invalid output format '%s', expected one of kube or helm", outputFormat)
+	}
+
+	switch settings.PublicExposure {
+	case "", model.PublicExposureLoadBalancer, model.PublicExposureNodePort, model.PublicExposureExternalIPs, model.PublicExposureIngress:
+	default:
+		return fmt.Errorf("Invalid public exposure '%s', expected one of load-balancer, node-port, external-ips or ingress", settings.PublicExposure)
+	}
+
+	switch settings.QoS {
+	case "", kube.QoSBurstable, kube.QoSGuaranteed:
+	default:
+		return fmt.Errorf("Invalid QoS class '%s', expected one of %s or %s", settings.QoS, kube.QoSBurstable, kube.QoSGuaranteed)
+	}
+
+	rolesManifest, err := model.LoadRoleManifest(rolesManifestPath, f.releases, skipDev)
+	if err != nil {
+		return fmt.Errorf("Error loading roles manifest: %s", err.Error())
+	}
+
+	// godotenv reads .env when no files are given
+	defaults := map[string]string{}
+	if len(defaultFiles) > 0 {
+		f.UI.Println("Loading defaults from env files")
+		defaults, err = godotenv.Read(defaultFiles...)
+		if err != nil {
+			return err
+		}
+	}
+
+	settings.Defaults = defaults
+	settings.StemcellOS = f.stemcellOS
+	if settings.DeploymentName, err = f.deploymentName(settings.DeploymentName); err != nil {
+		return err
+	}
+	settings.CreateHelmChart = outputFormat == "helm"
+
+	rolesDir := outputDir
+	extension := "yml"
+	if settings.CreateHelmChart {
+		if err := f.generateHelmChart(rolesManifest, rolesManifestPath, outputDir, settings); err != nil {
+			return err
+		}
+		rolesDir = filepath.Join(outputDir, "templates")
+		extension = "yaml"
+	} else if err := f.generateKubeConfiguration(rolesManifest, outputDir, settings.DeploymentName, defaults); err != nil {
+		return err
+	}
+
+	// The files of the roles by flight stage, for the index of the
+	// configuration files
+	stageFiles := map[model.FlightStage][]string{}
 
 	for _, role := range rolesManifest.Roles {
-		roleTypeDir := filepath.Join(outputDir, string(role.Type))
+		roleTypeDir := rolesDir
+		if !settings.CreateHelmChart {
+			roleTypeDir = filepath.Join(rolesDir, string(role.Type))
+		}
 		if err = os.MkdirAll(roleTypeDir, 0755); err != nil {
 			return err
 		}
-		outputPath := filepath.Join(roleTypeDir, fmt.Sprintf("%s.yml", role.Name))
+		outputPath := filepath.Join(roleTypeDir, fmt.Sprintf("%s.%s", role.Name, extension))
+
+		stage := model.FlightStageFlight
+		if role.Run != nil {
+			stage = role.Run.FlightStage
+		}
+		stageFiles[stage] = append(stageFiles[stage], filepath.Join(string(role.Type), filepath.Base(outputPath)))
 
 		f.UI.Printf("Writing config %s for role %s\n",
 			color.CyanString(outputPath),
@@ -757,6 +1485,14 @@ func (f *Fissile) GenerateKube(rolesManifestPath, outputDir, repository, registr
 		}
 		defer outputFile.Close()
 
+		// The service account of the pods comes first, so that it exists
+		// when they get created
+		if rbac := kube.NewWaitRBAC(role); rbac != nil {
+			if err := kube.WriteRoleConfig(rbac, role, settings, outputFile); err != nil {
+				return err
+			}
+		}
+
 		switch role.Type {
 		case model.RoleTypeBoshTask:
 			job, err := kube.NewJob(role, settings)
@@ -764,46 +1500,127 @@ func (f *Fissile) GenerateKube(rolesManifestPath, outputDir, repository, registr
 				return err
 			}
 
-			if err := kube.WriteYamlConfig(job, outputFile); err != nil {
+			if err := kube.WriteRoleConfig(job, role, settings, outputFile); err != nil {
 				return err
 			}
 
 		case model.RoleTypeBosh:
-			needsStorage := len(role.Run.PersistentVolumes) != 0 || len(role.Run.SharedVolumes) != 0
-
-			if role.HasTag("clustered") || needsStorage {
+			if kube.UsesStatefulSet(role) {
 				statefulSet, deps, err := kube.NewStatefulSet(role, settings)
 				if err != nil {
 					return err
 				}
 
-				if err := kube.WriteYamlConfig(statefulSet, outputFile); err != nil {
+				if err := kube.WriteRoleConfig(statefulSet, role, settings, outputFile); err != nil {
 					return err
 				}
 
-				if err := kube.WriteYamlConfig(deps, outputFile); err != nil {
-					return err
+				if len(deps.Items) > 0 {
+					if err := kube.WriteRoleConfig(deps, role, settings, outputFile); err != nil {
+						return err
+					}
 				}
 
 				continue
 			}
 
-			deployment, svc, err := kube.NewDeployment(role, settings)
+			deployment, deps, err := kube.NewDeployment(role, settings)
 			if err != nil {
 				return err
 			}
 
-			if err := kube.WriteYamlConfig(deployment, outputFile); err != nil {
+			if err := kube.WriteRoleConfig(deployment, role, settings, outputFile); err != nil {
 				return err
 			}
 
-			if svc != nil {
-				if err := kube.WriteYamlConfig(svc, outputFile); err != nil {
+			if len(deps.Items) > 0 {
+				if err := kube.WriteRoleConfig(deps, role, settings, outputFile); err != nil {
 					return err
 				}
 			}
 		}
 	}
 
-	return nil
+	// Helm charts are installed as a whole, with hooks for the tasks
+	if settings.CreateHelmChart {
+		return nil
+	}
+
+	indexPath := filepath.Join(outputDir, "index.yml")
+	f.UI.Printf("Writing index %s\n", color.CyanString(indexPath))
+
+	indexFile, err := os.Create(indexPath)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	return kube.WriteApplyOrder([]kube.ApplyStage{
+		{
+			Name:  "configuration",
+			Files: []string{fmt.Sprintf("%s.yml", kube.SecretName(settings.DeploymentName)), fmt.Sprintf("%s.yml", kube.ConfigMapName(settings.DeploymentName))},
+		},
+		{Name: string(model.FlightStagePreFlight), Files: stageFiles[model.FlightStagePreFlight]},
+		{Name: string(model.FlightStageFlight), Files: stageFiles[model.FlightStageFlight]},
+		{Name: string(model.FlightStagePostFlight), Files: stageFiles[model.FlightStagePostFlight]},
+		{Name: string(model.FlightStageManual), Files: stageFiles[model.FlightStageManual]},
+	}, indexFile)
+}
+
+// generateHelmChart writes the chart description, the values, and the
+// templates of the secret and the config map of a helm chart. The chart is
+// named after the output directory, as helm expects.
+func (f *Fissile) generateHelmChart(rolesManifest *model.RoleManifest, rolesManifestPath, outputDir string, settings *kube.ExportSettings) error {
+	var variables model.ConfigurationVariableSlice
+	if rolesManifest.Configuration != nil {
+		variables = rolesManifest.Configuration.Variables
+	}
+
+	absOutputDir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+
+	templatesDir := filepath.Join(outputDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return err
+	}
+
+	chartPath := filepath.Join(outputDir, "Chart.yaml")
+	f.UI.Printf("Writing chart %s\n", color.CyanString(chartPath))
+	description := fmt.Sprintf("Generated by fissile %s from %s", f.Version, filepath.Base(rolesManifestPath))
+	chart := &bytes.Buffer{}
+	if err := kube.WriteHelmChart(filepath.Base(absOutputDir), description, chart); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(chartPath, chart.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	// The values hold the secrets, just like the secret of plain kube configs
+	valuesPath := filepath.Join(outputDir, "values.yaml")
+	f.UI.Printf("Writing values %s\n", color.CyanString(valuesPath))
+	values := &bytes.Buffer{}
+	if err := kube.WriteHelmValues(rolesManifest.Roles, variables, settings, values); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(valuesPath, values.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	secret := &bytes.Buffer{}
+	configMap := &bytes.Buffer{}
+	if err := kube.WriteHelmConfiguration(variables, settings.DeploymentName, secret, configMap); err != nil {
+		return err
+	}
+
+	secretPath := filepath.Join(templatesDir, fmt.Sprintf("%s.yaml", kube.SecretName(settings.DeploymentName)))
+	f.UI.Printf("Writing secret %s\n", color.CyanString(secretPath))
+	if err := ioutil.WriteFile(secretPath, secret.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	configMapPath := filepath.Join(templatesDir, fmt.Sprintf("%s.yaml", kube.ConfigMapName(settings.DeploymentName)))
+	f.UI.Printf("Writing config map %s\n", color.CyanString(configMapPath))
+	return ioutil.WriteFile(configMapPath, configMap.Bytes(), 0644)
 }
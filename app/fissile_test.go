@@ -2,13 +2,18 @@ package app
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
+	"github.com/hpcloud/fissile/builder"
+	"github.com/hpcloud/fissile/kube"
 	"github.com/hpcloud/fissile/model"
 	"github.com/hpcloud/termui"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +37,148 @@ func TestCleanCacheEmpty(t *testing.T) {
 	}
 }
 
+func TestSetStemcellOS(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	assert := assert.New(t)
+
+	f := NewFissileApplication(".", ui)
+	assert.Equal("ubuntu", f.stemcellOS)
+
+	assert.NoError(f.SetStemcellOS("opensuse"))
+	assert.Equal("opensuse", f.stemcellOS)
+
+	err := f.SetStemcellOS("plan9")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Invalid stemcell OS 'plan9'")
+	}
+	assert.Equal("opensuse", f.stemcellOS)
+}
+
+func TestLoadOfflineAssets(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	assert := assert.New(t)
+
+	f := NewFissileApplication(".", ui)
+	assets, err := f.loadOfflineAssets()
+	assert.NoError(err)
+	assert.Nil(assets, "Online builds should not need any assets")
+
+	assetsDir, err := ioutil.TempDir("", "fissile-offline-assets")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(assetsDir)
+
+	f.SetOffline(assetsDir)
+	_, err = f.loadOfflineAssets()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "dumb-init_1.1.3_amd64.deb is missing (https://github.com/Yelp/dumb-init")
+		assert.Contains(err.Error(), "ubuntu-packages.tgz is missing")
+	}
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, "dumb-init_1.1.3_amd64.deb"), []byte("not dumb-init"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, "ubuntu-packages.tgz"), []byte("packages"), 0644))
+	_, err = f.loadOfflineAssets()
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "dumb-init_1.1.3_amd64.deb has checksum")
+		assert.Contains(err.Error(), "ubuntu-packages.tgz has no checksum in SHA256SUMS")
+	}
+
+	packagesSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("packages")))
+	dumbInitSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("not dumb-init")))
+	checksums := fmt.Sprintf("%s *ubuntu-packages.tgz\n%s  dumb-init_1.1.3_amd64.deb\n", packagesSHA256, dumbInitSHA256)
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, "SHA256SUMS"), []byte(checksums), 0644))
+	_, err = f.loadOfflineAssets()
+	if assert.Error(err) {
+		assert.NotContains(err.Error(), "ubuntu-packages.tgz")
+		assert.Contains(err.Error(), "dumb-init_1.1.3_amd64.deb has checksum "+dumbInitSHA256, "The pinned checksum should take precedence")
+	}
+}
+
+func TestLoadReleasesDetectsType(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	finalReleasePath := filepath.Join(workDir, "../test-assets/ntp-final-release")
+	finalReleasePathCacheDir := filepath.Join(workDir, "../test-assets/ntp-release/bosh-cache")
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2.tgz")
+
+	f := NewFissileApplication(".", ui)
+	err = f.LoadReleases([]string{finalReleasePath}, []string{""}, []string{""}, finalReleasePathCacheDir)
+	if assert.NoError(err) {
+		assert.Equal(model.ReleaseTypeFinal, f.releases[0].Type)
+	}
+
+	tarballCacheDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(tarballCacheDir)
+
+	err = f.LoadReleases([]string{tarballPath}, []string{""}, []string{""}, tarballCacheDir)
+	if assert.NoError(err) {
+		assert.Equal(model.ReleaseTypeTarball, f.releases[0].Type)
+		assert.Equal("ntp", f.releases[0].Name)
+	}
+}
+
+func TestShowLog(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/ntp-release")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	compilationDir := filepath.Join(tempDir, "compilation")
+	dockerDir := filepath.Join(tempDir, "dockerfiles")
+
+	f := NewFissileApplication(".", ui)
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	pkg := f.releases[0].Packages[0]
+	err = f.ShowLog("ntp/"+pkg.Name, compilationDir, dockerDir)
+	assert.Error(err)
+	assert.Contains(err.Error(), "No log found for ntp/"+pkg.Name)
+
+	logPath := pkg.GetPackageCompileLogPath(compilationDir)
+	assert.NoError(os.MkdirAll(filepath.Dir(logPath), 0755))
+	assert.NoError(ioutil.WriteFile(logPath, []byte("compiling ntp\n"), 0644))
+
+	err = f.ShowLog("ntp/"+pkg.Name, compilationDir, dockerDir)
+	assert.NoError(err)
+	assert.Equal("compiling ntp\n", output.String())
+
+	err = f.ShowLog("ntp/missing", compilationDir, dockerDir)
+	assert.EqualError(err, "Cannot find package missing in release")
+
+	err = f.ShowLog("other/"+pkg.Name, compilationDir, dockerDir)
+	assert.EqualError(err, "Release other not found")
+
+	output.Reset()
+	roleLogPath := builder.GetRoleBuildLogPath(dockerDir, "ntpd")
+	assert.NoError(os.MkdirAll(filepath.Dir(roleLogPath), 0755))
+	assert.NoError(ioutil.WriteFile(roleLogPath, []byte("building ntpd\n"), 0644))
+
+	err = f.ShowLog("ntpd", compilationDir, dockerDir)
+	assert.NoError(err)
+	assert.Equal("building ntpd\n", output.String())
+
+	err = f.ShowLog("a/b/c", compilationDir, dockerDir)
+	assert.Error(err)
+}
+
 func TestListPackages(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 	assert := assert.New(t)
@@ -109,6 +256,339 @@ func TestListProperties(t *testing.T) {
 	}
 }
 
+func TestListRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on.yml")
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	if assert.NoError(f.ListRoles(roleManifestPath, false, false)) {
+		assert.Contains(output.String(), "There are")
+	}
+
+	output.Reset()
+	if !assert.NoError(f.ListRoles(roleManifestPath, true, false)) {
+		return
+	}
+
+	// Roles are listed after the roles they depend on
+	database := strings.Index(output.String(), "database")
+	nats := strings.Index(output.String(), "nats")
+	api := strings.Index(output.String(), "api")
+	assert.True(database < nats && nats < api, "Roles listed out of dependency order:\n%s", output.String())
+	assert.Contains(output.String(), " (depends on nats, database)\n")
+}
+
+func TestValidateRoleManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+	goodManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
+	badManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/validation-bad.yml")
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+	err = f.ValidateRoleManifest(goodManifestPath, "human")
+	assert.Error(err, "Expected validation to fail without releases")
+
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(f.ValidateRoleManifest(goodManifestPath, "human"))
+	assert.Contains(output.String(), "is valid")
+
+	output.Reset()
+	err = f.ValidateRoleManifest(badManifestPath, "json")
+	if assert.Error(err) {
+		assert.Equal(fmt.Sprintf("Role manifest %s has 13 problems", badManifestPath), err.Error())
+	}
+
+	var result struct {
+		Valid  bool
+		Errors []*model.ValidationError
+	}
+	if assert.NoError(json.Unmarshal(output.Bytes(), &result)) {
+		assert.False(result.Valid)
+		if assert.Len(result.Errors, 13) {
+			assert.Equal(8, result.Errors[0].Line)
+			assert.Equal("roles[0].jobs[0].consumes.tor", result.Errors[0].Path)
+		}
+	}
+}
+
+func TestGenerateSecrets(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/generators.yml")
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, format := range []string{"env", "kube"} {
+		secretsPath := filepath.Join(tempDir, "secrets."+format)
+		if !assert.NoError(f.GenerateSecrets(roleManifestPath, secretsPath, format, "", false, false)) {
+			continue
+		}
+
+		values, err := readSecrets(secretsPath, format)
+		if !assert.NoError(err) {
+			continue
+		}
+		assert.Len(values, 8, "Expected values for all variables with generators (%s)", format)
+		assert.NotContains(values, "PLAIN")
+
+		info, err := os.Stat(secretsPath)
+		if assert.NoError(err) {
+			assert.Equal(os.FileMode(0600), info.Mode().Perm(), "Secrets should only be readable by the owner")
+		}
+
+		assert.NoError(f.GenerateSecrets(roleManifestPath, secretsPath, format, "", false, false))
+		kept, err := readSecrets(secretsPath, format)
+		if assert.NoError(err) {
+			assert.Equal(values, kept, "Existing values should be kept (%s)", format)
+		}
+
+		assert.NoError(f.GenerateSecrets(roleManifestPath, secretsPath, format, "", true, false))
+		rotated, err := readSecrets(secretsPath, format)
+		if assert.NoError(err) {
+			assert.NotEqual(values["PASSWORD"], rotated["PASSWORD"], "Values should be rotated (%s)", format)
+		}
+	}
+
+	secret, err := ioutil.ReadFile(filepath.Join(tempDir, "secrets.kube"))
+	if assert.NoError(err) {
+		assert.Contains(string(secret), "name: tor-secrets\n", "The secret should be named after the first release")
+	}
+
+	err = f.GenerateSecrets(roleManifestPath, filepath.Join(tempDir, "secrets"), "json", "", false, false)
+	assert.EqualError(err, "Invalid secrets format 'json', expected one of env or kube")
+
+	err = f.GenerateSecrets(roleManifestPath, filepath.Join(tempDir, "secrets"), "kube", "My_CF", false, false)
+	assert.EqualError(err, "Invalid deployment name 'My_CF', expected lowercase letters, digits and dashes")
+}
+
+func TestGenerateKubeConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/generators.yml")
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	defaultsPath := filepath.Join(tempDir, "secrets.env")
+	if !assert.NoError(f.GenerateSecrets(roleManifestPath, defaultsPath, "env", "", false, false)) {
+		return
+	}
+	defaults, err := readSecrets(defaultsPath, "env")
+	if !assert.NoError(err) {
+		return
+	}
+
+	outputDir := filepath.Join(tempDir, "kube")
+	err = f.GenerateKube(roleManifestPath, outputDir, "kube", []string{defaultsPath}, false, &kube.ExportSettings{Repository: "fissile"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	secretFile, err := os.Open(filepath.Join(outputDir, "tor-secrets.yml"))
+	if assert.NoError(err) {
+		defer secretFile.Close()
+		secretValues, err := kube.ReadSecretValues(secretFile)
+		if assert.NoError(err) {
+			assert.Equal(map[string]string(defaults), secretValues)
+		}
+	}
+
+	configMap, err := ioutil.ReadFile(filepath.Join(outputDir, "tor-config.yml"))
+	if assert.NoError(err) {
+		assert.Contains(string(configMap), "name: tor-config\n")
+		assert.Contains(string(configMap), "PLAIN: plain")
+		assert.NotContains(string(configMap), "PASSWORD")
+	}
+
+	roleConfig, err := ioutil.ReadFile(filepath.Join(outputDir, "bosh", "myrole.yml"))
+	if assert.NoError(err) {
+		assert.NotContains(string(roleConfig), defaults["PASSWORD"], "Secret values should not be in the role configuration")
+		assert.Contains(string(roleConfig), "secretKeyRef")
+		assert.Contains(string(roleConfig), "name: tor-secrets\n")
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(outputDir, "index.yml"))
+	if assert.NoError(err) {
+		assert.Contains(string(index), "- name: configuration\n  files:\n  - tor-secrets.yml\n  - tor-config.yml\n")
+		assert.Contains(string(index), "- name: flight\n  files:\n  - bosh/myrole.yml\n")
+	}
+}
+
+func TestGenerateKubeHelmChart(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/generators.yml")
+
+	tempDir, err := ioutil.TempDir("", "fissile-tests")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	outputDir := filepath.Join(tempDir, "mychart")
+	err = f.GenerateKube(roleManifestPath, outputDir, "helm", nil, false, &kube.ExportSettings{
+		DeploymentName:  "mycf",
+		Repository:      "fissile",
+		Registry:        "docker.example.com",
+		Organization:    "splatform",
+		UseMemoryLimits: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	chart, err := ioutil.ReadFile(filepath.Join(outputDir, "Chart.yaml"))
+	if assert.NoError(err) {
+		assert.Contains(string(chart), "name: mychart\n")
+	}
+
+	values, err := ioutil.ReadFile(filepath.Join(outputDir, "values.yaml"))
+	if assert.NoError(err) {
+		assert.Contains(string(values), `PLAIN: "plain"`)
+		assert.Contains(string(values), `hostname: "docker.example.com"`)
+		assert.Contains(string(values), "myrole:\n    # Number of instances of the role\n    count: 1\n")
+	}
+
+	for _, name := range []string{"mycf-secrets", "mycf-config"} {
+		template, err := ioutil.ReadFile(filepath.Join(outputDir, "templates", name+".yaml"))
+		if assert.NoError(err) {
+			assert.Contains(string(template), fmt.Sprintf("  name: %s\n", name))
+		}
+	}
+
+	roleTemplate, err := ioutil.ReadFile(filepath.Join(outputDir, "templates", "myrole.yaml"))
+	if assert.NoError(err) {
+		assert.Contains(string(roleTemplate), "replicas: {{ .Values.sizing.myrole.count }}")
+		assert.Contains(string(roleTemplate), "{{ .Values.kube.registry.hostname }}")
+	}
+
+	err = f.GenerateKube(roleManifestPath, outputDir, "json", nil, false, &kube.ExportSettings{})
+	assert.EqualError(err, "Invalid output format 'json', expected one of kube or helm")
+}
+
+func TestValidateReleases(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	releasePathCacheDir := filepath.Join(releasePath, "bosh-cache")
+
+	cacheDir, err := ioutil.TempDir("", "fissile-tests")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(cacheDir)
+
+	blobs, err := ioutil.ReadDir(releasePathCacheDir)
+	if !assert.NoError(err) {
+		return
+	}
+	for _, blob := range blobs {
+		contents, err := ioutil.ReadFile(filepath.Join(releasePathCacheDir, blob.Name()))
+		if !assert.NoError(err) {
+			return
+		}
+		assert.NoError(ioutil.WriteFile(filepath.Join(cacheDir, blob.Name()), contents, 0644))
+	}
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	assert.NoError(f.SetWorkerCount(2))
+	assert.Error(f.SetWorkerCount(0))
+
+	assert.NoError(f.ValidateReleases([]string{releasePath}, []string{""}, []string{""}, cacheDir, "human"))
+	assert.Contains(output.String(), "All job and package archives are valid")
+
+	// Truncate the libevent package, and remove the tor package
+	assert.NoError(ioutil.WriteFile(filepath.Join(cacheDir, "f230399294226e8f8eba8749789100376ed8a07c"), []byte("truncated"), 0644))
+	assert.NoError(os.Remove(filepath.Join(cacheDir, "0792af225fc25d31625eb0ef7203dd7417fef9d1")))
+
+	output.Reset()
+	err = f.ValidateReleases([]string{releasePath}, []string{""}, []string{""}, cacheDir, "json")
+	assert.EqualError(err, "2 job and package archives are missing or corrupt")
+
+	var problems []*model.ArchiveProblem
+	if assert.NoError(json.Unmarshal(output.Bytes(), &problems)) && assert.Len(problems, 2) {
+		assert.Equal("libevent", problems[0].Name)
+		assert.False(problems[0].Missing)
+		assert.Equal("tor", problems[1].Name)
+		assert.True(problems[1].Missing)
+	}
+
+	err = f.LoadReleases([]string{releasePath}, []string{""}, []string{""}, cacheDir)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "corrupt archives found")
+		assert.Contains(err.Error(), "package tor/libevent")
+		assert.NotContains(err.Error(), "package tor/tor", "Missing packages should not fail loading")
+	}
+}
+
 func TestDevDiffConfigurations(t *testing.T) {
 	assert := assert.New(t)
 	workDir, err := os.Getwd()
@@ -118,12 +598,12 @@ func TestDevDiffConfigurations(t *testing.T) {
 	releasePathV224 := filepath.Join(workDir, "../test-assets/test-dev-config-diff/cf-release-224")
 	cachePath := filepath.Join(workDir, "../test-assets/test-dev-config-diff/cache")
 
-	release215, err := model.NewDevRelease(releasePathV215, "", "", cachePath)
+	release215, err := model.NewDevRelease(releasePathV215, "", "", cachePath, nil)
 	if !assert.NoError(err) {
 		return
 	}
 	assert.NotNil(release215)
-	release224, err := model.NewDevRelease(releasePathV224, "", "", cachePath)
+	release224, err := model.NewDevRelease(releasePathV224, "", "", cachePath, nil)
 	assert.NoError(err)
 	assert.NotNil(release224)
 
@@ -11,18 +11,25 @@ import (
 
 	"github.com/hpcloud/fissile/scripts/configgin"
 	"github.com/hpcloud/fissile/scripts/dockerfiles"
+	"github.com/hpcloud/fissile/scripts/offline"
 	"github.com/hpcloud/fissile/util"
 )
 
 // BaseImageBuilder represents a builder of docker base images
 type BaseImageBuilder struct {
-	BaseImage string
+	BaseImage  string
+	StemcellOS string
+	// Offline holds the external artifacts for offline builds; if it is nil,
+	// they are downloaded during the build
+	Offline offline.Assets
 }
 
-// NewBaseImageBuilder creates a new BaseImageBuilder
-func NewBaseImageBuilder(baseImage string) *BaseImageBuilder {
+// NewBaseImageBuilder creates a new BaseImageBuilder; the stemcell OS selects
+// the Dockerfile used to set up the base image
+func NewBaseImageBuilder(baseImage, stemcellOS string) *BaseImageBuilder {
 	return &BaseImageBuilder{
-		BaseImage: baseImage,
+		BaseImage:  baseImage,
+		StemcellOS: stemcellOS,
 	}
 }
 
@@ -41,60 +48,71 @@ func (b *BaseImageBuilder) NewDockerPopulator() func(*tar.Writer) error {
 			return err
 		}
 
-		// Add rsyslog_conf, monitrc.erb, and the post-start handler.
-		for _, assetName := range dockerfiles.AssetNames() {
-			switch {
-			case strings.HasPrefix(assetName, "rsyslog_conf/"):
-			case assetName == "monitrc.erb":
-			case assetName == "post-start.sh":
-			default:
-				continue
-			}
-			assetContents, err := dockerfiles.Asset(assetName)
-			if err != nil {
-				return err
-			}
-			err = util.WriteToTarStream(tarWriter, assetContents, tar.Header{
-				Name: assetName,
+		for name, contents := range b.Offline {
+			err = util.WriteToTarStream(tarWriter, contents, tar.Header{
+				Name: filepath.Join("offline", name),
 			})
 			if err != nil {
 				return err
 			}
 		}
 
-		// Add configgin
-		configginGzip, err := configgin.Asset("configgin.tgz")
+		// Add rsyslog_conf, monitrc.erb, the post-start handler, and configgin.
+		return writeBaseAssets(tarWriter, true)
+	}
+}
+
+// writeBaseAssets adds the assets shared by all role images (monitrc.erb,
+// the post-start handler and configgin) to the docker tar archive, plus the
+// rsyslog configuration if requested
+func writeBaseAssets(tarWriter *tar.Writer, withRsyslog bool) error {
+	for _, assetName := range dockerfiles.AssetNames() {
+		switch {
+		case strings.HasPrefix(assetName, "rsyslog_conf/") && withRsyslog:
+		case assetName == "monitrc.erb":
+		case assetName == "post-start.sh":
+		default:
+			continue
+		}
+		assetContents, err := dockerfiles.Asset(assetName)
 		if err != nil {
 			return err
 		}
-		err = util.TargzIterate(
-			"configgin.tgz",
-			bytes.NewReader(configginGzip),
-			func(reader *tar.Reader, header *tar.Header) error {
-				header.Name = filepath.Join("configgin", header.Name)
-				if err = tarWriter.WriteHeader(header); err != nil {
-					return err
-				}
-				if _, err = io.Copy(tarWriter, reader); err != nil {
-					return err
-				}
-				return nil
-			})
+		err = util.WriteToTarStream(tarWriter, assetContents, tar.Header{
+			Name: assetName,
+		})
 		if err != nil {
 			return err
 		}
+	}
 
-		return nil
+	configginGzip, err := configgin.Asset("configgin.tgz")
+	if err != nil {
+		return err
 	}
+	return util.TargzIterate(
+		"configgin.tgz",
+		bytes.NewReader(configginGzip),
+		func(reader *tar.Reader, header *tar.Header) error {
+			header.Name = filepath.Join("configgin", header.Name)
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tarWriter, reader); err != nil {
+				return err
+			}
+			return nil
+		})
 }
 
 func (b *BaseImageBuilder) generateDockerfile() ([]byte, error) {
-	asset, err := dockerfiles.Asset("Dockerfile-base")
+	assetName := fmt.Sprintf("Dockerfile-base-%s", b.StemcellOS)
+	asset, err := dockerfiles.Asset(assetName)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error loading %s, stemcell OS %s is not supported: %s", assetName, b.StemcellOS, err.Error())
 	}
 
-	dockerfileTemplate := template.New("Dockerfile-base")
+	dockerfileTemplate := template.New(assetName)
 	dockerfileTemplate, err = dockerfileTemplate.Parse(string(asset))
 	if err != nil {
 		return nil, err
@@ -110,6 +128,6 @@ func (b *BaseImageBuilder) generateDockerfile() ([]byte, error) {
 }
 
 // GetBaseImageName generates a docker image name to be used as a role image base
-func GetBaseImageName(repository, fissileVersion string) string {
-	return util.SanitizeDockerName(fmt.Sprintf("%s-role-base:%s", repository, fissileVersion))
+func GetBaseImageName(repository, fissileVersion, stemcellOS string) string {
+	return util.SanitizeDockerName(fmt.Sprintf("%s-role-base:%s-%s", repository, fissileVersion, stemcellOS))
 }
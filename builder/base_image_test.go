@@ -3,11 +3,14 @@ package builder
 import (
 	"archive/tar"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/hpcloud/fissile/scripts/offline"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,7 +35,7 @@ func TestMain(m *testing.M) {
 func TestGenerateBaseImageDockerfile(t *testing.T) {
 	assert := assert.New(t)
 
-	baseImageBuilder := NewBaseImageBuilder("foo:bar")
+	baseImageBuilder := NewBaseImageBuilder("foo:bar", "ubuntu")
 
 	dockerfileContents, err := baseImageBuilder.generateDockerfile()
 	assert.NoError(err)
@@ -41,10 +44,93 @@ func TestGenerateBaseImageDockerfile(t *testing.T) {
 	assert.Contains(string(dockerfileContents), "foo:bar")
 }
 
+func TestGenerateBaseImageDockerfileOpenSUSE(t *testing.T) {
+	assert := assert.New(t)
+
+	baseImageBuilder := NewBaseImageBuilder("opensuse:42.2", "opensuse")
+
+	dockerfileContents, err := baseImageBuilder.generateDockerfile()
+	assert.NoError(err)
+
+	assert.Contains(string(dockerfileContents), "FROM opensuse:42.2")
+	assert.Contains(string(dockerfileContents), "zypper")
+}
+
+func TestGenerateBaseImageDockerfileUnknownOS(t *testing.T) {
+	assert := assert.New(t)
+
+	baseImageBuilder := NewBaseImageBuilder("foo:bar", "plan9")
+
+	_, err := baseImageBuilder.generateDockerfile()
+	assert.Error(err)
+	assert.Contains(err.Error(), "stemcell OS plan9 is not supported")
+}
+
+func TestGenerateBaseImageDockerfileOffline(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, stemcellOS := range []string{"ubuntu", "opensuse"} {
+		baseImageBuilder := NewBaseImageBuilder("foo:bar", stemcellOS)
+
+		dockerfileContents, err := baseImageBuilder.generateDockerfile()
+		assert.NoError(err)
+		assert.Contains(string(dockerfileContents), "wget https://github.com/Yelp/dumb-init")
+		assert.NotContains(string(dockerfileContents), "/tmp/offline")
+
+		baseImageBuilder.Offline = offline.Assets{"dumb-init_1.1.3_amd64.deb": []byte("dumb-init")}
+
+		dockerfileContents, err = baseImageBuilder.generateDockerfile()
+		assert.NoError(err)
+		dockerfile := string(dockerfileContents)
+		assert.Contains(dockerfile, "ADD offline /tmp/offline")
+		assert.Contains(dockerfile, fmt.Sprintf("tar -xzf /tmp/offline/%s-packages.tgz -C /tmp/offline/packages && \\\n", stemcellOS))
+		assert.NotContains(dockerfile, "wget")
+		assert.NotContains(dockerfile, "apt-get update")
+		assert.NotContains(dockerfile, "zypper --non-interactive refresh")
+		assert.NotContains(dockerfile, "{{")
+	}
+}
+
+func TestBaseImageNewDockerPopulatorOffline(t *testing.T) {
+	assert := assert.New(t)
+
+	baseImageBuilder := NewBaseImageBuilder("foo:bar", "ubuntu")
+	baseImageBuilder.Offline = offline.Assets{"ubuntu-packages.tgz": []byte("packages")}
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(baseImageBuilder.NewDockerPopulator()(tar.NewWriter(buffer)))
+
+	found := false
+	tarReader := tar.NewReader(buffer)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(err) {
+			break
+		}
+		if header.Name == "offline/ubuntu-packages.tgz" {
+			contents, err := ioutil.ReadAll(tarReader)
+			assert.NoError(err)
+			assert.Equal("packages", string(contents))
+			found = true
+		}
+	}
+	assert.True(found, "Missing offline asset in tar stream")
+}
+
+func TestGetBaseImageName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("foo-role-base:1.2.3-ubuntu", GetBaseImageName("foo", "1.2.3", "ubuntu"))
+	assert.Equal("foo-role-base:1.2.3-opensuse", GetBaseImageName("foo", "1.2.3", "opensuse"))
+}
+
 func TestBaseImageNewDockerPopulator(t *testing.T) {
 	assert := assert.New(t)
 
-	baseImageBuilder := NewBaseImageBuilder("foo:bar")
+	baseImageBuilder := NewBaseImageBuilder("foo:bar", "ubuntu")
 	buffer := &bytes.Buffer{}
 	tarPopulator := baseImageBuilder.NewDockerPopulator()
 	assert.NoError(tarPopulator(tar.NewWriter(buffer)))
@@ -83,7 +169,7 @@ func TestBaseImageNewDockerPopulator(t *testing.T) {
 func TestBaseImageNewDockerPopulatorWithError(t *testing.T) {
 	assert := assert.New(t)
 
-	tarPopulator := NewBaseImageBuilder("foo:bar").NewDockerPopulator()
+	tarPopulator := NewBaseImageBuilder("foo:bar", "ubuntu").NewDockerPopulator()
 	// We give it a closed writer, and ensure that the error bubbles up
 	pipeReader, pipeWriter, err := os.Pipe()
 	assert.NoError(err)
@@ -23,6 +23,7 @@ type PackagesImageBuilder struct {
 	compiledPackagesPath string
 	targetPath           string
 	fissileVersion       string
+	stemcellOS           string
 	ui                   *termui.UI
 }
 
@@ -30,7 +31,7 @@ type PackagesImageBuilder struct {
 var baseImageOverride string
 
 // NewPackagesImageBuilder creates a new PackagesImageBuilder
-func NewPackagesImageBuilder(repository, compiledPackagesPath, targetPath, fissileVersion string, ui *termui.UI) (*PackagesImageBuilder, error) {
+func NewPackagesImageBuilder(repository, compiledPackagesPath, targetPath, fissileVersion, stemcellOS string, ui *termui.UI) (*PackagesImageBuilder, error) {
 	if err := os.MkdirAll(targetPath, 0755); err != nil {
 		return nil, err
 	}
@@ -39,6 +40,7 @@ func NewPackagesImageBuilder(repository, compiledPackagesPath, targetPath, fissi
 		compiledPackagesPath: compiledPackagesPath,
 		targetPath:           targetPath,
 		fissileVersion:       fissileVersion,
+		stemcellOS:           stemcellOS,
 		ui:                   ui,
 	}, nil
 }
@@ -96,7 +98,7 @@ func (w *tarWalker) walk(path string, info os.FileInfo, err error) error {
 // packages layer image.  Given a list of packages, it returns the base image
 // name to use, as well as the set of packages that still need to be inserted.
 func (p *PackagesImageBuilder) determinePackagesLayerBaseImage(packages model.Packages) (string, model.Packages, error) {
-	baseImageName := GetBaseImageName(p.repository, p.fissileVersion)
+	baseImageName := GetBaseImageName(p.repository, p.fissileVersion, p.stemcellOS)
 	if baseImageOverride != "" {
 		baseImageName = baseImageOverride
 	}
@@ -161,7 +163,7 @@ func (p *PackagesImageBuilder) NewDockerPopulator(roleManifest *model.RoleManife
 
 		// Generate dockerfile
 		dockerfile := bytes.Buffer{}
-		baseImageName := GetBaseImageName(p.repository, p.fissileVersion)
+		baseImageName := GetBaseImageName(p.repository, p.fissileVersion, p.stemcellOS)
 		if !forceBuildAll {
 			baseImageName, packages, err = p.determinePackagesLayerBaseImage(packages)
 			if err != nil {
@@ -230,8 +232,9 @@ func (p *PackagesImageBuilder) generateDockerfile(baseImage string, packages mod
 
 // GetRolePackageImageName generates a docker image name for the amalgamation for a role image
 func (p *PackagesImageBuilder) GetRolePackageImageName(roleManifest *model.RoleManifest) string {
-	return util.SanitizeDockerName(fmt.Sprintf("%s-role-packages:%s",
+	return util.SanitizeDockerName(fmt.Sprintf("%s-role-packages:%s-%s",
 		p.repository,
 		roleManifest.GetRoleManifestDevPackageVersion(p.fissileVersion),
+		p.stemcellOS,
 	))
 }
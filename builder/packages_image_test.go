@@ -47,7 +47,7 @@ func TestGenerateDockerfile(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	packagesImageBuilder, err := NewPackagesImageBuilder("foo", compiledPackagesDir, targetPath, "3.14.15", ui)
+	packagesImageBuilder, err := NewPackagesImageBuilder("foo", compiledPackagesDir, targetPath, "3.14.15", "ubuntu", ui)
 	assert.NoError(err)
 
 	dockerfile := bytes.Buffer{}
@@ -85,14 +85,14 @@ func TestNewDockerPopulator(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
 	rolesManifest, err := model.LoadRoleManifest(roleManifestPath, []*model.Release{release}, false)
 	assert.NoError(err)
 
-	packagesImageBuilder, err := NewPackagesImageBuilder("foo", compiledPackagesDir, targetPath, "3.14.15", ui)
+	packagesImageBuilder, err := NewPackagesImageBuilder("foo", compiledPackagesDir, targetPath, "3.14.15", "ubuntu", ui)
 	assert.NoError(err)
 
 	tarFile := &bytes.Buffer{}
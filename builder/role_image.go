@@ -48,13 +48,14 @@ type RoleImageBuilder struct {
 	metricsPath          string
 	version              string
 	fissileVersion       string
+	stemcellOS           string
 	lightOpinionsPath    string
 	darkOpinionsPath     string
 	ui                   *termui.UI
 }
 
 // NewRoleImageBuilder creates a new RoleImageBuilder
-func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath, lightOpinionsPath, darkOpinionsPath, metricsPath, version, fissileVersion string, ui *termui.UI) (*RoleImageBuilder, error) {
+func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath, lightOpinionsPath, darkOpinionsPath, metricsPath, version, fissileVersion, stemcellOS string, ui *termui.UI) (*RoleImageBuilder, error) {
 	if err := os.MkdirAll(targetPath, 0755); err != nil {
 		return nil, err
 	}
@@ -65,6 +66,7 @@ func NewRoleImageBuilder(repository, compiledPackagesPath, targetPath, lightOpin
 		metricsPath:          metricsPath,
 		version:              version,
 		fissileVersion:       fissileVersion,
+		stemcellOS:           stemcellOS,
 		lightOpinionsPath:    lightOpinionsPath,
 		darkOpinionsPath:     darkOpinionsPath,
 		ui:                   ui,
@@ -264,6 +266,7 @@ func (r *RoleImageBuilder) generateRunScript(role *model.Role) ([]byte, error) {
 	})
 	context := map[string]interface{}{
 		"role": role,
+		"spec": model.InstanceSpecPlaceholders,
 	}
 	runScriptTemplate, err = runScriptTemplate.Parse(string(asset))
 	if err != nil {
@@ -351,6 +354,7 @@ type roleBuildJob struct {
 	ui            *termui.UI
 	force         bool
 	noBuild       bool
+	verbose       bool
 	dockerManager dockerImageBuilder
 	resultsCh     chan<- error
 	abort         <-chan struct{}
@@ -367,7 +371,7 @@ func (j roleBuildJob) Run() {
 	}
 
 	j.resultsCh <- func() error {
-		roleImageName := GetRoleDevImageName(j.repository, j.role, j.role.GetRoleDevVersion())
+		roleImageName := GetRoleDevImageName(j.repository, j.builder.stemcellOS, j.role, j.role.GetRoleDevVersion())
 		if !j.force {
 			if hasImage, err := j.dockerManager.HasImage(roleImageName); err != nil {
 				return err
@@ -401,23 +405,48 @@ func (j roleBuildJob) Run() {
 
 		j.ui.Printf("Building docker image of %s in %s ...\n", color.YellowString(j.role.Name), color.YellowString(dockerfileDir))
 
+		// The build output is always written to the log file on disk; the
+		// formatted output is streamed to the UI in verbose mode, and
+		// otherwise kept in an in-memory buffer to be shown on failure.
+		logPath := GetRoleBuildLogPath(j.builder.targetPath, j.role.Name)
+		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+			return err
+		}
+		logFile, err := os.Create(logPath)
+		if err != nil {
+			return fmt.Errorf("Error creating build log for role %s: %s", j.role.Name, err.Error())
+		}
+		defer logFile.Close()
+
 		log := new(bytes.Buffer)
+		var terminal io.Writer = log
+		if j.verbose {
+			terminal = j.ui
+		}
+
 		stdoutWriter := docker.NewFormattingWriter(
-			log,
-			docker.ColoredBuildStringFunc(roleImageName),
+			io.MultiWriter(logFile, docker.NewFormattingWriter(
+				terminal,
+				docker.ColoredBuildStringFunc(roleImageName),
+			)),
+			nil,
 		)
 
 		err = j.dockerManager.BuildImage(dockerfileDir, roleImageName, stdoutWriter)
 		if err != nil {
-			log.WriteTo(j.ui)
+			if !j.verbose {
+				log.WriteTo(j.ui)
+			}
+			j.ui.Printf("Build log: %s\n", color.YellowString(logPath))
 			return fmt.Errorf("Error building image: %s", err.Error())
 		}
 		return nil
 	}()
 }
 
-// BuildRoleImages triggers the building of the role docker images in parallel
-func (r *RoleImageBuilder) BuildRoleImages(roles model.Roles, repository, baseImageName string, force, noBuild bool, workerCount int) error {
+// BuildRoleImages triggers the building of the role docker images in parallel.
+// With verbose, the build output is streamed to the UI.
+func (r *RoleImageBuilder) BuildRoleImages(roles model.Roles, repository, baseImageName string, force, noBuild, verbose bool, workerCount int) error {
 	if workerCount < 1 {
 		return fmt.Errorf("Invalid worker count %d", workerCount)
 	}
@@ -439,6 +468,7 @@ func (r *RoleImageBuilder) BuildRoleImages(roles model.Roles, repository, baseIm
 			ui:            r.ui,
 			force:         force,
 			noBuild:       noBuild,
+			verbose:       verbose,
 			dockerManager: dockerManager,
 			resultsCh:     resultsCh,
 			abort:         abort,
@@ -464,11 +494,18 @@ func (r *RoleImageBuilder) BuildRoleImages(roles model.Roles, repository, baseIm
 	return err
 }
 
+// GetRoleBuildLogPath returns the path of the log of the latest image build
+// for the role, underneath the target path of the role image builder
+func GetRoleBuildLogPath(targetPath, roleName string) string {
+	return filepath.Join(targetPath, "logs", fmt.Sprintf("%s.log", roleName))
+}
+
 // GetRoleDevImageName generates a docker image name to be used as a dev role image
-func GetRoleDevImageName(repository string, role *model.Role, version string) string {
-	return util.SanitizeDockerName(fmt.Sprintf("%s-%s:%s",
+func GetRoleDevImageName(repository, stemcellOS string, role *model.Role, version string) string {
+	return util.SanitizeDockerName(fmt.Sprintf("%s-%s:%s-%s",
 		repository,
 		role.Name,
 		version,
+		stemcellOS,
 	))
 }
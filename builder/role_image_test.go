@@ -40,7 +40,7 @@ func TestGenerateRoleImageDockerfile(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -50,16 +50,16 @@ func TestGenerateRoleImageDockerfile(t *testing.T) {
 	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", releaseVersion, "6.28.30", ui)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", releaseVersion, "6.28.30", "ubuntu", ui)
 	assert.NoError(err)
 
 	var dockerfileContents bytes.Buffer
-	baseImage := GetBaseImageName(roleImageBuilder.repository, roleImageBuilder.fissileVersion)
+	baseImage := GetBaseImageName(roleImageBuilder.repository, roleImageBuilder.fissileVersion, roleImageBuilder.stemcellOS)
 	err = roleImageBuilder.generateDockerfile(rolesManifest.Roles[0], baseImage, &dockerfileContents)
 	assert.NoError(err)
 
 	dockerfileString := dockerfileContents.String()
-	assert.Contains(dockerfileString, "foo-role-base:6.28.30")
+	assert.Contains(dockerfileString, "foo-role-base:6.28.30-ubuntu")
 	assert.Contains(dockerfileString, "MAINTAINER", "release images should contain maintainer information")
 	assert.Contains(
 		dockerfileString,
@@ -93,7 +93,7 @@ func TestGenerateRoleImageRunScript(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -103,7 +103,7 @@ func TestGenerateRoleImageRunScript(t *testing.T) {
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
 
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", ui)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", "ubuntu", ui)
 	assert.NoError(err)
 
 	runScriptContents, err := roleImageBuilder.generateRunScript(rolesManifest.Roles[0])
@@ -121,11 +121,31 @@ func TestGenerateRoleImageRunScript(t *testing.T) {
 	assert.NotContains(string(runScriptContents), "/opt/hcf/startup/var/vcap/jobs/myrole/pre-start")
 	assert.NotContains(string(runScriptContents), "/opt/hcf//startup/var/vcap/jobs/myrole/pre-start")
 	assert.Contains(string(runScriptContents), "monit -vI &")
+	assert.Contains(string(runScriptContents), `-e "s|\"__FISSILE_SPEC_INDEX__\"|${spec_index}|g"`)
+	assert.Contains(string(runScriptContents), `-e "s|__FISSILE_SPEC_DEPLOYMENT__|${KUBERNETES_NAMESPACE:-}|g"`)
+	assert.Contains(string(runScriptContents), `spec_address="${IP_ADDRESS}"`)
+	assert.Contains(string(runScriptContents), "cat > /var/vcap/monit/depends-on <<EOF\nEOF\n", "Roles without dependencies wait for nothing")
 
 	runScriptContents, err = roleImageBuilder.generateRunScript(rolesManifest.Roles[1])
 	assert.NoError(err)
 	assert.NotContains(string(runScriptContents), "monit -vI")
 	assert.Contains(string(runScriptContents), "/var/vcap/jobs/tor/bin/run")
+
+	assert.Contains(string(runScriptContents), "spec_bootstrap=true")
+
+	// None of the pods of a scaled deployment is the bootstrap instance
+	rolesManifest.Roles[0].Run = &model.RoleRun{Scaling: &model.RoleRunScaling{Min: 1, Max: 3}}
+	runScriptContents, err = roleImageBuilder.generateRunScript(rolesManifest.Roles[0])
+	assert.NoError(err)
+	assert.NotContains(string(runScriptContents), "spec_bootstrap=true")
+
+	// Pods of stateful sets get their index from their name
+	rolesManifest.Roles[0].Tags = append(rolesManifest.Roles[0].Tags, "clustered")
+	runScriptContents, err = roleImageBuilder.generateRunScript(rolesManifest.Roles[0])
+	assert.NoError(err)
+	assert.Contains(string(runScriptContents), `spec_index="${HOSTNAME##*-}"`)
+	assert.Contains(string(runScriptContents), `spec_address="${HOSTNAME}.myrole-pod"`)
+	assert.Contains(string(runScriptContents), "spec_bootstrap=true")
 }
 
 func TestGenerateRoleImageJobsConfig(t *testing.T) {
@@ -147,7 +167,7 @@ func TestGenerateRoleImageJobsConfig(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -157,7 +177,7 @@ func TestGenerateRoleImageJobsConfig(t *testing.T) {
 	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", ui)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", "ubuntu", ui)
 	assert.NoError(err)
 
 	jobsConfigContents, err := roleImageBuilder.generateJobsConfig(rolesManifest.Roles[0])
@@ -196,7 +216,7 @@ func TestGenerateRoleImageDockerfileDir(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -207,7 +227,7 @@ func TestGenerateRoleImageDockerfileDir(t *testing.T) {
 	lightOpinionsPath := filepath.Join(torOpinionsDir, "opinions.yml")
 	darkOpinionsPath := filepath.Join(torOpinionsDir, "dark-opinions.yml")
 
-	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", ui)
+	roleImageBuilder, err := NewRoleImageBuilder("foo", compiledPackagesDir, targetPath, lightOpinionsPath, darkOpinionsPath, "", "3.14.15", "6.28.30", "ubuntu", ui)
 	assert.NoError(err)
 
 	dockerfileDir, err := roleImageBuilder.CreateDockerfileDir(
@@ -277,6 +297,14 @@ func TestGenerateRoleImageDockerfileDir(t *testing.T) {
 	}
 
 	expectedString := `{
+		"name": "myrole",
+		"id": "__FISSILE_SPEC_ID__",
+		"index": "__FISSILE_SPEC_INDEX__",
+		"az": "__FISSILE_SPEC_AZ__",
+		"bootstrap": "__FISSILE_SPEC_BOOTSTRAP__",
+		"address": "__FISSILE_SPEC_ADDRESS__",
+		"deployment": "__FISSILE_SPEC_DEPLOYMENT__",
+		"ip": "__FISSILE_SPEC_IP__",
 		"job": {
 			"name": "myrole",
 			"templates": [
@@ -369,7 +397,7 @@ func TestBuildRoleImages(t *testing.T) {
 	assert.NoError(err)
 	defer os.RemoveAll(targetPath)
 
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -388,6 +416,7 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		"3.14.15",
 		"6.28.30",
+		"ubuntu",
 		ui,
 	)
 	assert.NoError(err)
@@ -413,10 +442,16 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		false,
 		false,
+		false,
 		2,
 	)
 	assert.NoError(err)
 
+	for _, role := range rolesManifest.Roles {
+		_, err = os.Stat(GetRoleBuildLogPath(targetPath, role.Name))
+		assert.NoError(err, "Build log for role %s should have been written", role.Name)
+	}
+
 	err = os.RemoveAll(targetPath)
 	assert.NoError(err, "Failed to remove target")
 
@@ -432,6 +467,7 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		false,
 		false,
+		false,
 		0,
 	)
 	assert.Error(err, "Invalid worker count should result in an error")
@@ -457,6 +493,7 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		false,
 		false,
+		false,
 		1,
 	)
 	assert.Contains(err.Error(), "Deliberate failure", "Returned error should be from first job failing")
@@ -475,6 +512,7 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		false,
 		false,
+		false,
 		len(rolesManifest.Roles),
 	)
 	assert.NoError(err)
@@ -506,14 +544,15 @@ func TestBuildRoleImages(t *testing.T) {
 		"",
 		false,
 		false,
+		false,
 		1,
 	)
 	assert.NoError(err)
 
-	expected := `.*,fissile,create-role-images::test-repository-myrole:[a-z0-9]{40},start
-.*,fissile,create-role-images::test-repository-myrole:[a-z0-9]{40},done
-.*,fissile,create-role-images::test-repository-foorole:[a-z0-9]{40},start
-.*,fissile,create-role-images::test-repository-foorole:[a-z0-9]{40},done`
+	expected := `.*,fissile,create-role-images::test-repository-myrole:[a-z0-9]{40}-ubuntu,start
+.*,fissile,create-role-images::test-repository-myrole:[a-z0-9]{40}-ubuntu,done
+.*,fissile,create-role-images::test-repository-foorole:[a-z0-9]{40}-ubuntu,start
+.*,fissile,create-role-images::test-repository-foorole:[a-z0-9]{40}-ubuntu,done`
 
 	contents, err := ioutil.ReadFile(metrics)
 	assert.NoError(err)
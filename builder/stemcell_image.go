@@ -0,0 +1,116 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/hpcloud/fissile/scripts/dockerfiles"
+	"github.com/hpcloud/fissile/util"
+)
+
+// These labels make up the contract a stemcell image has to fulfill to be
+// used as the base of role images; they are checked instead of probing the
+// image, so that no container needs to be run (or anything downloaded).
+const (
+	// StemcellLabelOS names the stemcell OS (e.g. ubuntu); it must match the
+	// OS fissile compiles packages for
+	StemcellLabelOS = "stemcell.fissile.os"
+	// StemcellLabelVcapUser declares that a vcap user exists; its value is the
+	// user's uid
+	StemcellLabelVcapUser = "stemcell.fissile.vcap-user"
+	// StemcellLabelMonit declares that monit is installed; its value is the
+	// monit version
+	StemcellLabelMonit = "stemcell.fissile.monit"
+	// StemcellLabelConfiggin declares that the runtime needed by configgin is
+	// installed; its value is the ruby version
+	StemcellLabelConfiggin = "stemcell.fissile.configgin"
+)
+
+// requiredStemcellLabels lists the labels every stemcell image must have
+var requiredStemcellLabels = []string{
+	StemcellLabelOS,
+	StemcellLabelVcapUser,
+	StemcellLabelMonit,
+	StemcellLabelConfiggin,
+}
+
+// StemcellImageBuilder represents a builder of role base images on top of an
+// existing stemcell image
+type StemcellImageBuilder struct {
+	StemcellImage string
+}
+
+// NewStemcellImageBuilder creates a new StemcellImageBuilder
+func NewStemcellImageBuilder(stemcellImage string) *StemcellImageBuilder {
+	return &StemcellImageBuilder{
+		StemcellImage: stemcellImage,
+	}
+}
+
+// ValidateStemcellLabels checks the labels of a stemcell image against the
+// stemcell contract, and reports all violations at once
+func ValidateStemcellLabels(stemcellImage string, labels map[string]string, stemcellOS string) error {
+	var problems []string
+
+	for _, label := range requiredStemcellLabels {
+		if strings.TrimSpace(labels[label]) == "" {
+			problems = append(problems, fmt.Sprintf("missing label %s", label))
+		}
+	}
+
+	if labelOS := labels[StemcellLabelOS]; labelOS != "" && labelOS != stemcellOS {
+		problems = append(problems, fmt.Sprintf("label %s is %s, expected %s", StemcellLabelOS, labelOS, stemcellOS))
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("Image %s is not a valid stemcell: %s", stemcellImage, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// NewDockerPopulator returns a function that will populate the docker tar archive
+func (s *StemcellImageBuilder) NewDockerPopulator() func(*tar.Writer) error {
+	return func(tarWriter *tar.Writer) error {
+		// Generate dockerfile
+		dockerfileContents, err := s.generateDockerfile()
+		if err != nil {
+			return err
+		}
+		err = util.WriteToTarStream(tarWriter, dockerfileContents, tar.Header{
+			Name: "Dockerfile",
+		})
+		if err != nil {
+			return err
+		}
+
+		// The stemcell brings its own rsyslog configuration
+		return writeBaseAssets(tarWriter, false)
+	}
+}
+
+func (s *StemcellImageBuilder) generateDockerfile() ([]byte, error) {
+	asset, err := dockerfiles.Asset("Dockerfile-stemcell")
+	if err != nil {
+		return nil, err
+	}
+
+	dockerfileTemplate := template.New("Dockerfile-stemcell")
+	dockerfileTemplate, err = dockerfileTemplate.Parse(string(asset))
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	err = dockerfileTemplate.Execute(&output, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
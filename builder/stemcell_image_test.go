@@ -0,0 +1,80 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStemcellLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	labels := map[string]string{
+		StemcellLabelOS:        "ubuntu",
+		StemcellLabelVcapUser:  "1000",
+		StemcellLabelMonit:     "5.2.5",
+		StemcellLabelConfiggin: "2.3.1",
+	}
+	assert.NoError(ValidateStemcellLabels("my-stemcell:1", labels, "ubuntu"))
+
+	err := ValidateStemcellLabels("my-stemcell:1", labels, "opensuse")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "label stemcell.fissile.os is ubuntu, expected opensuse")
+	}
+
+	delete(labels, StemcellLabelMonit)
+	labels[StemcellLabelConfiggin] = " "
+	err = ValidateStemcellLabels("my-stemcell:1", labels, "ubuntu")
+	if assert.Error(err) {
+		assert.Equal("Image my-stemcell:1 is not a valid stemcell: missing label stemcell.fissile.configgin, missing label stemcell.fissile.monit", err.Error())
+	}
+
+	err = ValidateStemcellLabels("my-stemcell:1", nil, "ubuntu")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "missing label stemcell.fissile.vcap-user")
+	}
+}
+
+func TestStemcellImageNewDockerPopulator(t *testing.T) {
+	assert := assert.New(t)
+
+	buffer := &bytes.Buffer{}
+	tarPopulator := NewStemcellImageBuilder("my-stemcell:1").NewDockerPopulator()
+	assert.NoError(tarPopulator(tar.NewWriter(buffer)))
+
+	testFunctions := map[string]func([]byte){
+		"Dockerfile": func(rawContents []byte) {
+			assert.Contains(string(rawContents), "FROM my-stemcell:1")
+			assert.NotContains(string(rawContents), "apt-get")
+			assert.NotContains(string(rawContents), "wget")
+		},
+		"configgin/configgin": func(rawContents []byte) {},
+		"monitrc.erb": func(rawContents []byte) {
+			assert.Contains(string(rawContents), "hcf.monit.password")
+		},
+		"post-start.sh": func(rawContents []byte) {},
+	}
+
+	tarReader := tar.NewReader(buffer)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(err) {
+			break
+		}
+		assert.NotContains(header.Name, "rsyslog_conf", "The stemcell brings its own rsyslog configuration")
+		if tester, ok := testFunctions[header.Name]; ok {
+			actual, err := ioutil.ReadAll(tarReader)
+			assert.NoError(err)
+			tester(actual)
+			delete(testFunctions, header.Name)
+		}
+	}
+	assert.Empty(testFunctions, "Missing files in tar stream")
+}
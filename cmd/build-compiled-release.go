@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagBuildCompiledReleaseStemcell  string
+	flagBuildCompiledReleaseOutputDir string
+)
+
+// buildCompiledReleaseCmd represents the compiled-release command
+var buildCompiledReleaseCmd = &cobra.Command{
+	Use:   "compiled-release",
+	Short: "Exports compiled BOSH packages as compiled release tarballs.",
+	Long: `
+This command will write a BOSH compiled release tarball for each release, using the
+packages compiled by its sibling "packages" (found in ` + "`<work-dir>/compilation`" + `).
+Only the jobs referenced by your role manifest, and the packages they need, are
+exported. The tarballs are named ` + "`<RELEASE_NAME>-<RELEASE_VERSION>-<STEMCELL_OS>-<STEMCELL_VERSION>.tgz`" + `.
+
+The resulting tarballs can be uploaded to a BOSH director, or used as releases for
+fissile itself, in which case the packages are not compiled again.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		flagBuildCompiledReleaseStemcell = viper.GetString("stemcell")
+		flagBuildCompiledReleaseOutputDir = viper.GetString("compiled-release-output-dir")
+
+		err := fissile.LoadReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.ExportCompiledReleases(
+			workPathCompilationDir,
+			flagRoleManifest,
+			flagBuildCompiledReleaseStemcell,
+			flagBuildCompiledReleaseOutputDir,
+			flagReleaseBuild,
+		)
+	},
+}
+
+func init() {
+	buildCmd.AddCommand(buildCompiledReleaseCmd)
+
+	buildCompiledReleaseCmd.PersistentFlags().StringP(
+		"stemcell",
+		"",
+		"",
+		"Stemcell (<os>/<version>, e.g. ubuntu-trusty/3421.11) the packages were compiled for; required",
+	)
+
+	buildCompiledReleaseCmd.PersistentFlags().StringP(
+		"compiled-release-output-dir",
+		"",
+		".",
+		"Compiled release tarballs will be written to this directory",
+	)
+
+	viper.BindPFlags(buildCompiledReleaseCmd.PersistentFlags())
+}
@@ -68,6 +68,7 @@ from other specs.  At most one is allowed.  Its syntax is --patch-properties-rel
 			flagLightOpinions,
 			flagDarkOpinions,
 			flagReleaseBuild,
+			flagVerbose,
 		)
 	},
 }
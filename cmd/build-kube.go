@@ -1,16 +1,27 @@
 package cmd
 
 import (
+	"github.com/hpcloud/fissile/kube"
+	"github.com/hpcloud/fissile/model"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
 	flagBuildKubeOutputDir          string
+	flagBuildKubeOutputFormat       string
 	flagBuildKubeDefaultEnvFiles    []string
 	flagBuildKubeDockerRegistry     string
 	flagBuildKubeDockerOrganization string
 	flagBuildKubeUseMemoryLimits    bool
+	flagBuildKubePublicExposure     string
+	flagBuildKubeExternalIPs        []string
+	flagBuildKubeIngressDomain      string
+	flagBuildKubeQoS                string
+	flagBuildKubePersistentStorage  string
+	flagBuildKubeSharedStorage      string
+	flagBuildKubeKubectlImage       string
 )
 
 // buildKubeCmd represents the kube command
@@ -21,10 +32,18 @@ var buildKubeCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		flagBuildKubeOutputDir = viper.GetString("kube-output-dir")
+		flagBuildKubeOutputFormat = viper.GetString("output-format")
 		flagBuildKubeDefaultEnvFiles = splitNonEmpty(viper.GetString("defaults-file"), ",")
 		flagBuildKubeDockerRegistry = viper.GetString("docker-registry")
 		flagBuildKubeDockerOrganization = viper.GetString("docker-organization")
 		flagBuildKubeUseMemoryLimits = viper.GetBool("use-memory-limits")
+		flagBuildKubePublicExposure = viper.GetString("public-exposure")
+		flagBuildKubeExternalIPs = splitNonEmpty(viper.GetString("external-ips"), ",")
+		flagBuildKubeIngressDomain = viper.GetString("ingress-domain")
+		flagBuildKubeQoS = viper.GetString("qos-class")
+		flagBuildKubePersistentStorage = viper.GetString("persistent-storage-class")
+		flagBuildKubeSharedStorage = viper.GetString("shared-storage-class")
+		flagBuildKubeKubectlImage = viper.GetString("kubectl-image")
 
 		err := fissile.LoadReleases(
 			flagRelease,
@@ -39,12 +58,23 @@ var buildKubeCmd = &cobra.Command{
 		return fissile.GenerateKube(
 			flagRoleManifest,
 			flagBuildKubeOutputDir,
-			flagRepository,
-			flagBuildKubeDockerRegistry,
-			flagBuildKubeDockerOrganization,
+			flagBuildKubeOutputFormat,
 			flagBuildKubeDefaultEnvFiles,
-			flagBuildKubeUseMemoryLimits,
 			flagReleaseBuild,
+			&kube.ExportSettings{
+				DeploymentName:         flagDeploymentName,
+				Repository:             flagRepository,
+				Registry:               flagBuildKubeDockerRegistry,
+				Organization:           flagBuildKubeDockerOrganization,
+				UseMemoryLimits:        flagBuildKubeUseMemoryLimits,
+				PublicExposure:         model.PublicExposure(flagBuildKubePublicExposure),
+				ExternalIPs:            flagBuildKubeExternalIPs,
+				IngressDomain:          flagBuildKubeIngressDomain,
+				QoS:                    flagBuildKubeQoS,
+				PersistentStorageClass: flagBuildKubePersistentStorage,
+				SharedStorageClass:     flagBuildKubeSharedStorage,
+				KubectlImage:           flagBuildKubeKubectlImage,
+			},
 		)
 
 	},
@@ -60,6 +90,13 @@ func init() {
 		"Kubernetes configuration files will be written to this directory",
 	)
 
+	buildKubeCmd.PersistentFlags().StringP(
+		"output-format",
+		"",
+		"kube",
+		"Format of the configuration files, one of kube or helm (a helm chart with the roles as templates)",
+	)
+
 	buildKubeCmd.PersistentFlags().StringP(
 		"defaults-file",
 		"D",
@@ -88,5 +125,54 @@ func init() {
 		"Include memory limits when generating kube configurations",
 	)
 
+	buildKubeCmd.PersistentFlags().StringP(
+		"public-exposure",
+		"",
+		string(model.PublicExposureExternalIPs),
+		"How public ports of roles are exposed, one of load-balancer, node-port, external-ips or ingress; the role manifest takes precedence",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"external-ips",
+		"",
+		"",
+		"Comma separated list of the IPs public ports are exposed on, for external-ips exposure",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"ingress-domain",
+		"",
+		"",
+		"Domain of the ingress hosts of roles exposed through an ingress, which are named <role>.<domain>",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"qos-class",
+		"",
+		"",
+		"QoS class of the role pods, one of burstable or guaranteed; guaranteed pods are limited to what they request",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"persistent-storage-class",
+		"",
+		kube.DefaultPersistentStorageClass,
+		"Storage class of the persistent volumes of roles, unless the role manifest gives one",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"shared-storage-class",
+		"",
+		kube.DefaultSharedStorageClass,
+		"Storage class of the shared volumes of roles, unless the role manifest gives one",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"kubectl-image",
+		"",
+		"",
+		"Image with kubectl and /bin/sh for the init containers of roles waiting for the roles of earlier flight stages; required by role manifests with flight stages. The containers query the kube API with a service account generated for the role. Pin the image by digest, and push it to your registry for offline clusters",
+	)
+
 	viper.BindPFlags(buildKubeCmd.PersistentFlags())
 }
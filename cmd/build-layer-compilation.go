@@ -14,11 +14,11 @@ var buildLayerCompilationCmd = &cobra.Command{
 	Use:   "compilation",
 	Short: "Builds a docker image layer to be used when compiling packages.",
 	Long: `
-This command creates a container with the name ` + "`<repository>-cbase-<FISSILE_VERSION>`" + ` 
+This command creates a container with the name ` + "`<repository>-cbase-<FISSILE_VERSION>-<STEMCELL_OS>`" + ` 
 and runs a compilation prerequisites script within. 
 
 Once the prerequisites script completes successfully, an image named 
-` + "`<repository>-cbase:<FISSILE_VERSION>`" + ` is created and the created container is 
+` + "`<repository>-cbase:<FISSILE_VERSION>-<STEMCELL_OS>`" + ` is created and the created container is 
 removed.
 
 If the prerequisites script fails, the container is not removed. 
@@ -1,7 +1,14 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagBuildLayerStemcellFromStemcell string
 )
 
 // buildLayerStemcellCmd represents the runtime command
@@ -14,10 +21,34 @@ similar to BOSH 'stemcells'.
 
 Fissile will create a Dockerfile and a directory structure with all dependencies in 
 ` + "`<work-dir>/base_dockerfile`" + `. After that, it will build an image named 
-` + "`<repository>-role-base:<FISSILE_VERSION>`" + `.
+` + "`<repository>-role-base:<FISSILE_VERSION>-<STEMCELL_OS>`" + `.
+
+With ` + "`--from-stemcell`" + `, an existing stemcell image is used instead, and only
+fissile's own assets (monitrc.erb, post-start.sh and configgin) are added to it.
+The stemcell image must be available locally, and must carry these labels:
+
+  stemcell.fissile.os          the stemcell OS, matching --stemcell-os
+  stemcell.fissile.vcap-user   the uid of the vcap user
+  stemcell.fissile.monit       the installed monit version
+  stemcell.fissile.configgin   the ruby version available to configgin
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		flagBuildLayerStemcellFromStemcell = viper.GetString("from-stemcell")
+
+		if flagBuildLayerStemcellFromStemcell != "" {
+			if flagBuildLayerFrom != "" {
+				return fmt.Errorf("--from and --from-stemcell cannot be used together")
+			}
+
+			return fissile.GenerateBaseDockerImageFromStemcell(
+				flagBuildLayerStemcellFromStemcell,
+				flagMetrics,
+				flagBuildLayerNoBuild,
+				flagRepository,
+			)
+		}
+
 		return fissile.GenerateBaseDockerImage(
 			workPathBaseDockerfile,
 			flagBuildLayerFrom,
@@ -30,4 +61,13 @@ Fissile will create a Dockerfile and a directory structure with all dependencies
 
 func init() {
 	buildLayerCmd.AddCommand(buildLayerRuntimeCmd)
+
+	buildLayerRuntimeCmd.PersistentFlags().StringP(
+		"from-stemcell",
+		"",
+		"",
+		"Existing stemcell image to build the role base from, instead of installing everything on top of --from",
+	)
+
+	viper.BindPFlags(buildLayerRuntimeCmd.PersistentFlags())
 }
@@ -35,8 +35,8 @@ func init() {
 	buildLayerCmd.PersistentFlags().StringP(
 		"from",
 		"F",
-		"ubuntu:14.04",
-		"Docker image used as a base for the layers",
+		"",
+		"Docker image used as a base for the layers; defaults to ubuntu:14.04 or opensuse:42.2, depending on --stemcell-os",
 	)
 
 	buildLayerCmd.PersistentFlags().BoolP(
@@ -2,6 +2,15 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagBuildPackagesPackageCache          string
+	flagBuildPackagesPackageCacheAccessKey string
+	flagBuildPackagesPackageCacheSecretKey string
+	flagBuildPackagesPackageCacheRegion    string
+	flagBuildPackagesRetryFailed           bool
 )
 
 // buildPackagesCmd represents the packages command
@@ -11,20 +20,47 @@ var buildPackagesCmd = &cobra.Command{
 	Long: `
 This command will compile all required packages in the BOSH releases referenced by
 your role manifest. The command will create a compilation container named 
-` + "`<repository>-cbase-<FISSILE_VERSION>-<RELEASE_NAME>-<RELEASE_VERSION>-pkg-<PACKAGE_NAME>`" + ` 
-for each package (e.g. ` + "`fissile-cbase-1.0.0-cf-217-pkg-nats`" + `). 
+` + "`<repository>-cbase-<FISSILE_VERSION>-<STEMCELL_OS>-<RELEASE_NAME>-<RELEASE_VERSION>-pkg-<PACKAGE_NAME>`" + ` 
+for each package (e.g. ` + "`fissile-cbase-1.0.0-ubuntu-cf-217-pkg-nats`" + `). 
 
 All containers are removed, whether compilation is successful or not. However, if 
 the compilation is interrupted during compilation (e.g. sending SIGINT), containers 
 will most likely be left behind.
 
-Compiled packages are stored in ` + "`<work-dir>/compilation`" + `. Fissile uses the 
+Compiled packages are stored in ` + "`<work-dir>/compilation`" + ` (` + "`<work-dir>/compilation-<STEMCELL_OS>`" + `
+for stemcell OSes other than Ubuntu). Fissile uses the 
 package's fingerprint as part of the directory structure. This means that if the 
 same package (with the same version) is used by multiple releases, it will only be 
 compiled once.
+
+Packages of compiled release tarballs (containing ` + "`compiled_packages`" + `) are not 
+compiled again; they are extracted directly into the compilation directory.
+
+With ` + "`--package-cache`" + `, compiled packages are shared between hosts (e.g. CI agents).
+The cache is either a directory (which may be on NFS), or the URL of an HTTP server
+accepting GET and PUT requests, such as an S3 bucket. Packages are looked up in the
+cache by fingerprint and compilation image before being compiled, and added to it
+after being compiled successfully. Requests to S3 are signed when an access key is
+set; use ` + "`FISSILE_PACKAGE_CACHE_ACCESS_KEY`" + ` and ` + "`FISSILE_PACKAGE_CACHE_SECRET_KEY`" + ` to
+keep the credentials off the command line.
+
+Each run is recorded in a journal in ` + "`<work-dir>/compilation-journal`" + `, which can be viewed
+with ` + "`fissile show compilation`" + `. With ` + "`--retry-failed`" + `, only the packages which were not
+compiled successfully in the previous run are compiled, after removing the leftovers
+of interrupted compilations.
+
+The output of each compilation is written to ` + "`<work-dir>/compilation/<fingerprint>/compile.log`" + `,
+and can be viewed with ` + "`fissile show log <release>/<package>`" + `. Use ` + "`--verbose`" + ` to see it
+while compiling.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		flagBuildPackagesPackageCache = viper.GetString("package-cache")
+		flagBuildPackagesPackageCacheAccessKey = viper.GetString("package-cache-access-key")
+		flagBuildPackagesPackageCacheSecretKey = viper.GetString("package-cache-secret-key")
+		flagBuildPackagesPackageCacheRegion = viper.GetString("package-cache-region")
+		flagBuildPackagesRetryFailed = viper.GetBool("retry-failed")
+
 		err := fissile.LoadReleases(
 			flagRelease,
 			flagReleaseName,
@@ -42,10 +78,54 @@ compiled once.
 			flagMetrics,
 			flagWorkers,
 			flagReleaseBuild,
+			flagBuildPackagesPackageCache,
+			flagBuildPackagesPackageCacheAccessKey,
+			flagBuildPackagesPackageCacheSecretKey,
+			flagBuildPackagesPackageCacheRegion,
+			workPathCompilationJournalDir,
+			flagBuildPackagesRetryFailed,
+			flagVerbose,
 		)
 	},
 }
 
 func init() {
 	buildCmd.AddCommand(buildPackagesCmd)
+
+	buildPackagesCmd.PersistentFlags().StringP(
+		"package-cache",
+		"",
+		"",
+		"Directory or HTTP(S) URL of a cache of compiled packages shared between hosts",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringP(
+		"package-cache-access-key",
+		"",
+		"",
+		"Access key used to sign requests to an S3 package cache",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringP(
+		"package-cache-secret-key",
+		"",
+		"",
+		"Secret key used to sign requests to an S3 package cache",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringP(
+		"package-cache-region",
+		"",
+		"us-east-1",
+		"Region used to sign requests to an S3 package cache",
+	)
+
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"retry-failed",
+		"",
+		false,
+		"Only compile the packages which failed in the previous run",
+	)
+
+	viper.BindPFlags(buildPackagesCmd.PersistentFlags())
 }
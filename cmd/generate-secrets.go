@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagGenerateSecretsFile   string
+	flagGenerateSecretsFormat string
+	flagGenerateSecretsRotate bool
+)
+
+// generateSecretsCmd represents the secrets command
+var generateSecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Generates values for configuration variables with generators.",
+	Long: `
+Generates values for all configuration variables of the role manifest that have
+a generator:
+
+  Password        a random password (value type: password)
+  SSH             a RSA key pair (value types: private_key, public_key, fingerprint)
+  CACertificate   a self-signed CA (value types: certificate, private_key)
+  Certificate     a certificate signed by the CA (value types: certificate, private_key)
+
+Variables with the same generator id share the generated secret. The subject
+alternative names of certificates are the names of the services of their
+` + "`role_name`" + `, followed by their ` + "`subject_names`" + `. With more than one CA,
+certificates name the id of the CA signing them as their ` + "`ca`" + `.
+
+The values are written to ` + "`--secrets-file`" + `, either as an env file usable with
+` + "`fissile build kube --defaults-file`" + `, or as a Kubernetes secret. Values already in
+the file are kept, unless ` + "`--rotate`" + ` is given; certificates are regenerated
+whenever their CA is.
+
+Mark the variables with ` + "`secret: true`" + `, so that ` + "`fissile build kube`" + ` puts their
+values into the Kubernetes secret instead of the config map.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		flagGenerateSecretsFile = viper.GetString("secrets-file")
+		flagGenerateSecretsFormat = viper.GetString("secrets-format")
+		flagGenerateSecretsRotate = viper.GetBool("rotate")
+
+		if flagGenerateSecretsFile == "" {
+			return fmt.Errorf("--secrets-file is required")
+		}
+
+		err := fissile.LoadReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.GenerateSecrets(
+			flagRoleManifest,
+			flagGenerateSecretsFile,
+			flagGenerateSecretsFormat,
+			flagDeploymentName,
+			flagGenerateSecretsRotate,
+			flagReleaseBuild,
+		)
+	},
+}
+
+func init() {
+	generateCmd.AddCommand(generateSecretsCmd)
+
+	generateSecretsCmd.PersistentFlags().StringP(
+		"secrets-file",
+		"",
+		"",
+		"File the generated secrets are written to; existing values are read from it",
+	)
+
+	generateSecretsCmd.PersistentFlags().StringP(
+		"secrets-format",
+		"",
+		"env",
+		"Format of the secrets file, one of env or kube",
+	)
+
+	generateSecretsCmd.PersistentFlags().BoolP(
+		"rotate",
+		"",
+		false,
+		"Generate new values for all secrets, instead of keeping the existing ones",
+	)
+
+	viper.BindPFlags(generateSecretsCmd.PersistentFlags())
+}
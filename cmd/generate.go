@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// generateCmd represents the generate command
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Has subcommands to generate deployment artifacts.",
+}
+
+func init() {
+	RootCmd.AddCommand(generateCmd)
+}
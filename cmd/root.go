@@ -30,12 +30,20 @@ var (
 	flagOutputFormat   string
 	flagMetrics        string
 	flagReleaseBuild   bool
+	flagVerbose        bool
+	flagStemcellOS     string
+	flagOffline        bool
+	flagOfflineAssets  string
+	flagDeploymentName string
 
 	// workPath* variables contain paths derived from flagWorkDir
-	workPathCompilationDir string
-	workPathConfigDir      string
-	workPathBaseDockerfile string
-	workPathDockerDir      string
+	workPathCompilationDir        string
+	workPathCompilationJournalDir string
+	workPathConfigDir             string
+	workPathBaseDockerfile        string
+	workPathDockerDir             string
+	workPathJobSpecCacheDir       string
+	workPathVerifiedArchivesDir   string
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -43,7 +51,7 @@ var RootCmd = &cobra.Command{
 	Use:   "fissile",
 	Short: "The BOSH disintegrator",
 	Long: `
-Fissile converts existing BOSH dev releases into docker images.
+Fissile converts existing BOSH releases into docker images.
 
 It does this using just the releases, without a BOSH deployment, CPIs, or a BOSH 
 agent.
@@ -91,7 +99,7 @@ func init() {
 		"release",
 		"r",
 		"",
-		"Path to dev BOSH release(s).",
+		"Path to BOSH release(s): dev or final release directories, or release tarballs.",
 	)
 
 	// We can't use slices here because of https://github.com/spf13/viper/issues/112
@@ -99,7 +107,7 @@ func init() {
 		"release-name",
 		"n",
 		"",
-		"Name of a dev BOSH release; if empty, default configured dev release name will be used",
+		"Name of a BOSH release; if empty, default configured release name will be used",
 	)
 
 	// We can't use slices here because of https://github.com/spf13/viper/issues/112
@@ -107,7 +115,7 @@ func init() {
 		"release-version",
 		"v",
 		"",
-		"Version of a dev BOSH release; if empty, the latest dev release will be used",
+		"Version of a BOSH release; if empty, the latest release will be used",
 	)
 
 	RootCmd.PersistentFlags().StringP(
@@ -163,7 +171,7 @@ func init() {
 		"output",
 		"o",
 		"human",
-		"Choose output format, one of human, json, or yaml (currently only for 'show properties')",
+		"Choose output format, one of human, json, or yaml (currently only for 'show properties', 'show compilation', 'validate' and 'validate releases')",
 	)
 
 	RootCmd.PersistentFlags().BoolP(
@@ -173,6 +181,41 @@ func init() {
 		"Indicates final release build (all roles tagged as \"dev-only\" will be omitted)",
 	)
 
+	RootCmd.PersistentFlags().BoolP(
+		"verbose",
+		"",
+		false,
+		"Stream the output of package compilations and image builds, instead of only showing it on failure",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"stemcell-os",
+		"",
+		"ubuntu",
+		"OS of the compilation and stemcell layers, one of ubuntu or opensuse",
+	)
+
+	RootCmd.PersistentFlags().BoolP(
+		"offline",
+		"",
+		false,
+		"Build the compilation and stemcell layers without network access, from local or embedded assets",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"offline-assets",
+		"",
+		"",
+		"Path to a directory with the assets for offline builds; assets missing there are taken from the ones embedded into fissile",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"deployment-name",
+		"",
+		"",
+		"Name of the deployment, which the Kubernetes secret and config map are named after; defaults to the name of the first release",
+	)
+
 	viper.BindPFlags(RootCmd.PersistentFlags())
 }
 
@@ -203,11 +246,20 @@ func extendPathsFromWorkDirectory() {
 		return
 	}
 
-	// Initialize paths that are always relative to flagWorkDir
+	// Initialize paths that are always relative to flagWorkDir. Packages
+	// compiled for another stemcell OS, and their journal, are kept apart from
+	// the Ubuntu ones.
 	workPathCompilationDir = filepath.Join(workDir, "compilation")
+	workPathCompilationJournalDir = filepath.Join(workDir, "compilation-journal")
+	if flagStemcellOS != "" && flagStemcellOS != "ubuntu" {
+		workPathCompilationDir = filepath.Join(workDir, fmt.Sprintf("compilation-%s", flagStemcellOS))
+		workPathCompilationJournalDir = filepath.Join(workDir, fmt.Sprintf("compilation-journal-%s", flagStemcellOS))
+	}
 	workPathConfigDir = filepath.Join(workDir, "config")
 	workPathBaseDockerfile = filepath.Join(workDir, "base_dockerfile")
 	workPathDockerDir = filepath.Join(workDir, "dockerfiles")
+	workPathJobSpecCacheDir = filepath.Join(workDir, "job-specs")
+	workPathVerifiedArchivesDir = filepath.Join(workDir, "verified-archives")
 
 	// Set defaults for empty flags
 	if flagRoleManifest == "" {
@@ -239,6 +291,19 @@ func validateBasicFlags() error {
 	flagOutputFormat = viper.GetString("output")
 	flagMetrics = viper.GetString("metrics")
 	flagReleaseBuild = viper.GetBool("release-build")
+	flagVerbose = viper.GetBool("verbose")
+	flagStemcellOS = viper.GetString("stemcell-os")
+	flagOffline = viper.GetBool("offline")
+	flagOfflineAssets = viper.GetString("offline-assets")
+	flagDeploymentName = viper.GetString("deployment-name")
+
+	if err = fissile.SetStemcellOS(flagStemcellOS); err != nil {
+		return err
+	}
+
+	if err = fissile.SetWorkerCount(flagWorkers); err != nil {
+		return err
+	}
 
 	extendPathsFromWorkDirectory()
 
@@ -250,9 +315,12 @@ func validateBasicFlags() error {
 		&flagDarkOpinions,
 		&flagMetrics,
 		&workPathCompilationDir,
+		&workPathCompilationJournalDir,
 		&workPathConfigDir,
 		&workPathBaseDockerfile,
 		&workPathDockerDir,
+		&workPathJobSpecCacheDir,
+		&workPathVerifiedArchivesDir,
 	); err != nil {
 		return err
 	}
@@ -261,6 +329,18 @@ func validateBasicFlags() error {
 		return err
 	}
 
+	fissile.SetJobSpecCacheDir(workPathJobSpecCacheDir)
+	fissile.SetVerifiedArchivesDir(workPathVerifiedArchivesDir)
+
+	if flagOffline {
+		if flagOfflineAssets != "" {
+			if err = absolutePaths(&flagOfflineAssets); err != nil {
+				return err
+			}
+		}
+		fissile.SetOffline(flagOfflineAssets)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showCompilationCmd represents the compilation command
+var showCompilationCmd = &cobra.Command{
+	Use:   "compilation",
+	Short: "Displays the journal of the last package compilation.",
+	Long: `
+Displays the journal written by the most recent run of "fissile build packages".
+For each package it lists the release, fingerprint, status, duration and, for
+failed packages, the exit code and error. Packages still marked as pending were
+never finished, e.g. because the run was interrupted.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fissile.ShowCompilation(workPathCompilationJournalDir, flagOutputFormat)
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showCompilationCmd)
+}
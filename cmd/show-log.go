@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// showLogCmd represents the log command
+var showLogCmd = &cobra.Command{
+	Use:   "log <release>/<package> | <role>",
+	Short: "Displays the log of a package compilation or role image build.",
+	Long: `
+Displays the output of the latest compilation of a package (e.g. ` + "`fissile show log ntp/ntp-4.2.8p2`" + `),
+as written by "fissile build packages", or of the latest image build of a role
+(e.g. ` + "`fissile show log ntpd`" + `), as written by "fissile build images".
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("Expected exactly one argument, <release>/<package> or <role>")
+		}
+
+		err := fissile.LoadReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowLog(args[0], workPathCompilationDir, workPathDockerDir)
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showLogCmd)
+}
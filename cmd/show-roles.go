@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	flagShowRolesGraph bool
+)
+
+// showRolesCmd represents the roles command
+var showRolesCmd = &cobra.Command{
+	Use:   "roles",
+	Short: "Displays information about the roles of the role manifest.",
+	Long: `
+Lists the roles of the role manifest, with their type and flight stage.
+
+With --graph, the roles are listed in the order they can start in, with the
+roles they depend on (their depends-on list) coming first.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		flagShowRolesGraph = viper.GetBool("graph")
+
+		err := fissile.LoadReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.ListRoles(
+			flagRoleManifest,
+			flagShowRolesGraph,
+			flagReleaseBuild,
+		)
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showRolesCmd)
+
+	showRolesCmd.PersistentFlags().BoolP(
+		"graph",
+		"",
+		false,
+		"List the roles in the order of their dependencies",
+	)
+
+	viper.BindPFlags(showRolesCmd.PersistentFlags())
+}
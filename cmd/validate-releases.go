@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// validateReleasesCmd represents the releases command
+var validateReleasesCmd = &cobra.Command{
+	Use:   "releases",
+	Short: "Verifies the job and package archives of the releases.",
+	Long: `
+Verifies the archives of all jobs and packages of the referenced releases against
+the digests in the release manifests (plain SHA1, or the BOSH multi-digest format
+such as ` + "`sha256:...`" + `), and reports every archive that is missing from the
+cache directory or does not match, using ` + "`--workers`" + ` archives at a time.
+
+The commands loading releases verify the archives as well, but only fail on
+corrupt ones; missing package archives are only noticed during compilation.
+Unlike those, which skip archives they verified before until they change, this
+command hashes every archive.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fissile.ValidateReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+			flagOutputFormat,
+		)
+	},
+}
+
+func init() {
+	validateCmd.AddCommand(validateReleasesCmd)
+}
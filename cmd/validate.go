@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the role manifest for problems.",
+	Long: `
+Checks the role manifest against the referenced releases, and reports all problems
+found, each with the line of the manifest it was found on:
+
+  - jobs that are not part of their release, or releases that are not loaded
+  - role names used more than once
+  - invalid exposed ports (names, protocols, and port ranges)
+  - persistent and shared volumes without a tag or size
+  - scaling with a minimum greater than the maximum
+  - roles scaling to more than one pod without the clustered tag, whose jobs
+    need a bootstrap instance
+  - templates referencing variables that are not declared
+
+The build commands only fail on the problems that keep them from loading the
+manifest: unknown jobs and releases, invalid role types and flight stages, and
+broken dependencies and links. Validation reports all of them. Use
+` + "`--output json`" + ` to get a report suitable for CI; the command fails if there
+are any problems.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadReleases(
+			flagRelease,
+			flagReleaseName,
+			flagReleaseVersion,
+			flagCacheDir,
+		)
+		if err != nil {
+			return err
+		}
+
+		return fissile.ValidateRoleManifest(flagRoleManifest, flagOutputFormat)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/hpcloud/fissile/docker"
 	"github.com/hpcloud/fissile/model"
 	"github.com/hpcloud/fissile/scripts/compilation"
+	"github.com/hpcloud/fissile/scripts/offline"
 	"github.com/hpcloud/fissile/util"
 	"github.com/hpcloud/stampy"
 
@@ -23,6 +24,7 @@ import (
 	"github.com/hpcloud/termui"
 	workerLib "github.com/jimmysawczuk/worker"
 	"github.com/pborman/uuid"
+	"github.com/pivotal-golang/archiver/extractor"
 	"github.com/termie/go-shutil"
 )
 
@@ -65,6 +67,22 @@ type Compilator struct {
 	signalDependencies map[string]chan struct{}
 	keepContainer      bool
 	ui                 *termui.UI
+
+	// packageCache, if set, is consulted before compiling a package, and
+	// receives every package compiled successfully
+	packageCache PackageCache
+
+	// journalDir, if set, is where a journal of each compilation run is kept
+	journalDir string
+	// retryFingerprints, if set, restricts compilation to these packages
+	// (and whatever they need), see RetryFailed
+	retryFingerprints map[string]bool
+	// verbose streams the compilation output to the UI as it happens,
+	// instead of only showing it when compilation fails
+	verbose bool
+	// offlineAssets, if set, provide the packages installed into the
+	// compilation base image, instead of downloading them
+	offlineAssets offline.Assets
 }
 
 type compileJob struct {
@@ -103,11 +121,57 @@ func NewCompilator(
 	return compilator, nil
 }
 
+// SetPackageCache makes the compilator share compiled packages via the cache
+func (c *Compilator) SetPackageCache(cache PackageCache) {
+	c.packageCache = cache
+}
+
+// SetJournalDir makes the compilator keep a journal of each compilation run
+// in the given directory
+func (c *Compilator) SetJournalDir(journalDir string) {
+	c.journalDir = journalDir
+}
+
+// SetVerbose makes the compilator stream the output of all compilations
+func (c *Compilator) SetVerbose(verbose bool) {
+	c.verbose = verbose
+}
+
+// SetOfflineAssets makes the compilator build the compilation base image from
+// the given assets, without network access
+func (c *Compilator) SetOfflineAssets(assets offline.Assets) {
+	c.offlineAssets = assets
+}
+
+// RetryFailed restricts compilation to the packages which were not compiled
+// successfully in the run recorded by the journal. Leftovers of those runs
+// are removed before compiling again.
+func (c *Compilator) RetryFailed(journal *Journal) {
+	c.retryFingerprints = make(map[string]bool)
+	for _, entry := range journal.Unsuccessful() {
+		c.retryFingerprints[entry.Fingerprint] = true
+	}
+}
+
 var errWorkerAbort = errors.New("worker aborted")
 
+// compilationExitError is returned when the compilation script of a package
+// exits with a non-zero exit code
+type compilationExitError struct {
+	pkgName  string
+	exitCode int
+}
+
+func (e *compilationExitError) Error() string {
+	return fmt.Sprintf("Error - compilation for package %s exited with code %d", e.pkgName, e.exitCode)
+}
+
 type compileResult struct {
-	pkg *model.Package
-	err error
+	pkg       *model.Package
+	err       error
+	startTime time.Time
+	endTime   time.Time
+	logPath   string
 }
 
 // Compile concurrency works like this:
@@ -141,12 +205,28 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, roleMan
 	if err != nil {
 		return fmt.Errorf("failed to remove compiled packages: %v", err)
 	}
+
+	if c.retryFingerprints != nil {
+		packages = c.selectRetryPackages(packages)
+		if err := c.cleanStaleCompilations(packages); err != nil {
+			return err
+		}
+	}
+
 	if 0 == len(packages) {
 		c.ui.Println("No package needed to be built")
 		return nil
 	}
 	sort.Sort(packages)
 
+	var journal *Journal
+	if c.journalDir != "" {
+		journal = newJournal(c.journalDir, packages)
+		if err := journal.save(); err != nil {
+			return fmt.Errorf("Error writing compilation journal: %s", err.Error())
+		}
+	}
+
 	// Setup the queuing system ...
 	doneCh := make(chan compileResult)
 	killCh := make(chan struct{})
@@ -184,6 +264,13 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, roleMan
 
 	killed := false
 	for result := range doneCh {
+		if journal != nil {
+			journal.record(result)
+			if saveErr := journal.save(); saveErr != nil {
+				c.ui.Printf("%s\n", color.YellowString("Warning: could not update compilation journal: %s", saveErr.Error()))
+			}
+		}
+
 		if result.err == nil {
 			close(c.signalDependencies[result.pkg.Fingerprint])
 			c.ui.Printf("%s   > success: %s/%s\n",
@@ -208,9 +295,89 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, roleMan
 		}
 	}
 
+	if journal != nil {
+		journal.finish()
+		if saveErr := journal.save(); saveErr != nil && err == nil {
+			err = fmt.Errorf("Error writing compilation journal: %s", saveErr.Error())
+		}
+	}
+
 	return err
 }
 
+// selectRetryPackages picks the packages to retry out of the ones not yet
+// compiled. The dependencies of those packages that are not compiled yet are
+// retried as well, as the retried packages would wait for them forever
+// otherwise.
+func (c *Compilator) selectRetryPackages(packages model.Packages) model.Packages {
+	uncompiled := make(map[string]bool, len(packages))
+	for _, pkg := range packages {
+		uncompiled[pkg.Fingerprint] = true
+	}
+
+	selected := make(map[string]bool)
+	pending := list.New()
+	for _, pkg := range packages {
+		if c.retryFingerprints[pkg.Fingerprint] {
+			pending.PushBack(pkg)
+		}
+	}
+
+	for elem := pending.Front(); elem != nil; elem = elem.Next() {
+		pkg := elem.Value.(*model.Package)
+		if selected[pkg.Fingerprint] {
+			continue
+		}
+		selected[pkg.Fingerprint] = true
+		for _, dep := range pkg.Dependencies {
+			if uncompiled[dep.Fingerprint] {
+				pending.PushBack(dep)
+			}
+		}
+	}
+
+	var result model.Packages
+	for _, pkg := range packages {
+		if selected[pkg.Fingerprint] {
+			result = append(result, pkg)
+		} else {
+			// Nobody is going to wait for these
+			close(c.signalDependencies[pkg.Fingerprint])
+		}
+	}
+
+	return result
+}
+
+// cleanStaleCompilations removes what interrupted compilation runs left
+// behind: all compiled-temp directories, and the compilation containers of
+// the given packages
+func (c *Compilator) cleanStaleCompilations(packages model.Packages) error {
+	staleDirs, err := filepath.Glob(filepath.Join(c.hostWorkDir, "*", "compiled-temp"))
+	if err != nil {
+		return err
+	}
+
+	for _, staleDir := range staleDirs {
+		if err := os.RemoveAll(staleDir); err != nil {
+			return fmt.Errorf("Error removing stale compilation directory %s: %s", staleDir, err.Error())
+		}
+	}
+
+	if c.dockerManager == nil {
+		return nil
+	}
+
+	for _, pkg := range packages {
+		err := c.dockerManager.RemoveContainer(c.getPackageContainerName(pkg))
+		if _, notFound := err.(*dockerClient.NoSuchContainer); err != nil && !notFound {
+			return fmt.Errorf("Error removing stale compilation container for package %s: %s", pkg.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
 func (c *Compilator) gatherPackages(releases []*model.Release, roleManifest *model.RoleManifest) model.Packages {
 	var packages []*model.Package
 
@@ -302,7 +469,15 @@ func (j compileJob) Run() {
 		stampy.Stamp(c.metricsPath, "fissile", runSeriesName, "start")
 	}
 
+	startTime := time.Now()
 	workerErr := compilePackageHarness(c, j.pkg)
+	endTime := time.Now()
+
+	// Packages from compiled releases or the package cache have no log
+	logPath := j.pkg.GetPackageCompileLogPath(c.hostWorkDir)
+	if _, err := os.Stat(logPath); err != nil {
+		logPath = ""
+	}
 
 	if c.metricsPath != "" {
 		stampy.Stamp(c.metricsPath, "fissile", runSeriesName, "done")
@@ -312,7 +487,7 @@ func (j compileJob) Run() {
 		color.MagentaString(j.pkg.Release.Name),
 		color.MagentaString(j.pkg.Name))
 
-	j.doneCh <- compileResult{pkg: j.pkg, err: workerErr}
+	j.doneCh <- compileResult{pkg: j.pkg, err: workerErr, startTime: startTime, endTime: endTime, logPath: logPath}
 }
 
 func createDepBuckets(packages []*model.Package) []*model.Package {
@@ -464,6 +639,13 @@ func (c *Compilator) CreateCompilationBase(baseImageName string) (image *dockerC
 		return nil, fmt.Errorf("Error saving script asset: %s", err.Error())
 	}
 
+	// The prerequisites script installs the packages from here when present
+	if c.offlineAssets != nil {
+		if err = c.offlineAssets.SaveTo(filepath.Join(tempScriptDir, "offline")); err != nil {
+			return nil, err
+		}
+	}
+
 	// in-memory buffer of the log
 	log := new(bytes.Buffer)
 
@@ -536,6 +718,20 @@ func (c *Compilator) CreateCompilationBase(baseImageName string) (image *dockerC
 }
 
 func (c *Compilator) compilePackage(pkg *model.Package) (err error) {
+	// Packages from compiled releases only need to be unpacked
+	if pkg.IsPrecompiled() {
+		return c.extractPrecompiledPackage(pkg)
+	}
+
+	if c.packageCache != nil {
+		found, err := c.fetchCachedPackage(pkg)
+		if err != nil {
+			c.ui.Printf("%s\n", color.YellowString("Warning: could not fetch package %s from the package cache: %s", pkg.Name, err.Error()))
+		} else if found {
+			return nil
+		}
+	}
+
 	// Prepare input dir (package plus deps)
 	if err := c.createCompilationDirStructure(pkg); err != nil {
 		return err
@@ -562,21 +758,12 @@ func (c *Compilator) compilePackage(pkg *model.Package) (err error) {
 	// Run compilation in container
 	containerName := c.getPackageContainerName(pkg)
 
-	// in-memory buffer of the log
-	log := new(bytes.Buffer)
+	log, err := c.newCompilationLog(pkg)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
 
-	stdoutWriter := docker.NewFormattingWriter(
-		log,
-		func(line string) string {
-			return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.WhiteString("%s", line))
-		},
-	)
-	stderrWriter := docker.NewFormattingWriter(
-		log,
-		func(line string) string {
-			return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.RedString("%s", line))
-		},
-	)
 	sourceMountName := fmt.Sprintf("source_mount-%s", uuid.New())
 	mounts := map[string]string{
 		pkg.GetTargetPackageSourcesDir(c.hostWorkDir): docker.ContainerInPath,
@@ -594,8 +781,8 @@ func (c *Compilator) compilePackage(pkg *model.Package) (err error) {
 		Mounts:        mounts,
 		Volumes:       map[string]map[string]string{sourceMountName: nil},
 		KeepContainer: c.keepContainer,
-		StdoutWriter:  stdoutWriter,
-		StderrWriter:  stderrWriter,
+		StdoutWriter:  log.stdout,
+		StderrWriter:  log.stderr,
 	})
 
 	if container != nil && (!c.keepContainer || err == nil || exitCode == 0) {
@@ -626,18 +813,126 @@ func (c *Compilator) compilePackage(pkg *model.Package) (err error) {
 	}
 
 	if err != nil {
-		log.WriteTo(c.ui)
+		c.showCompilationLog(log)
 		return fmt.Errorf("Error compiling package %s: %s", pkg.Name, err.Error())
 	}
 
 	if exitCode != 0 {
-		log.WriteTo(c.ui)
-		return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, exitCode)
+		c.showCompilationLog(log)
+		return &compilationExitError{pkgName: pkg.Name, exitCode: exitCode}
 	}
 
-	return os.Rename(
+	err = os.Rename(
 		pkg.GetPackageCompiledTempDir(c.hostWorkDir),
 		pkg.GetPackageCompiledDir(c.hostWorkDir))
+	if err != nil {
+		return err
+	}
+
+	if c.packageCache != nil {
+		c.storeCachedPackage(pkg)
+	}
+
+	return nil
+}
+
+// compilationLog collects the output of a compilation container. The combined
+// output is always written to the log file on disk; the formatted output is
+// streamed to the UI in verbose mode, and otherwise kept in an in-memory
+// buffer to be shown on failure.
+type compilationLog struct {
+	path   string
+	file   *os.File
+	buffer *bytes.Buffer
+	stdout *docker.FormattingWriter
+	stderr *docker.FormattingWriter
+}
+
+// newCompilationLog creates the compilation log of a package
+func (c *Compilator) newCompilationLog(pkg *model.Package) (*compilationLog, error) {
+	log := &compilationLog{
+		path:   pkg.GetPackageCompileLogPath(c.hostWorkDir),
+		buffer: new(bytes.Buffer),
+	}
+
+	var err error
+	log.file, err = os.Create(log.path)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating compilation log for package %s: %s", pkg.Name, err.Error())
+	}
+
+	var terminal io.Writer = log.buffer
+	if c.verbose {
+		terminal = c.ui
+	}
+
+	log.stdout = docker.NewFormattingWriter(
+		io.MultiWriter(log.file, docker.NewFormattingWriter(
+			terminal,
+			func(line string) string {
+				return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.WhiteString("%s", line))
+			},
+		)),
+		nil,
+	)
+	log.stderr = docker.NewFormattingWriter(
+		io.MultiWriter(log.file, docker.NewFormattingWriter(
+			terminal,
+			func(line string) string {
+				return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.RedString("%s", line))
+			},
+		)),
+		nil,
+	)
+
+	return log, nil
+}
+
+// flush writes out the last lines of the output, which need not end with a
+// newline; closing the log more than once is fine
+func (l *compilationLog) flush() {
+	l.stdout.Close()
+	l.stderr.Close()
+}
+
+// Close flushes the output and closes the log file
+func (l *compilationLog) Close() error {
+	l.flush()
+	return l.file.Close()
+}
+
+// showCompilationLog writes the log of a failed compilation to the UI, unless
+// it was already streamed there. The output is flushed first, as its last
+// line is usually the error.
+func (c *Compilator) showCompilationLog(log *compilationLog) {
+	log.flush()
+	if !c.verbose {
+		log.buffer.WriteTo(c.ui)
+	}
+	c.ui.Printf("Compilation log: %s\n", color.YellowString(log.path))
+}
+
+// extractPrecompiledPackage unpacks a package from a compiled release into
+// the compiled package directory, without running any compilation container
+func (c *Compilator) extractPrecompiledPackage(pkg *model.Package) error {
+	compiledTempDir := pkg.GetPackageCompiledTempDir(c.hostWorkDir)
+
+	// Clear out leftovers from any earlier, interrupted attempt
+	if err := os.RemoveAll(compiledTempDir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(compiledTempDir, 0755); err != nil {
+		return err
+	}
+
+	if err := extractor.NewTgz().Extract(pkg.Path, compiledTempDir); err != nil {
+		return fmt.Errorf("Error extracting compiled package %s (stemcell %s): %s", pkg.Name, pkg.Stemcell, err.Error())
+	}
+
+	return os.Rename(
+		compiledTempDir,
+		pkg.GetPackageCompiledDir(c.hostWorkDir))
 }
 
 func (c *Compilator) isPackageCompiled(pkg *model.Package) (bool, error) {
@@ -757,7 +1052,7 @@ func (c *Compilator) copyDependencies(pkg *model.Package) error {
 
 // baseCompilationContainerName will return the compilation container's name
 func (c *Compilator) baseCompilationContainerName() string {
-	return util.SanitizeDockerName(fmt.Sprintf("%s-%s", c.baseCompilationImageRepository(), c.fissileVersion))
+	return util.SanitizeDockerName(fmt.Sprintf("%s-%s", c.baseCompilationImageRepository(), c.baseCompilationImageTag()))
 }
 
 func (c *Compilator) getPackageContainerName(pkg *model.Package) string {
@@ -770,9 +1065,10 @@ func (c *Compilator) getPackageContainerName(pkg *model.Package) string {
 	return util.SanitizeDockerName(fmt.Sprintf("%s-%s-%s-pkg-%s-gkp", c.baseCompilationContainerName(), pkg.Release.Name, pkg.Release.Version, pkg.Name))
 }
 
-// BaseCompilationImageTag will return the compilation image tag
+// BaseCompilationImageTag will return the compilation image tag; it includes
+// the stemcell OS, so that compilation images for different OSes can coexist
 func (c *Compilator) baseCompilationImageTag() string {
-	return util.SanitizeDockerName(fmt.Sprintf("%s", c.fissileVersion))
+	return util.SanitizeDockerName(fmt.Sprintf("%s-%s", c.fissileVersion, c.baseType))
 }
 
 // baseCompilationImageRepository will return the compilation image repository
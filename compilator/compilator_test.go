@@ -201,7 +201,7 @@ func TestCompilationRoleManifest(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	assert.NoError(err)
 	// This release has 3 packages:
 	// `tor` is in the role manifest, and will be included
@@ -276,7 +276,7 @@ func doTestContainerKeptAfterCompilationWithErrors(t *testing.T, keepContainer b
 
 	releasePath := filepath.Join(workDir, "../test-assets/corrupt-releases/corrupt-package")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	assert.NoError(err)
 
 	testRepository := fmt.Sprintf("fissile-test-compilator-%s", uuid.New())
@@ -405,7 +405,7 @@ func TestGetPackageStatusCompiled(t *testing.T) {
 	workDir, err := os.Getwd()
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	// For this test we assume that the release does not have multiple packages with a single fingerprint
 	assert.NoError(err)
 
@@ -521,7 +521,7 @@ func TestGetPackageStatusNone(t *testing.T) {
 	workDir, err := os.Getwd()
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	// For this test we assume that the release does not have multiple packages with a single fingerprint
 	assert.NoError(err)
 
@@ -547,7 +547,7 @@ func TestPackageFolderStructure(t *testing.T) {
 	workDir, err := os.Getwd()
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	compilator, err := NewCompilator(dockerManager, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, ui)
@@ -578,7 +578,7 @@ func TestPackageDependenciesPreparation(t *testing.T) {
 	workDir, err := os.Getwd()
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := model.NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := model.NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	compilator, err := NewCompilator(dockerManager, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, ui)
@@ -623,7 +623,7 @@ func doTestCompilePackage(t *testing.T, keepInContainer bool) {
 	workDir, err := os.Getwd()
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := model.NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	testRepository := fmt.Sprintf("fissile-test-compilator-%s", uuid.New())
@@ -649,6 +649,79 @@ func doTestCompilePackage(t *testing.T, keepInContainer bool) {
 	assert.Equal(beforeCompileContainers, afterCompileContainers)
 }
 
+func TestCompilePrecompiledPackage(t *testing.T) {
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2-compiled.tgz")
+	release, err := model.NewReleaseFromTarball(tarballPath, "", "", filepath.Join(compilationWorkDir, "releases"), nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// No docker manager is needed; nothing is compiled in a container
+	comp, err := NewCompilator(nil, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, ui)
+	assert.NoError(err)
+
+	pkg := release.Packages[0]
+	err = comp.compilePackage(pkg)
+	assert.NoError(err)
+
+	compiled, err := comp.isPackageCompiled(pkg)
+	assert.NoError(err)
+	assert.True(compiled)
+
+	exists, err := validatePath(filepath.Join(pkg.GetPackageCompiledDir(compilationWorkDir), "bin", "ntpd"), false, "")
+	assert.NoError(err)
+	assert.True(exists)
+
+	exists, err = validatePath(pkg.GetPackageCompiledTempDir(compilationWorkDir), true, "")
+	assert.NoError(err)
+	assert.False(exists)
+}
+
+func TestShowCompilationLog(t *testing.T) {
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	output := &bytes.Buffer{}
+	comp, err := NewCompilator(nil, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, termui.New(&bytes.Buffer{}, output, nil))
+	assert.NoError(err)
+
+	pkg := &model.Package{Name: "failing", Fingerprint: "failing-fingerprint"}
+	if !assert.NoError(os.MkdirAll(filepath.Join(compilationWorkDir, pkg.Fingerprint), 0755)) {
+		return
+	}
+
+	log, err := comp.newCompilationLog(pkg)
+	if !assert.NoError(err) {
+		return
+	}
+	defer log.Close()
+
+	// The output of a failing compilation often ends without a newline
+	log.stdout.Write([]byte("configuring\n"))
+	log.stderr.Write([]byte("error: no compiler found"))
+
+	comp.showCompilationLog(log)
+	assert.Contains(output.String(), "configuring")
+	assert.Contains(output.String(), "error: no compiler found")
+	assert.Contains(output.String(), log.path)
+
+	contents, err := ioutil.ReadFile(log.path)
+	if assert.NoError(err) {
+		assert.Equal("configuring\nerror: no compiler found\n", string(contents))
+	}
+}
+
 func TestCreateDepBuckets(t *testing.T) {
 	t.Parallel()
 
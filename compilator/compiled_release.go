@@ -0,0 +1,303 @@
+package compilator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+	"github.com/hpcloud/fissile/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// compiledReleaseManifest is the release.MF of a BOSH compiled release
+type compiledReleaseManifest struct {
+	Name               string                   `yaml:"name"`
+	Version            string                   `yaml:"version"`
+	CommitHash         string                   `yaml:"commit_hash"`
+	UncommittedChanges bool                     `yaml:"uncommitted_changes"`
+	Jobs               []compiledReleaseJob     `yaml:"jobs"`
+	CompiledPackages   []compiledReleasePackage `yaml:"compiled_packages"`
+}
+
+type compiledReleaseJob struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Fingerprint string `yaml:"fingerprint"`
+	SHA1        string `yaml:"sha1"`
+}
+
+type compiledReleasePackage struct {
+	Name         string   `yaml:"name"`
+	Version      string   `yaml:"version"`
+	Fingerprint  string   `yaml:"fingerprint"`
+	SHA1         string   `yaml:"sha1"`
+	Stemcell     string   `yaml:"stemcell"`
+	Dependencies []string `yaml:"dependencies"`
+}
+
+// ExportCompiledRelease writes a BOSH compiled release tarball for the given
+// release into outputDir, and returns the path of the tarball. Only the jobs
+// used by the role manifest (and the packages they need) are exported; all of
+// those packages must have been compiled already. The stemcell is given as
+// <os>/<version>, e.g. ubuntu-trusty/3421.11.
+func (c *Compilator) ExportCompiledRelease(release *model.Release, roleManifest *model.RoleManifest, stemcell, outputDir string) (string, error) {
+	stemcellParts := strings.Split(stemcell, "/")
+	if len(stemcellParts) != 2 || stemcellParts[0] == "" || stemcellParts[1] == "" {
+		return "", fmt.Errorf("Invalid stemcell '%s', expected <os>/<version>", stemcell)
+	}
+
+	jobs, packages := c.gatherCompiledReleaseContents(release, roleManifest)
+
+	var missing []string
+	for _, pkg := range packages {
+		compiled, err := c.isPackageCompiled(pkg)
+		if err != nil {
+			return "", err
+		}
+		if !compiled {
+			missing = append(missing, fmt.Sprintf("%s/%s", release.Name, pkg.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("Packages have not been compiled yet: %s", strings.Join(missing, ", "))
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+
+	tempDir, err := util.TempDir(outputDir, "fissile-compiled-release")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifest := compiledReleaseManifest{
+		Name:               release.Name,
+		Version:            release.Version,
+		CommitHash:         release.CommitHash,
+		UncommittedChanges: release.UncommittedChanges,
+	}
+
+	for _, job := range jobs {
+		manifest.Jobs = append(manifest.Jobs, compiledReleaseJob{
+			Name:        job.Name,
+			Version:     job.Version,
+			Fingerprint: job.Fingerprint,
+			SHA1:        job.SHA1,
+		})
+	}
+
+	// The compiled packages are archived up front, since their SHA1s are
+	// needed for the release manifest
+	for _, pkg := range packages {
+		archivePath := filepath.Join(tempDir, fmt.Sprintf("%s.tgz", pkg.Name))
+		archiveSHA1, err := writeCompiledPackageArchive(pkg.GetPackageCompiledDir(c.hostWorkDir), archivePath)
+		if err != nil {
+			return "", fmt.Errorf("Error archiving compiled package %s: %s", pkg.Name, err.Error())
+		}
+
+		dependencies := []string{}
+		for _, dep := range pkg.Dependencies {
+			dependencies = append(dependencies, dep.Name)
+		}
+		sort.Strings(dependencies)
+
+		manifest.CompiledPackages = append(manifest.CompiledPackages, compiledReleasePackage{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Fingerprint:  pkg.Fingerprint,
+			SHA1:         archiveSHA1,
+			Stemcell:     stemcell,
+			Dependencies: dependencies,
+		})
+	}
+
+	manifestContents, err := yaml.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("Error generating release manifest: %s", err.Error())
+	}
+
+	tarballName := fmt.Sprintf("%s-%s-%s-%s.tgz", release.Name, release.Version, stemcellParts[0], stemcellParts[1])
+	tarballTempPath := filepath.Join(tempDir, tarballName)
+	tarballFile, err := os.Create(tarballTempPath)
+	if err != nil {
+		return "", err
+	}
+	defer tarballFile.Close()
+
+	gzipWriter := gzip.NewWriter(tarballFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = util.WriteToTarStream(tarWriter, manifestContents, tar.Header{
+		Name: "./release.MF",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, job := range jobs {
+		if err := addFileToTarStream(tarWriter, job.Path, fmt.Sprintf("./jobs/%s.tgz", job.Name)); err != nil {
+			return "", fmt.Errorf("Error adding job %s: %s", job.Name, err.Error())
+		}
+	}
+
+	for _, pkg := range packages {
+		archivePath := filepath.Join(tempDir, fmt.Sprintf("%s.tgz", pkg.Name))
+		if err := addFileToTarStream(tarWriter, archivePath, fmt.Sprintf("./compiled_packages/%s.tgz", pkg.Name)); err != nil {
+			return "", fmt.Errorf("Error adding compiled package %s: %s", pkg.Name, err.Error())
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := tarballFile.Close(); err != nil {
+		return "", err
+	}
+
+	tarballPath := filepath.Join(outputDir, tarballName)
+	if err := os.Rename(tarballTempPath, tarballPath); err != nil {
+		return "", err
+	}
+
+	return tarballPath, nil
+}
+
+// gatherCompiledReleaseContents returns the jobs and packages of the release
+// that go into a compiled release, sorted by name. Without a role manifest,
+// the whole release is used.
+func (c *Compilator) gatherCompiledReleaseContents(release *model.Release, roleManifest *model.RoleManifest) (model.Jobs, model.Packages) {
+	if roleManifest == nil {
+		jobs := append(model.Jobs{}, release.Jobs...)
+		packages := append(model.Packages{}, release.Packages...)
+		sort.Sort(jobs)
+		sort.Sort(packages)
+		return jobs, packages
+	}
+
+	var jobs model.Jobs
+	listedJobs := make(map[string]bool)
+	for _, role := range roleManifest.Roles {
+		for _, job := range role.Jobs {
+			if job.Release.Name == release.Name && !listedJobs[job.Name] {
+				jobs = append(jobs, job)
+				listedJobs[job.Name] = true
+			}
+		}
+	}
+	sort.Sort(jobs)
+
+	packages := model.Packages(c.gatherPackagesFromManifest(release, roleManifest))
+	sort.Sort(packages)
+
+	return jobs, packages
+}
+
+// writeCompiledPackageArchive creates a gzipped tarball of the contents of a
+// compiled package directory, and returns its SHA1
+func writeCompiledPackageArchive(compiledDir, archivePath string) (string, error) {
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer archiveFile.Close()
+
+	h := sha1.New()
+	gzipWriter := gzip.NewWriter(io.MultiWriter(archiveFile, h))
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = filepath.Walk(compiledDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(compiledDir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		if (info.Mode() & os.ModeSymlink) != 0 {
+			header.Linkname, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		header.Name = "./" + filepath.ToSlash(relPath)
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.CopyN(tarWriter, file, info.Size())
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// addFileToTarStream copies a file on disk into the tar stream under the given name
+func addFileToTarStream(tarWriter *tar.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tarWriter, file, info.Size())
+	return err
+}
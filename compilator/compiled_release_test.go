@@ -0,0 +1,82 @@
+package compilator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+	"github.com/hpcloud/fissile/scripts/compilation"
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCompiledRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2.tgz")
+	release, err := model.NewReleaseFromTarball(tarballPath, "", "", filepath.Join(compilationWorkDir, "releases"), nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	comp, err := NewCompilator(nil, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, ui)
+	assert.NoError(err)
+
+	outputDir := filepath.Join(compilationWorkDir, "output")
+
+	_, err = comp.ExportCompiledRelease(release, nil, "ubuntu-trusty/3421.11", outputDir)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Packages have not been compiled yet: ntp/ntp-4.2.8p2")
+	}
+
+	pkg := release.Packages[0]
+	compiledBinDir := filepath.Join(pkg.GetPackageCompiledDir(compilationWorkDir), "bin")
+	assert.NoError(os.MkdirAll(compiledBinDir, 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(compiledBinDir, "ntpd"), []byte("ntpd"), 0755))
+
+	_, err = comp.ExportCompiledRelease(release, nil, "ubuntu-trusty", outputDir)
+	assert.EqualError(err, "Invalid stemcell 'ubuntu-trusty', expected <os>/<version>")
+
+	compiledTarballPath, err := comp.ExportCompiledRelease(release, nil, "ubuntu-trusty/3421.11", outputDir)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(filepath.Join(outputDir, "ntp-2-ubuntu-trusty-3421.11.tgz"), compiledTarballPath)
+
+	compiledRelease, err := model.NewReleaseFromTarball(compiledTarballPath, "ntp", "2", filepath.Join(compilationWorkDir, "releases"), nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.True(compiledRelease.IsCompiled())
+	assert.Len(compiledRelease.Jobs, 1)
+	assert.Equal(release.Jobs[0].SHA1, compiledRelease.Jobs[0].SHA1)
+	assert.NoError(compiledRelease.Jobs[0].ValidateSHA1())
+
+	if assert.Len(compiledRelease.Packages, 1) {
+		compiledPkg := compiledRelease.Packages[0]
+		assert.Equal(pkg.Fingerprint, compiledPkg.Fingerprint)
+		assert.Equal("ubuntu-trusty/3421.11", compiledPkg.Stemcell)
+		assert.True(compiledPkg.IsPrecompiled())
+		assert.NoError(compiledPkg.ValidateSHA1())
+
+		extractDir, err := util.TempDir("", "fissile-tests")
+		assert.NoError(err)
+		defer os.RemoveAll(extractDir)
+
+		extractedPath, err := compiledPkg.Extract(extractDir)
+		assert.NoError(err)
+		contents, err := ioutil.ReadFile(filepath.Join(extractedPath, "bin", "ntpd"))
+		assert.NoError(err)
+		assert.Equal("ntpd", string(contents))
+	}
+}
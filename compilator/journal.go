@@ -0,0 +1,183 @@
+package compilator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/hpcloud/fissile/model"
+)
+
+// JournalStatus is the state of a package in a compilation journal
+type JournalStatus string
+
+// These are the states a package goes through during a compilation run
+const (
+	JournalStatusPending   = JournalStatus("pending")   // Queued, but no result yet
+	JournalStatusSucceeded = JournalStatus("succeeded") // Compiled successfully
+	JournalStatusFailed    = JournalStatus("failed")    // Compilation failed
+	JournalStatusAborted   = JournalStatus("aborted")   // Not compiled because another package failed
+)
+
+// journalTimeFormat is used for the journal file names; it sorts
+// chronologically
+const journalTimeFormat = "20060102-150405.000000000"
+
+// JournalEntry records the compilation of a single package
+type JournalEntry struct {
+	Release     string        `json:"release" yaml:"release"`
+	Package     string        `json:"package" yaml:"package"`
+	Fingerprint string        `json:"fingerprint" yaml:"fingerprint"`
+	Status      JournalStatus `json:"status" yaml:"status"`
+	StartTime   *time.Time    `json:"start_time,omitempty" yaml:"start_time,omitempty"`
+	EndTime     *time.Time    `json:"end_time,omitempty" yaml:"end_time,omitempty"`
+	// ExitCode is the exit code of the compilation script; it is -1 if the
+	// script did not run to completion
+	ExitCode int    `json:"exit_code" yaml:"exit_code"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+	LogPath  string `json:"log_path,omitempty" yaml:"log_path,omitempty"`
+}
+
+// Journal records a run of Compile, including the runs which get
+// interrupted, so that failures can be inspected and retried later
+type Journal struct {
+	StartTime time.Time       `json:"start_time" yaml:"start_time"`
+	EndTime   *time.Time      `json:"end_time,omitempty" yaml:"end_time,omitempty"`
+	Packages  []*JournalEntry `json:"packages" yaml:"packages"`
+
+	path string
+}
+
+// newJournal creates the journal for a run compiling the given packages
+func newJournal(journalDir string, packages model.Packages) *Journal {
+	startTime := time.Now().UTC()
+
+	journal := &Journal{
+		StartTime: startTime,
+		path:      filepath.Join(journalDir, fmt.Sprintf("%s.json", startTime.Format(journalTimeFormat))),
+	}
+
+	for _, pkg := range packages {
+		journal.Packages = append(journal.Packages, &JournalEntry{
+			Release:     pkg.Release.Name,
+			Package:     pkg.Name,
+			Fingerprint: pkg.Fingerprint,
+			Status:      JournalStatusPending,
+			ExitCode:    -1,
+		})
+	}
+
+	return journal
+}
+
+// LoadLatestJournal loads the journal of the most recent compilation run
+// from the journal directory; it returns nil if there is none
+func LoadLatestJournal(journalDir string) (*Journal, error) {
+	journalPaths, err := filepath.Glob(filepath.Join(journalDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(journalPaths) == 0 {
+		return nil, nil
+	}
+
+	sort.Strings(journalPaths)
+	journalPath := journalPaths[len(journalPaths)-1]
+
+	contents, err := ioutil.ReadFile(journalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := &Journal{path: journalPath}
+	if err := json.Unmarshal(contents, journal); err != nil {
+		return nil, fmt.Errorf("Error loading compilation journal %s: %s", journalPath, err.Error())
+	}
+
+	return journal, nil
+}
+
+// Path returns the location of the journal on disk
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Unsuccessful returns the entries of all packages that were not compiled
+// successfully, including those that never finished
+func (j *Journal) Unsuccessful() []*JournalEntry {
+	var entries []*JournalEntry
+	for _, entry := range j.Packages {
+		if entry.Status != JournalStatusSucceeded {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// record updates the journal with the result of compiling a package
+func (j *Journal) record(result compileResult) {
+	for _, entry := range j.Packages {
+		if entry.Fingerprint != result.pkg.Fingerprint {
+			continue
+		}
+
+		if !result.startTime.IsZero() {
+			startTime := result.startTime.UTC()
+			endTime := result.endTime.UTC()
+			entry.StartTime = &startTime
+			entry.EndTime = &endTime
+		}
+		entry.LogPath = result.logPath
+
+		switch err := result.err.(type) {
+		case nil:
+			entry.Status = JournalStatusSucceeded
+			entry.ExitCode = 0
+		case *compilationExitError:
+			entry.Status = JournalStatusFailed
+			entry.ExitCode = err.exitCode
+			entry.Error = err.Error()
+		default:
+			if err == errWorkerAbort {
+				entry.Status = JournalStatusAborted
+			} else {
+				entry.Status = JournalStatusFailed
+			}
+			entry.Error = err.Error()
+		}
+
+		return
+	}
+}
+
+// finish marks the end of the compilation run
+func (j *Journal) finish() {
+	endTime := time.Now().UTC()
+	j.EndTime = &endTime
+}
+
+// save writes the journal to disk; the old contents are replaced atomically,
+// so that an interrupted run always leaves a readable journal behind
+func (j *Journal) save() error {
+	contents, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+
+	tempPath := j.path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, contents, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, j.path)
+}
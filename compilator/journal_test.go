@@ -0,0 +1,110 @@
+package compilator
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilationJournalAndRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(workDir)
+
+	compilationDir := filepath.Join(workDir, "compilation")
+	journalDir := filepath.Join(workDir, "compilation-journal")
+
+	saveCompilePackage := compilePackageHarness
+	defer func() {
+		compilePackageHarness = saveCompilePackage
+	}()
+
+	var lock sync.Mutex
+	var compiled []string
+	compilePackageHarness = func(c *Compilator, pkg *model.Package) error {
+		lock.Lock()
+		defer lock.Unlock()
+		compiled = append(compiled, pkg.Name)
+		if pkg.Name == "go-1.4" {
+			return &compilationExitError{pkgName: pkg.Name, exitCode: 2}
+		}
+		return nil
+	}
+
+	journal, err := LoadLatestJournal(journalDir)
+	assert.NoError(err)
+	assert.Nil(journal)
+
+	c, err := NewCompilator(nil, compilationDir, "", "", "", "", false, ui)
+	assert.NoError(err)
+	c.SetJournalDir(journalDir)
+
+	err = c.Compile(1, genTestCase("ruby-2.5", "consul>go-1.4", "go-1.4"), nil)
+	assert.Error(err)
+
+	journal, err = LoadLatestJournal(journalDir)
+	if !assert.NoError(err) || !assert.NotNil(journal) {
+		return
+	}
+	assert.NotNil(journal.EndTime)
+
+	entries := make(map[string]*JournalEntry)
+	for _, entry := range journal.Packages {
+		entries[entry.Package] = entry
+	}
+	if assert.Len(entries, 3) {
+		assert.Equal(JournalStatusSucceeded, entries["ruby-2.5"].Status)
+		assert.Equal(0, entries["ruby-2.5"].ExitCode)
+		assert.NotNil(entries["ruby-2.5"].StartTime)
+
+		assert.Equal(JournalStatusFailed, entries["go-1.4"].Status)
+		assert.Equal(2, entries["go-1.4"].ExitCode)
+		assert.Equal("test-release", entries["go-1.4"].Release)
+
+		assert.NotEqual(JournalStatusSucceeded, entries["consul"].Status)
+		assert.Equal(-1, entries["consul"].ExitCode)
+	}
+	assert.Len(journal.Unsuccessful(), 2)
+
+	// Retry, with leftovers of an interrupted compilation lying around
+	staleDir := filepath.Join(compilationDir, "go-1.4", "compiled-temp")
+	assert.NoError(os.MkdirAll(staleDir, 0755))
+
+	compiled = nil
+	compilePackageHarness = func(c *Compilator, pkg *model.Package) error {
+		lock.Lock()
+		defer lock.Unlock()
+		compiled = append(compiled, pkg.Name)
+		return nil
+	}
+
+	c, err = NewCompilator(nil, compilationDir, "", "", "", "", false, ui)
+	assert.NoError(err)
+	c.SetJournalDir(journalDir)
+	c.RetryFailed(journal)
+
+	err = c.Compile(1, genTestCase("ruby-2.5", "consul>go-1.4", "go-1.4"), nil)
+	assert.NoError(err)
+
+	sort.Strings(compiled)
+	assert.Equal([]string{"consul", "go-1.4"}, compiled)
+
+	_, err = os.Stat(staleDir)
+	assert.True(os.IsNotExist(err))
+
+	retryJournal, err := LoadLatestJournal(journalDir)
+	if assert.NoError(err) && assert.NotNil(retryJournal) {
+		assert.NotEqual(journal.Path(), retryJournal.Path())
+		assert.Len(retryJournal.Packages, 2)
+		assert.Empty(retryJournal.Unsuccessful())
+	}
+}
@@ -0,0 +1,327 @@
+package compilator
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hpcloud/fissile/model"
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/fatih/color"
+	"github.com/pivotal-golang/archiver/extractor"
+)
+
+// PackageCache is a store for compiled packages that can be shared between
+// hosts, so that a package only needs to be compiled once. Entries are
+// addressed by a key derived from the package fingerprint and the
+// compilation base image; see PackageCacheKey.
+type PackageCache interface {
+	// Fetch extracts the cached compiled package into destDir, and returns
+	// false if the cache has no entry for the key
+	Fetch(key, destDir string) (bool, error)
+	// Store adds the compiled package found in srcDir to the cache
+	Store(key, srcDir string) error
+}
+
+// PackageCacheKey returns the key under which a package compiled in the
+// given compilation base image is cached
+func PackageCacheKey(pkg *model.Package, baseImageName string) string {
+	return fmt.Sprintf("%s-%x", pkg.Fingerprint, sha1.Sum([]byte(baseImageName)))
+}
+
+// NewPackageCache creates the package cache for the given location: URLs
+// using http or https get a cache on an (S3-compatible) HTTP server, anything
+// else is taken as a directory on a (possibly shared) filesystem. The
+// credentials are only used for HTTP caches, and may be empty.
+func NewPackageCache(location, accessKey, secretKey, region string) (PackageCache, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return NewHTTPPackageCache(location, accessKey, secretKey, region)
+	}
+
+	return NewFilesystemPackageCache(strings.TrimPrefix(location, "file://"))
+}
+
+func (c *Compilator) fetchCachedPackage(pkg *model.Package) (bool, error) {
+	compiledTempDir := pkg.GetPackageCompiledTempDir(c.hostWorkDir)
+
+	if err := os.RemoveAll(compiledTempDir); err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(compiledTempDir, 0755); err != nil {
+		return false, err
+	}
+
+	found, err := c.packageCache.Fetch(PackageCacheKey(pkg, c.BaseImageName()), compiledTempDir)
+	if err != nil || !found {
+		os.RemoveAll(compiledTempDir)
+		return false, err
+	}
+
+	if err := os.Rename(compiledTempDir, pkg.GetPackageCompiledDir(c.hostWorkDir)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Compilator) storeCachedPackage(pkg *model.Package) {
+	err := c.packageCache.Store(PackageCacheKey(pkg, c.BaseImageName()), pkg.GetPackageCompiledDir(c.hostWorkDir))
+	if err != nil {
+		c.ui.Printf("%s\n", color.YellowString("Warning: could not add package %s to the package cache: %s", pkg.Name, err.Error()))
+	}
+}
+
+// filesystemPackageCache keeps compiled packages as tarballs in a directory
+type filesystemPackageCache struct {
+	dir string
+}
+
+// NewFilesystemPackageCache creates a package cache in a directory, which
+// may be shared between hosts (e.g. via NFS)
+func NewFilesystemPackageCache(dir string) (PackageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating package cache directory %s: %s", dir, err.Error())
+	}
+
+	return &filesystemPackageCache{dir: dir}, nil
+}
+
+func (f *filesystemPackageCache) Fetch(key, destDir string) (bool, error) {
+	archivePath := filepath.Join(f.dir, fmt.Sprintf("%s.tgz", key))
+
+	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := extractor.NewTgz().Extract(archivePath, destDir); err != nil {
+		return false, fmt.Errorf("Error extracting cached package %s: %s", archivePath, err.Error())
+	}
+
+	return true, nil
+}
+
+func (f *filesystemPackageCache) Store(key, srcDir string) error {
+	// Write to a temporary file first, so other hosts never see a partial
+	// archive
+	archiveFile, err := ioutil.TempFile(f.dir, fmt.Sprintf(".%s-", key))
+	if err != nil {
+		return err
+	}
+	archiveFile.Close()
+	defer os.Remove(archiveFile.Name())
+
+	if _, err := writeCompiledPackageArchive(srcDir, archiveFile.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(archiveFile.Name(), filepath.Join(f.dir, fmt.Sprintf("%s.tgz", key)))
+}
+
+// httpPackageCache keeps compiled packages as objects on an HTTP server,
+// such as an S3 bucket; requests are signed (AWS signature version 4) when
+// an access key is given
+type httpPackageCache struct {
+	baseURL   *url.URL
+	accessKey string
+	secretKey string
+	region    string
+	client    *http.Client
+}
+
+// NewHTTPPackageCache creates a package cache storing objects underneath the
+// base URL (for S3, the URL of the bucket, with an optional prefix)
+func NewHTTPPackageCache(baseURL, accessKey, secretKey, region string) (PackageCache, error) {
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing package cache URL %s: %s", baseURL, err.Error())
+	}
+
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &httpPackageCache{
+		baseURL:   parsedURL,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		region:    region,
+		client:    http.DefaultClient,
+	}, nil
+}
+
+func (h *httpPackageCache) objectURL(key string) *url.URL {
+	objectURL := *h.baseURL
+	objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + fmt.Sprintf("/%s.tgz", key)
+	return &objectURL
+}
+
+func (h *httpPackageCache) Fetch(key, destDir string) (bool, error) {
+	request, err := http.NewRequest("GET", h.objectURL(key).String(), nil)
+	if err != nil {
+		return false, err
+	}
+	h.sign(request, emptyPayloadSHA256)
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Error fetching %s from package cache: %s", request.URL.Path, response.Status)
+	}
+
+	archiveFile, err := ioutil.TempFile("", "fissile-package-cache")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(archiveFile.Name())
+
+	_, err = io.Copy(archiveFile, response.Body)
+	archiveFile.Close()
+	if err != nil {
+		return false, fmt.Errorf("Error downloading %s from package cache: %s", request.URL.Path, err.Error())
+	}
+
+	if err := extractor.NewTgz().Extract(archiveFile.Name(), destDir); err != nil {
+		return false, fmt.Errorf("Error extracting cached package %s: %s", request.URL.Path, err.Error())
+	}
+
+	return true, nil
+}
+
+func (h *httpPackageCache) Store(key, srcDir string) error {
+	tempDir, err := util.TempDir("", "fissile-package-cache")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, fmt.Sprintf("%s.tgz", key))
+	if _, err := writeCompiledPackageArchive(srcDir, archivePath); err != nil {
+		return err
+	}
+
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+
+	payloadHash := sha256.New()
+	size, err := io.Copy(payloadHash, archiveFile)
+	if err != nil {
+		return err
+	}
+	if _, err := archiveFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("PUT", h.objectURL(key).String(), archiveFile)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", "application/gzip")
+	h.sign(request, hex.EncodeToString(payloadHash.Sum(nil)))
+
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("Error uploading %s to package cache: %s", request.URL.Path, response.Status)
+	}
+
+	return nil
+}
+
+// emptyPayloadSHA256 is the hex SHA256 of an empty request body
+const emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds an AWS signature version 4 authorization header to the request;
+// it does nothing for anonymous access
+func (h *httpPackageCache) sign(request *http.Request, payloadSHA256 string) {
+	if h.accessKey == "" {
+		return
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadSHA256)
+
+	headers := map[string]string{
+		"host":                 request.URL.Host,
+		"x-amz-content-sha256": payloadSHA256,
+		"x-amz-date":           amzDate,
+	}
+	var headerNames []string
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders string
+	for _, name := range headerNames {
+		canonicalHeaders += fmt.Sprintf("%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		payloadSHA256,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, h.region)
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+h.secretKey), date)
+	signingKey = hmacSHA256(signingKey, h.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		h.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
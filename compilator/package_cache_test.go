@@ -0,0 +1,194 @@
+package compilator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+	"github.com/hpcloud/fissile/scripts/compilation"
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeObjectStore is a minimal stand-in for an S3-compatible server
+type fakeObjectStore struct {
+	sync.Mutex
+	objects        map[string][]byte
+	authorizations []string
+}
+
+func (s *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.authorizations = append(s.authorizations, r.Header.Get("Authorization"))
+
+	switch r.Method {
+	case "GET":
+		contents, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(contents)
+	case "PUT":
+		contents, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.objects[r.URL.Path] = contents
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeFakeCompiledPackage(assert *assert.Assertions, dir string) {
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "bin", "ntpd"), []byte("ntpd"), 0755))
+}
+
+func assertPackageCacheRoundTrip(assert *assert.Assertions, cache PackageCache) {
+	tempDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(tempDir)
+
+	found, err := cache.Fetch("some-key", filepath.Join(tempDir, "missing"))
+	assert.NoError(err)
+	assert.False(found)
+
+	srcDir := filepath.Join(tempDir, "src")
+	writeFakeCompiledPackage(assert, srcDir)
+	assert.NoError(cache.Store("some-key", srcDir))
+
+	destDir := filepath.Join(tempDir, "dest")
+	assert.NoError(os.MkdirAll(destDir, 0755))
+	found, err = cache.Fetch("some-key", destDir)
+	assert.NoError(err)
+	assert.True(found)
+
+	contents, err := ioutil.ReadFile(filepath.Join(destDir, "bin", "ntpd"))
+	assert.NoError(err)
+	assert.Equal("ntpd", string(contents))
+}
+
+func TestPackageCacheKey(t *testing.T) {
+	assert := assert.New(t)
+
+	pkg := &model.Package{Fingerprint: "abc"}
+	key := PackageCacheKey(pkg, "fissile-cbase:1.0")
+
+	assert.True(strings.HasPrefix(key, "abc-"))
+	assert.Equal(key, PackageCacheKey(pkg, "fissile-cbase:1.0"))
+	assert.NotEqual(key, PackageCacheKey(pkg, "fissile-cbase:2.0"))
+}
+
+func TestFilesystemPackageCache(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := NewPackageCache(cacheDir, "", "", "")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.IsType(&filesystemPackageCache{}, cache)
+
+	assertPackageCacheRoundTrip(assert, cache)
+
+	_, err = os.Stat(filepath.Join(cacheDir, "some-key.tgz"))
+	assert.NoError(err)
+}
+
+func TestHTTPPackageCache(t *testing.T) {
+	assert := assert.New(t)
+
+	store := &fakeObjectStore{objects: make(map[string][]byte)}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	cache, err := NewPackageCache(server.URL+"/bucket/prefix/", "", "", "")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.IsType(&httpPackageCache{}, cache)
+
+	assertPackageCacheRoundTrip(assert, cache)
+
+	_, ok := store.objects["/bucket/prefix/some-key.tgz"]
+	assert.True(ok)
+	for _, authorization := range store.authorizations {
+		assert.Empty(authorization)
+	}
+}
+
+func TestHTTPPackageCacheSignsRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	store := &fakeObjectStore{objects: make(map[string][]byte)}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	cache, err := NewHTTPPackageCache(server.URL+"/bucket", "ACCESSKEY", "secret", "eu-west-1")
+	if !assert.NoError(err) {
+		return
+	}
+
+	assertPackageCacheRoundTrip(assert, cache)
+
+	if assert.NotEmpty(store.authorizations) {
+		for _, authorization := range store.authorizations {
+			assert.Contains(authorization, "AWS4-HMAC-SHA256 Credential=ACCESSKEY/")
+			assert.Contains(authorization, "/eu-west-1/s3/aws4_request")
+			assert.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date")
+		}
+	}
+}
+
+func TestCompilePackageUsesPackageCache(t *testing.T) {
+	assert := assert.New(t)
+
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	cache, err := NewFilesystemPackageCache(filepath.Join(compilationWorkDir, "cache"))
+	if !assert.NoError(err) {
+		return
+	}
+
+	// No docker manager is needed; the package comes from the cache
+	comp, err := NewCompilator(nil, compilationWorkDir, "", "fissile-test-compilator", compilation.FakeBase, "3.14.15", false, ui)
+	assert.NoError(err)
+	comp.SetPackageCache(cache)
+
+	pkg := &model.Package{
+		Name:        "ntp",
+		Fingerprint: "fake-fingerprint",
+		Release:     &model.Release{Name: "ntp"},
+	}
+
+	srcDir := filepath.Join(compilationWorkDir, "elsewhere")
+	writeFakeCompiledPackage(assert, srcDir)
+	assert.NoError(cache.Store(PackageCacheKey(pkg, comp.BaseImageName()), srcDir))
+
+	err = comp.compilePackage(pkg)
+	assert.NoError(err)
+
+	compiled, err := comp.isPackageCompiled(pkg)
+	assert.NoError(err)
+	assert.True(compiled)
+
+	exists, err := validatePath(filepath.Join(pkg.GetPackageCompiledDir(compilationWorkDir), "bin", "ntpd"), false, "")
+	assert.NoError(err)
+	assert.True(exists)
+}
@@ -0,0 +1,37 @@
+package kube
+
+import (
+	"fmt"
+
+	meta "k8s.io/client-go/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// ConfigMapName returns the name of the config map holding the values of the
+// non-secret configuration variables of a deployment
+func ConfigMapName(deploymentName string) string {
+	if deploymentName == "" {
+		return "config"
+	}
+	return fmt.Sprintf("%s-config", deploymentName)
+}
+
+// NewConfigMap creates a new k8s config map holding the given values
+func NewConfigMap(name string, values map[string]string) *apiv1.ConfigMap {
+	configMap := &apiv1.ConfigMap{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: apiv1.ObjectMeta{
+			Name: name,
+		},
+		Data: make(map[string]string, len(values)),
+	}
+
+	for key, value := range values {
+		configMap.Data[key] = value
+	}
+
+	return configMap
+}
@@ -8,8 +8,10 @@ import (
 	extra "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
-// NewDeployment creates a Deployment for the given role, and its attached service
-func NewDeployment(role *model.Role, settings *ExportSettings) (*extra.Deployment, *apiv1.Service, error) {
+// NewDeployment creates a Deployment for the given role, and the list of its
+// attached service, the objects exposing its public ports, and its autoscaler
+// and disruption budget
+func NewDeployment(role *model.Role, settings *ExportSettings) (*extra.Deployment, *apiv1.List, error) {
 
 	podTemplate, err := NewPodTemplate(role, settings)
 	if err != nil {
@@ -21,7 +23,12 @@ func NewDeployment(role *model.Role, settings *ExportSettings) (*extra.Deploymen
 		return nil, nil, err
 	}
 
-	return &extra.Deployment{
+	deps, err := newServiceList(role, settings, svc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deployment := &extra.Deployment{
 		TypeMeta: meta.TypeMeta{
 			APIVersion: "extensions/v1beta1",
 			Kind:       "Deployment",
@@ -39,7 +46,10 @@ func NewDeployment(role *model.Role, settings *ExportSettings) (*extra.Deploymen
 			},
 			Template: podTemplate,
 		},
-	}, svc, nil
+	}
+	addScalingObjects(deps, role, deployment.TypeMeta)
+
+	return deployment, deps, nil
 }
 
 //metadata:
@@ -1,10 +1,41 @@
 package kube
 
+import (
+	"github.com/hpcloud/fissile/model"
+)
+
+// The QoS classes role pods can be given
+const (
+	QoSBurstable  = "burstable"
+	QoSGuaranteed = "guaranteed"
+)
+
+// The storage classes of persistent and shared volumes, unless given
+const (
+	DefaultPersistentStorageClass = "persistent"
+	DefaultSharedStorageClass     = "shared"
+)
+
 // ExportSettings are configuration for creating Kubernetes configs
 type ExportSettings struct {
+	DeploymentName  string // Prefixes the names of the secret and the config map
 	Repository      string
 	Defaults        map[string]string
 	Registry        string
 	Organization    string
 	UseMemoryLimits bool
+	StemcellOS      string
+	CreateHelmChart bool // Whether role configs are written as helm templates
+	// How public ports are exposed, for roles that don't say in the role manifest
+	PublicExposure model.PublicExposure
+	ExternalIPs    []string // The IPs public ports are exposed on, for external-ips exposure
+	IngressDomain  string   // Ingress hosts default to <role>.<domain>
+	QoS            string   // The QoS class of role pods, if any
+	// The storage classes of volumes that don't have their own
+	PersistentStorageClass string
+	SharedStorageClass     string
+	// The image with kubectl of the init containers waiting for other roles
+	// through the kube API; there is no default, as it has to be trusted
+	// with API access and be reachable by the cluster
+	KubectlImage string
 }
@@ -0,0 +1,192 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+
+	"gopkg.in/yaml.v2"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// HelmHookAnnotation is the annotation turning an object into a helm hook
+	HelmHookAnnotation = "helm.sh/hook"
+	// HelmHookWeightAnnotation is the annotation ordering the hooks of an event
+	HelmHookWeightAnnotation = "helm.sh/hook-weight"
+	// HelmHookDeletePolicyAnnotation is the annotation telling helm when to
+	// delete hooks
+	HelmHookDeletePolicyAnnotation = "helm.sh/hook-delete-policy"
+)
+
+// waitForJobScript waits for a job to have completed successfully
+const waitForJobScript = `until kubectl get job %[1]s --output=jsonpath='{.status.succeeded}' | grep -q '^[1-9]'; do
+  echo "Waiting for job %[1]s to complete"
+  sleep 5
+done`
+
+// waitForRoleScript waits for a pod of a role to be ready
+const waitForRoleScript = `until kubectl get pods --selector=%[1]s=%[2]s --output=jsonpath='{.items[*].status.conditions[?(@.type=="Ready")].status}' | grep -q True; do
+  echo "Waiting for role %[2]s to be ready"
+  sleep 5
+done`
+
+// waitForAddressScript waits for the service (host:port) of a role to accept
+// connections, i.e. for pods of the role to be ready, the same way
+// post-start.sh does
+const waitForAddressScript = `until timeout 5 bash -c "exec 3<>/dev/tcp/%[1]s/%[2]s" 2>/dev/null; do
+  echo "Waiting for %[1]s:%[2]s to be reachable"
+  sleep 5
+done`
+
+// getInitContainers returns the init containers holding back the pods of a
+// role until the roles it waits for are done. Flight roles wait for the
+// pre-flight tasks to complete, and post-flight tasks wait for the flight
+// roles they need to be ready; these containers query the kube API through
+// kubectl, from the image given in the settings, with the service account
+// created by NewWaitRBAC. Roles wait for the services of the roles they
+// depend on to accept connections, which needs no API access, so those
+// containers run the image of the role itself. All containers get the
+// resources of the role container, so that they count against the same
+// limits and keep the QoS class of the pod.
+func getInitContainers(role *model.Role, settings *ExportSettings, resources apiv1.ResourceRequirements) ([]apiv1.Container, error) {
+	if len(getWaitPolicyRules(role)) > 0 && settings.KubectlImage == "" {
+		return nil, fmt.Errorf("Role %s waits for other roles through the kube API, which needs an image with kubectl; pass --kubectl-image", role.Name)
+	}
+
+	var containers []apiv1.Container
+	waitedFor := map[string]bool{}
+	addContainer := func(roleName, image string, command ...string) {
+		containers = append(containers, apiv1.Container{
+			Name:      fmt.Sprintf("wait-for-%s", roleName),
+			Image:     image,
+			Command:   command,
+			Resources: resources,
+		})
+		waitedFor[roleName] = true
+	}
+
+	for _, task := range role.PreFlightRoles() {
+		addContainer(task.Name, settings.KubectlImage, "/bin/sh", "-c", fmt.Sprintf(waitForJobScript, task.Name))
+	}
+	for _, flightRole := range role.FlightRoles() {
+		addContainer(flightRole.Name, settings.KubectlImage, "/bin/sh", "-c", fmt.Sprintf(waitForRoleScript, RoleNameLabel, flightRole.Name))
+	}
+
+	// The init containers live in an annotation, out of reach of the
+	// templating of images in WriteHelmTemplate
+	roleImage := getContainerImageName(role, settings)
+	if settings.CreateHelmChart {
+		roleImage = helmImageTemplate + roleImage
+	}
+	for _, address := range role.DependencyAddresses() {
+		parts := strings.SplitN(address, ":", 2)
+		host, port := parts[0], parts[1]
+		if !waitedFor[host] {
+			addContainer(host, roleImage, "/bin/bash", "-c", fmt.Sprintf(waitForAddressScript, host, port))
+		}
+	}
+	return containers, nil
+}
+
+// getWaitPolicyRules returns the access to the kube API the init containers
+// of a role need, if any
+func getWaitPolicyRules(role *model.Role) []PolicyRule {
+	var rules []PolicyRule
+	if len(role.PreFlightRoles()) > 0 {
+		rules = append(rules, PolicyRule{
+			APIGroups: []string{"batch", "extensions"},
+			Resources: []string{"jobs"},
+			Verbs:     []string{"get"},
+		})
+	}
+	if len(role.FlightRoles()) > 0 {
+		rules = append(rules, PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"list"},
+		})
+	}
+	return rules
+}
+
+// setInitContainers sets the init containers of a pod template. The vendored
+// client doesn't serialize them as a field, so they go into the beta
+// annotation instead.
+func setInitContainers(podTemplate *apiv1.PodTemplateSpec, containers []apiv1.Container) error {
+	if len(containers) == 0 {
+		return nil
+	}
+	initContainers, err := json.Marshal(containers)
+	if err != nil {
+		return fmt.Errorf("Error serializing the init containers of %s: %s", podTemplate.Name, err.Error())
+	}
+	if podTemplate.Annotations == nil {
+		podTemplate.Annotations = map[string]string{}
+	}
+	podTemplate.Annotations[apiv1.PodInitContainersBetaAnnotationKey] = string(initContainers)
+	return nil
+}
+
+// getHelmHookAnnotations returns the annotations running the job of a task as
+// a helm hook, for the tasks of helm charts that run before or after the
+// flight roles. Hooks run after installing or upgrading, once the secrets and
+// config maps exist, and replace the jobs of earlier releases; pre-flight tasks
+// run first, while the init containers of the flight roles wait for them.
+func getHelmHookAnnotations(role *model.Role, settings *ExportSettings) map[string]string {
+	if !settings.CreateHelmChart || role.Run == nil {
+		return nil
+	}
+
+	var weight string
+	switch role.Run.FlightStage {
+	case model.FlightStagePreFlight:
+		weight = "0"
+	case model.FlightStagePostFlight:
+		weight = "1"
+	default:
+		return nil
+	}
+
+	return map[string]string{
+		HelmHookAnnotation:             "post-install,post-upgrade",
+		HelmHookWeightAnnotation:       weight,
+		HelmHookDeletePolicyAnnotation: "before-hook-creation",
+	}
+}
+
+// ApplyStage lists the configuration files of a stage of the deployment
+type ApplyStage struct {
+	Name  string   `yaml:"name"`
+	Files []string `yaml:"files"`
+}
+
+// WriteApplyOrder writes the index of the configuration files written by
+// build kube, by stage, in the order to apply them in. Empty stages are left
+// out.
+func WriteApplyOrder(stages []ApplyStage, writer io.Writer) error {
+	var index struct {
+		Stages []ApplyStage `yaml:"stages"`
+	}
+	for _, stage := range stages {
+		if len(stage.Files) > 0 {
+			index.Stages = append(index.Stages, stage)
+		}
+	}
+
+	data, err := yaml.Marshal(&index)
+	if err != nil {
+		return err
+	}
+
+	header := "---\n# The configuration files in the order to apply them in; the roles of a\n" +
+		"# stage wait for those of the previous stages, and manual tasks only run\n# when applied by hand.\n"
+	if _, err := io.WriteString(writer, header); err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
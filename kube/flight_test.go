@@ -0,0 +1,213 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+func TestFlightInitContainers(t *testing.T) {
+	assert := assert.New(t)
+
+	preRole := jobTestLoadRole(assert, "pre-role")
+	flightRole := jobTestLoadRole(assert, "flight-role")
+	postRole := jobTestLoadRole(assert, "post-role")
+	if preRole == nil || flightRole == nil || postRole == nil {
+		return
+	}
+
+	settings := &ExportSettings{}
+	containers, err := getInitContainers(preRole, settings, apiv1.ResourceRequirements{})
+	assert.NoError(err)
+	assert.Empty(containers, "Pre-flight tasks wait for nothing")
+
+	_, err = getInitContainers(flightRole, settings, apiv1.ResourceRequirements{})
+	assert.EqualError(err, "Role flight-role waits for other roles through the kube API, which needs an image with kubectl; pass --kubectl-image")
+
+	settings.KubectlImage = "docker.example.com/kubectl"
+	containers, err = getInitContainers(flightRole, settings, apiv1.ResourceRequirements{})
+	if assert.NoError(err) && assert.Len(containers, 1) {
+		assert.Equal("wait-for-pre-role", containers[0].Name)
+		assert.Equal("docker.example.com/kubectl", containers[0].Image)
+		if assert.Len(containers[0].Command, 3) {
+			assert.Contains(containers[0].Command[2], "kubectl get job pre-role ")
+		}
+	}
+
+	containers, err = getInitContainers(postRole, settings, apiv1.ResourceRequirements{})
+	if assert.NoError(err) && assert.Len(containers, 1) {
+		assert.Equal("wait-for-flight-role", containers[0].Name)
+		if assert.Len(containers[0].Command, 3) {
+			assert.Contains(containers[0].Command[2], "kubectl get pods --selector=skiff-role-name=flight-role ")
+		}
+	}
+
+	// The init containers go into the annotation of the pod template, and
+	// get the resources of the role container, so that guaranteed pods stay
+	// guaranteed
+	flightRole.Run.Memory = 128
+	flightRole.Run.VirtualCPUs = 1
+	settings.QoS = QoSGuaranteed
+	deployment, _, err := NewDeployment(flightRole, settings)
+	if !assert.NoError(err) {
+		return
+	}
+	podSpec := deployment.Spec.Template.Spec
+	assert.Equal("flight-role", podSpec.ServiceAccountName, "Pods waiting through the API need its service account")
+	var annotated []apiv1.Container
+	annotation := deployment.Spec.Template.Annotations[apiv1.PodInitContainersBetaAnnotationKey]
+	if assert.NoError(json.Unmarshal([]byte(annotation), &annotated)) && assert.Len(annotated, 1) {
+		assert.Equal("wait-for-pre-role", annotated[0].Name)
+		resources := annotated[0].Resources
+		for _, name := range []apiv1.ResourceName{apiv1.ResourceMemory, apiv1.ResourceCPU} {
+			request := resources.Requests[name]
+			limit := resources.Limits[name]
+			roleLimit := podSpec.Containers[0].Resources.Limits[name]
+			assert.Equal(roleLimit.String(), limit.String(), "Unexpected %s limit", name)
+			assert.Equal(limit.String(), request.String(), "Unexpected %s request", name)
+		}
+		memory := resources.Limits[apiv1.ResourceMemory]
+		assert.Equal("128Mi", memory.String())
+	}
+}
+
+func TestWaitRBAC(t *testing.T) {
+	assert := assert.New(t)
+
+	preRole := jobTestLoadRole(assert, "pre-role")
+	flightRole := jobTestLoadRole(assert, "flight-role")
+	postRole := jobTestLoadRole(assert, "post-role")
+	if preRole == nil || flightRole == nil || postRole == nil {
+		return
+	}
+
+	assert.Nil(NewWaitRBAC(preRole), "Roles waiting for nothing need no API access")
+
+	rbac := NewWaitRBAC(flightRole)
+	if !assert.NotNil(rbac) || !assert.Len(rbac.Items, 3) {
+		return
+	}
+	if serviceAccount, ok := rbac.Items[0].Object.(*apiv1.ServiceAccount); assert.True(ok) {
+		assert.Equal("flight-role", serviceAccount.Name)
+	}
+	if role, ok := rbac.Items[1].Object.(*RBACRole); assert.True(ok) && assert.Len(role.Rules, 1) {
+		assert.Equal([]string{"jobs"}, role.Rules[0].Resources)
+		assert.Equal([]string{"get"}, role.Rules[0].Verbs)
+	}
+	if binding, ok := rbac.Items[2].Object.(*RoleBinding); assert.True(ok) {
+		assert.Equal([]RoleBindingSubject{{Kind: "ServiceAccount", Name: "flight-role"}}, binding.Subjects)
+		assert.Equal("flight-role", binding.RoleRef.Name)
+	}
+
+	rbac = NewWaitRBAC(postRole)
+	if assert.NotNil(rbac) {
+		role := rbac.Items[1].Object.(*RBACRole)
+		if assert.Len(role.Rules, 1) {
+			assert.Equal([]string{"pods"}, role.Rules[0].Resources)
+			assert.Equal([]string{"list"}, role.Rules[0].Verbs)
+		}
+
+		yamlConfig := &bytes.Buffer{}
+		if assert.NoError(WriteYamlConfig(rbac, yamlConfig)) {
+			assert.Contains(yamlConfig.String(), "apiVersion: rbac.authorization.k8s.io/v1beta1\n  kind: RoleBinding\n")
+			assert.Contains(yamlConfig.String(), "roleRef:\n    apiGroup: rbac.authorization.k8s.io\n    kind: Role\n    name: post-role\n")
+		}
+	}
+}
+
+func TestFlightDependsOn(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	manifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on.yml")
+	manifest, err := model.LoadRoleManifest(manifestPath, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	api := manifest.LookupRole("api")
+	settings := &ExportSettings{Repository: "fissile"}
+	containers, err := getInitContainers(api, settings, apiv1.ResourceRequirements{})
+	if assert.NoError(err) && assert.Len(containers, 2) {
+		assert.Equal("wait-for-nats", containers[0].Name)
+		assert.Equal("wait-for-database", containers[1].Name)
+		assert.Equal(getContainerImageName(api, settings), containers[1].Image, "Dependencies are waited for with the image of the role")
+		if assert.Len(containers[1].Command, 3) {
+			assert.Equal("/bin/bash", containers[1].Command[0])
+			assert.Contains(containers[1].Command[2], "/dev/tcp/database/3306")
+			assert.NotContains(containers[1].Command[2], "kubectl")
+		}
+	}
+	assert.Nil(NewWaitRBAC(api), "Waiting for dependencies needs no API access")
+
+	settings.CreateHelmChart = true
+	containers, err = getInitContainers(api, settings, apiv1.ResourceRequirements{})
+	if assert.NoError(err) && assert.Len(containers, 2) {
+		assert.Equal(helmImageTemplate+getContainerImageName(api, settings), containers[0].Image)
+	}
+
+	containers, err = getInitContainers(manifest.LookupRole("database"), &ExportSettings{}, apiv1.ResourceRequirements{})
+	assert.NoError(err)
+	assert.Empty(containers)
+}
+
+func TestFlightHelmHooks(t *testing.T) {
+	assert := assert.New(t)
+
+	preRole := jobTestLoadRole(assert, "pre-role")
+	postRole := jobTestLoadRole(assert, "post-role")
+	if preRole == nil || postRole == nil {
+		return
+	}
+
+	job, err := NewJob(preRole, &ExportSettings{})
+	if assert.NoError(err) {
+		assert.Empty(job.Annotations, "Only jobs of helm charts are hooks")
+	}
+
+	settings := &ExportSettings{CreateHelmChart: true, KubectlImage: "docker.example.com/kubectl"}
+	job, err = NewJob(preRole, settings)
+	if assert.NoError(err) {
+		assert.Equal(map[string]string{
+			HelmHookAnnotation:             "post-install,post-upgrade",
+			HelmHookWeightAnnotation:       "0",
+			HelmHookDeletePolicyAnnotation: "before-hook-creation",
+		}, job.Annotations)
+	}
+
+	job, err = NewJob(postRole, settings)
+	if assert.NoError(err) {
+		assert.Equal("1", job.Annotations[HelmHookWeightAnnotation], "Post-flight hooks run after pre-flight hooks")
+	}
+}
+
+func TestWriteApplyOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	output := &bytes.Buffer{}
+	err := WriteApplyOrder([]ApplyStage{
+		{Name: "configuration", Files: []string{"secrets.yml", "config.yml"}},
+		{Name: "pre-flight"},
+		{Name: "flight", Files: []string{"bosh/myrole.yml"}},
+	}, output)
+	if assert.NoError(err) {
+		assert.Contains(output.String(), `stages:
+- name: configuration
+  files:
+  - secrets.yml
+  - config.yml
+- name: flight
+  files:
+  - bosh/myrole.yml
+`)
+	}
+}
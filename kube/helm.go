@@ -0,0 +1,198 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+
+	"k8s.io/client-go/pkg/runtime"
+)
+
+// HelmChartVersion is the version of the helm charts written by fissile
+const HelmChartVersion = "0.1.0"
+
+// helmImageTemplate prefixes the images of the roles with the docker registry
+// and organization from the values of the chart
+const helmImageTemplate = "{{ if .Values.kube.registry.hostname }}{{ .Values.kube.registry.hostname }}/{{ end }}" +
+	"{{ if .Values.kube.organization }}{{ .Values.kube.organization }}/{{ end }}"
+
+var (
+	// helmReplicasRegexp matches the replica count of a deployment or a stateful set
+	helmReplicasRegexp = regexp.MustCompile(`(?m)^(  replicas: )\d+$`)
+	// helmMemoryRegexp matches the memory requested by or limited for a
+	// container; the serializer picks the largest binary unit the size is a
+	// multiple of (1Gi for 1024Mi), and no memory at all is serialized as "0"
+	helmMemoryRegexp = regexp.MustCompile(`^(\s+memory: )(?:\d+(?:Ki|Mi|Gi|Ti|Pi|Ei)?|"0")$`)
+	// helmImageRegexp matches the image of a container
+	helmImageRegexp = regexp.MustCompile(`(?m)^(\s+image: )(\S+)$`)
+)
+
+// helmRoleKey returns the key of the values of a role in a helm chart; keys
+// with hyphens can't be used in the templates
+func helmRoleKey(role *model.Role) string {
+	return strings.Replace(role.Name, "-", "_", -1)
+}
+
+// WriteHelmChart writes the Chart.yaml of a helm chart
+func WriteHelmChart(name, description string, writer io.Writer) error {
+	_, err := fmt.Fprintf(writer, "---\napiVersion: v1\nname: %s\nversion: %s\ndescription: %s\n",
+		name, HelmChartVersion, strconv.Quote(description))
+	return err
+}
+
+// WriteHelmValues writes the values.yaml of a helm chart, holding the values
+// of the configuration variables, the docker registry settings, and the
+// instance counts and memory of the roles
+func WriteHelmValues(roles model.Roles, variables model.ConfigurationVariableSlice, settings *ExportSettings, writer io.Writer) error {
+	buffer := &bytes.Buffer{}
+
+	buffer.WriteString("---\n# Values of the configuration variables\nenv:\n")
+
+	sorted := make(model.ConfigurationVariableSlice, len(variables))
+	copy(sorted, variables)
+	sort.Sort(sorted)
+
+	for _, variable := range sorted {
+		if variable.Description != "" {
+			for _, line := range strings.Split(strings.TrimSpace(variable.Description), "\n") {
+				fmt.Fprintf(buffer, "  # %s\n", strings.TrimSpace(line))
+			}
+		}
+		// Go quoted strings are also valid YAML double-quoted strings
+		value := "~"
+		if stringValue, ok := getVariableValue(variable, settings.Defaults); ok {
+			value = strconv.Quote(stringValue)
+		}
+		fmt.Fprintf(buffer, "  %s: %s\n", variable.Name, value)
+	}
+
+	buffer.WriteString("\n# Docker registry and organization of the role images\nkube:\n  registry:\n")
+	fmt.Fprintf(buffer, "    hostname: %s\n", strconv.Quote(settings.Registry))
+	fmt.Fprintf(buffer, "  organization: %s\n", strconv.Quote(settings.Organization))
+
+	buffer.WriteString("\n# Sizing of the roles\nsizing:\n")
+	for _, role := range roles {
+		fmt.Fprintf(buffer, "  %s:\n", helmRoleKey(role))
+		if role.Type != model.RoleTypeBoshTask {
+			count := int32(1)
+			if role.Run != nil && role.Run.Scaling != nil {
+				count = role.Run.Scaling.Min
+			}
+			fmt.Fprintf(buffer, "    # Number of instances of the role\n    count: %d\n", count)
+		}
+		if role.Run == nil {
+			fmt.Fprintf(buffer, "    # Memory requested by the role, in MiB\n    memory: 0\n")
+			continue
+		}
+		resources, err := getRoleResources(role, settings)
+		if err != nil {
+			return err
+		}
+		memory := resources.memoryRequest
+		if memory == 0 {
+			memory = role.Run.Memory
+		}
+		fmt.Fprintf(buffer, "    # Memory requested by the role, in MiB\n    memory: %d\n", memory)
+		if resources.memoryLimit != 0 && settings.QoS != QoSGuaranteed {
+			fmt.Fprintf(buffer, "    # Memory the role is limited to, in MiB\n    memory_limit: %d\n", resources.memoryLimit)
+		}
+	}
+
+	_, err := writer.Write(buffer.Bytes())
+	return err
+}
+
+// WriteHelmConfiguration writes the templates of the secret and the config map
+// holding the values of the configuration variables, which are taken from the
+// values of the chart. They are named after the deployment.
+func WriteHelmConfiguration(variables model.ConfigurationVariableSlice, deploymentName string, secretWriter, configMapWriter io.Writer) error {
+	sorted := make(model.ConfigurationVariableSlice, len(variables))
+	copy(sorted, variables)
+	sort.Sort(sorted)
+
+	secret := &bytes.Buffer{}
+	fmt.Fprintf(secret, "---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: %s\ntype: Opaque\ndata:\n", SecretName(deploymentName))
+
+	configMap := &bytes.Buffer{}
+	fmt.Fprintf(configMap, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n", ConfigMapName(deploymentName))
+
+	for _, variable := range sorted {
+		if variable.Secret {
+			fmt.Fprintf(secret, "  %s: {{ default \"\" .Values.env.%s | toString | b64enc | quote }}\n", variable.Name, variable.Name)
+		} else {
+			fmt.Fprintf(configMap, "  %s: {{ default \"\" .Values.env.%s | toString | quote }}\n", variable.Name, variable.Name)
+		}
+	}
+
+	if _, err := secretWriter.Write(secret.Bytes()); err != nil {
+		return err
+	}
+	_, err := configMapWriter.Write(configMap.Bytes())
+	return err
+}
+
+// WriteHelmTemplate writes the YAML serialized configuration of a k8s object
+// for a role as a helm template, taking the instance count and the memory of
+// the role, the instance counts of the roles it consumes links from, and the
+// docker registry and organization of its image, from the values of the chart. The templates are put in after serializing, as the
+// serializer would quote and fold them.
+func WriteHelmTemplate(kubeObject runtime.Object, role *model.Role, settings *ExportSettings, writer io.Writer) error {
+	buffer := &bytes.Buffer{}
+	if err := WriteYamlConfig(kubeObject, buffer); err != nil {
+		return err
+	}
+
+	key := helmRoleKey(role)
+	template := helmReplicasRegexp.ReplaceAllString(buffer.String(),
+		fmt.Sprintf("${1}{{ .Values.sizing.%s.count }}", key))
+
+	// Memory limits have their own value, unless they have to match the
+	// requests; the memory lines follow the limits or requests they are in
+	lines := strings.Split(template, "\n")
+	memoryValue := "memory"
+	for i, line := range lines {
+		switch strings.TrimSpace(line) {
+		case "limits:":
+			memoryValue = "memory_limit"
+			if settings.QoS == QoSGuaranteed {
+				memoryValue = "memory"
+			}
+		case "requests:":
+			memoryValue = "memory"
+		}
+		if match := helmMemoryRegexp.FindStringSubmatch(line); match != nil {
+			lines[i] = fmt.Sprintf("%s{{ .Values.sizing.%s.%s }}Mi", match[1], key, memoryValue)
+		}
+	}
+	template = strings.Join(lines, "\n")
+	template = helmImageRegexp.ReplaceAllString(template, "${1}"+helmImageTemplate+"${2}")
+
+	// The environment variables holding the instance counts of the roles
+	// providing links follow the sizing of those roles; tasks have no count
+	for _, provider := range role.LinkProviderRoles() {
+		if provider.Type == model.RoleTypeBoshTask {
+			continue
+		}
+		linkInstancesRegexp := regexp.MustCompile(`(?m)^(\s+- name: ` + regexp.QuoteMeta(provider.LinkInstancesEnvVar()) + `\n\s+value: )"\d+"$`)
+		template = linkInstancesRegexp.ReplaceAllString(template,
+			fmt.Sprintf("${1}{{ .Values.sizing.%s.count | quote }}", helmRoleKey(provider)))
+	}
+
+	_, err := io.WriteString(writer, template)
+	return err
+}
+
+// WriteRoleConfig writes the configuration of a k8s object for a role, as a
+// helm template if a helm chart is being created
+func WriteRoleConfig(kubeObject runtime.Object, role *model.Role, settings *ExportSettings, writer io.Writer) error {
+	if settings.CreateHelmChart {
+		return WriteHelmTemplate(kubeObject, role, settings, writer)
+	}
+	return WriteYamlConfig(kubeObject, writer)
+}
@@ -0,0 +1,216 @@
+package kube
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+
+	"github.com/hpcloud/fissile/model"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHelmTemplate(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+	role.Name = "my-role"
+	role.Run.Memory = 128
+
+	// Variables without a value are still referenced, as values can be
+	// given when installing the chart
+	role.Jobs[0].Properties = []*model.JobProperty{
+		&model.JobProperty{
+			Name: "some-property",
+		},
+	}
+	role.Configuration.Templates["property.some-property"] = "((SOME_VAR))"
+
+	settings := &ExportSettings{
+		Repository:      "fissile",
+		UseMemoryLimits: true,
+		CreateHelmChart: true,
+	}
+	statefulSet, _, err := NewStatefulSet(role, settings)
+	if !assert.NoError(err) {
+		return
+	}
+
+	output := &bytes.Buffer{}
+	if !assert.NoError(WriteRoleConfig(statefulSet, role, settings, output)) {
+		return
+	}
+	assert.Contains(output.String(), "  replicas: {{ .Values.sizing.my_role.count }}\n")
+	assert.Contains(output.String(), "memory: {{ .Values.sizing.my_role.memory }}Mi\n")
+
+	// Memory limits are values of their own
+	role.Run.MemoryLimit = 512
+	statefulSet, _, err = NewStatefulSet(role, settings)
+	if !assert.NoError(err) {
+		return
+	}
+	limited := &bytes.Buffer{}
+	if assert.NoError(WriteRoleConfig(statefulSet, role, settings, limited)) {
+		assert.Contains(limited.String(), "limits:\n            memory: {{ .Values.sizing.my_role.memory_limit }}Mi\n")
+		assert.Contains(limited.String(), "requests:\n            memory: {{ .Values.sizing.my_role.memory }}Mi\n")
+	}
+
+	// Render the template the way helm would, with the values of the chart
+	tmpl, err := template.New("my-role").Parse(output.String())
+	if !assert.NoError(err) {
+		return
+	}
+	rendered := &bytes.Buffer{}
+	err = tmpl.Execute(rendered, map[string]interface{}{
+		"Values": map[string]interface{}{
+			"kube": map[string]interface{}{
+				"registry":     map[string]interface{}{"hostname": "docker.example.com"},
+				"organization": "",
+			},
+			"sizing": map[string]interface{}{
+				"my_role": map[string]interface{}{"count": 3, "memory": 256},
+			},
+		},
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	var actual interface{}
+	if !assert.NoError(yaml.Unmarshal(rendered.Bytes(), &actual)) {
+		return
+	}
+	expectedYAML := `---
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - image: docker.example.com/` + getContainerImageName(role, &ExportSettings{Repository: "fissile"}) + `
+        resources:
+          requests:
+            memory: 256Mi
+        env:
+        - name: SOME_VAR
+          valueFrom:
+            configMapKeyRef:
+              key: SOME_VAR
+              name: config
+        - name: KUBERNETES_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        - name: KUBERNETES_POD_IP
+          valueFrom:
+            fieldRef:
+              fieldPath: status.podIP
+`
+	var expected interface{}
+	if assert.NoError(yaml.Unmarshal([]byte(expectedYAML), &expected)) {
+		isYAMLSubset(assert, expected, actual, []string{})
+	}
+}
+
+func TestHelmTemplateMemoryQuantities(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+	role.Name = "my-role"
+
+	// Sizes that are multiples of a GiB are serialized in Gi, not Mi
+	role.Run.Memory = 1024
+	role.Run.MemoryLimit = 2048
+
+	settings := &ExportSettings{
+		Repository:      "fissile",
+		UseMemoryLimits: true,
+		CreateHelmChart: true,
+	}
+	statefulSet, _, err := NewStatefulSet(role, settings)
+	if !assert.NoError(err) {
+		return
+	}
+
+	output := &bytes.Buffer{}
+	if assert.NoError(WriteHelmTemplate(statefulSet, role, settings, output)) {
+		assert.Contains(output.String(), "limits:\n            memory: {{ .Values.sizing.my_role.memory_limit }}Mi\n")
+		assert.Contains(output.String(), "requests:\n            memory: {{ .Values.sizing.my_role.memory }}Mi\n")
+		assert.NotContains(output.String(), "Gi\n")
+	}
+}
+
+func TestHelmValues(t *testing.T) {
+	assert := assert.New(t)
+
+	roles := model.Roles{
+		{Name: "my-role", Type: model.RoleTypeBosh, Run: &model.RoleRun{
+			Memory:  512,
+			Scaling: &model.RoleRunScaling{Min: 2, Max: 3},
+		}},
+		{Name: "task", Type: model.RoleTypeBoshTask, Run: &model.RoleRun{Memory: 64, MemoryLimit: 128}},
+	}
+	variables := model.ConfigurationVariableSlice{
+		{Name: "PLAIN", Default: "plain", Description: "A plain value\nspanning lines"},
+		{Name: "PASSWORD", Secret: true},
+		{Name: "QUOTED", Default: `"quoted"`},
+	}
+	settings := &ExportSettings{
+		Defaults:     map[string]string{"PLAIN": "overridden"},
+		Registry:     "docker.example.com",
+		Organization: "splatform",
+	}
+
+	output := &bytes.Buffer{}
+	if !assert.NoError(WriteHelmValues(roles, variables, settings, output)) {
+		return
+	}
+	assert.Contains(output.String(), "  # A plain value\n  # spanning lines\n  PLAIN:")
+
+	var values map[string]interface{}
+	if !assert.NoError(yaml.Unmarshal(output.Bytes(), &values)) {
+		return
+	}
+	assert.Equal(map[interface{}]interface{}{
+		"PASSWORD": nil,
+		"PLAIN":    "overridden",
+		"QUOTED":   `"quoted"`,
+	}, values["env"])
+	assert.Equal(map[interface{}]interface{}{
+		"registry":     map[interface{}]interface{}{"hostname": "docker.example.com"},
+		"organization": "splatform",
+	}, values["kube"])
+	assert.Equal(map[interface{}]interface{}{
+		"my_role": map[interface{}]interface{}{"count": 2, "memory": 512},
+		"task":    map[interface{}]interface{}{"memory": 64, "memory_limit": 128},
+	}, values["sizing"])
+}
+
+func TestHelmConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	variables := model.ConfigurationVariableSlice{
+		{Name: "PLAIN", Default: "plain"},
+		{Name: "PASSWORD", Secret: true},
+	}
+
+	secret := &bytes.Buffer{}
+	configMap := &bytes.Buffer{}
+	if !assert.NoError(WriteHelmConfiguration(variables, "mycf", secret, configMap)) {
+		return
+	}
+
+	assert.Contains(secret.String(), "kind: Secret\n")
+	assert.Contains(secret.String(), "  name: mycf-secrets\n")
+	assert.Contains(secret.String(), `  PASSWORD: {{ default "" .Values.env.PASSWORD | toString | b64enc | quote }}`)
+	assert.NotContains(secret.String(), "PLAIN")
+
+	assert.Contains(configMap.String(), "kind: ConfigMap\n")
+	assert.Contains(configMap.String(), "  name: mycf-config\n")
+	assert.Contains(configMap.String(), `  PLAIN: {{ default "" .Values.env.PLAIN | toString | quote }}`)
+	assert.NotContains(configMap.String(), "PASSWORD")
+}
@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+
+	meta "k8s.io/client-go/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extra "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/pkg/util/intstr"
+)
+
+// NewIngress creates an ingress routing HTTP requests to the public ports of
+// a role, via the service of the role. Nothing is returned for roles without
+// public ports, or not exposed through an ingress.
+func NewIngress(role *model.Role, settings *ExportSettings) (*extra.Ingress, error) {
+	if exposure, _ := getPublicExposure(role, settings); exposure != model.PublicExposureIngress {
+		return nil, nil
+	}
+
+	var host string
+	if role.Run.PublicExposure != nil && role.Run.PublicExposure.Host != "" {
+		host = role.Run.PublicExposure.Host
+	} else if settings.IngressDomain != "" {
+		host = fmt.Sprintf("%s.%s", role.Name, settings.IngressDomain)
+	}
+
+	var paths []extra.HTTPIngressPath
+	for _, portDef := range role.Run.ExposedPorts {
+		if !portDef.Public {
+			continue
+		}
+
+		if protocol := strings.ToUpper(portDef.Protocol); protocol != "" && protocol != "TCP" {
+			return nil, fmt.Errorf("Port %s of role %s is exposed through an ingress, but is not a TCP port", portDef.Name, role.Name)
+		}
+		minPort, maxPort, err := model.ParsePortRange(portDef.External, portDef.Name, "external")
+		if err != nil {
+			return nil, err
+		}
+		if minPort != maxPort {
+			return nil, fmt.Errorf("Port %s of role %s is exposed through an ingress, but is a port range", portDef.Name, role.Name)
+		}
+
+		path := portDef.Path
+		if path == "" {
+			path = "/"
+		}
+
+		paths = append(paths, extra.HTTPIngressPath{
+			Path: path,
+			Backend: extra.IngressBackend{
+				ServiceName: role.Name,
+				ServicePort: intstr.FromInt(int(minPort)),
+			},
+		})
+	}
+
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	return &extra.Ingress{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "extensions/v1beta1",
+			Kind:       "Ingress",
+		},
+		ObjectMeta: apiv1.ObjectMeta{
+			Name: role.Name,
+			Labels: map[string]string{
+				RoleNameLabel: role.Name,
+			},
+		},
+		Spec: extra.IngressSpec{
+			Rules: []extra.IngressRule{
+				{
+					Host: host,
+					IngressRuleValue: extra.IngressRuleValue{
+						HTTP: &extra.HTTPIngressRuleValue{Paths: paths},
+					},
+				},
+			},
+		},
+	}, nil
+}
@@ -36,7 +36,8 @@ func NewJob(role *model.Role, settings *ExportSettings) (*extra.Job, error) {
 			Kind:       "Job",
 		},
 		ObjectMeta: apiv1.ObjectMeta{
-			Name: role.Name,
+			Name:        role.Name,
+			Annotations: getHelmHookAnnotations(role, settings),
 		},
 		Spec: extra.JobSpec{
 			Template: podTemplate,
@@ -19,7 +19,7 @@ func jobTestLoadRole(assert *assert.Assertions, roleName string) *model.Role {
 	manifestPath := filepath.Join(workDir, "../test-assets/role-manifests/jobs.yml")
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	if !assert.NoError(err) {
 		return nil
 	}
@@ -87,7 +87,7 @@ func TestJobPostFlight(t *testing.T) {
 		return
 	}
 
-	job, err := NewJob(role, &ExportSettings{})
+	job, err := NewJob(role, &ExportSettings{KubectlImage: "docker.example.com/kubectl"})
 	if !assert.NoError(err, "Failed to create job from role post-role") {
 		return
 	}
@@ -116,6 +116,7 @@ func TestJobPostFlight(t *testing.T) {
 				-
 					name: post-role
 				restartPolicy: OnFailure
+				serviceAccountName: post-role
 	`, "\t", "    ", -1)
 	if !assert.NoError(yaml.Unmarshal([]byte(expectedYAML), &expected)) {
 		return
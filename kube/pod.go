@@ -20,23 +20,22 @@ import (
 // monitPort is the port monit runs on in the pods
 const monitPort = 2289
 
+// defaultLivenessInitialDelay is the time given to BOSH roles to start, in
+// seconds, before they are checked to be alive
+const defaultLivenessInitialDelay = 600
+
 // NewPodTemplate creates a new pod template spec for a given role, as well as
 // any objects it depends on
 func NewPodTemplate(role *model.Role, settings *ExportSettings) (v1.PodTemplateSpec, error) {
 
-	vars, err := getEnvVars(role, settings.Defaults)
+	vars, err := getEnvVars(role, settings)
 	if err != nil {
 		return v1.PodTemplateSpec{}, err
 	}
 
-	var resources v1.ResourceRequirements
-
-	if settings.UseMemoryLimits {
-		resources = v1.ResourceRequirements{
-			Requests: v1.ResourceList{
-				v1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", role.Run.Memory)),
-			},
-		}
+	resources, err := getContainerResources(role, settings)
+	if err != nil {
+		return v1.PodTemplateSpec{}, err
 	}
 
 	securityContext := getSecurityContext(role)
@@ -65,12 +64,27 @@ func NewPodTemplate(role *model.Role, settings *ExportSettings) (v1.PodTemplateS
 					SecurityContext: securityContext,
 				},
 			},
+			Volumes:       getVolumes(role),
 			RestartPolicy: v1.RestartPolicyAlways,
 			DNSPolicy:     v1.DNSClusterFirst,
 		},
 	}
 
-	livenessProbe := getContainerLivenessProbe(role)
+	initContainers, err := getInitContainers(role, settings, resources)
+	if err != nil {
+		return v1.PodTemplateSpec{}, err
+	}
+	if err := setInitContainers(&podSpec, initContainers); err != nil {
+		return v1.PodTemplateSpec{}, err
+	}
+	if len(getWaitPolicyRules(role)) > 0 {
+		podSpec.Spec.ServiceAccountName = role.Name
+	}
+
+	livenessProbe, err := getContainerLivenessProbe(role)
+	if err != nil {
+		return v1.PodTemplateSpec{}, err
+	}
 	readinessProbe, err := getContainerReadinessProbe(role)
 	if err != nil {
 		return v1.PodTemplateSpec{}, err
@@ -85,9 +99,104 @@ func NewPodTemplate(role *model.Role, settings *ExportSettings) (v1.PodTemplateS
 	return podSpec, nil
 }
 
+// roleResources are the memory (in MiB) and CPUs requested by and limited
+// for the containers of a role; zero means none
+type roleResources struct {
+	memoryRequest int
+	memoryLimit   int
+	cpuRequest    float64
+	cpuLimit      float64
+}
+
+// getRoleResources returns the resources of a role, shaped for the QoS class
+// from the settings. Guaranteed pods request what they are limited to, which
+// is the limit from the role manifest, or else the request; burstable pods
+// need to request something.
+func getRoleResources(role *model.Role, settings *ExportSettings) (*roleResources, error) {
+	resources := &roleResources{
+		memoryLimit: role.Run.MemoryLimit,
+		cpuRequest:  role.Run.VirtualCPUs,
+		cpuLimit:    role.Run.VirtualCPUsLimit,
+	}
+	if settings.UseMemoryLimits || settings.QoS != "" {
+		resources.memoryRequest = role.Run.Memory
+	}
+
+	switch settings.QoS {
+	case "":
+	case QoSBurstable:
+		if resources.memoryRequest == 0 && resources.cpuRequest == 0 {
+			return nil, fmt.Errorf("Role %s has neither memory nor virtual-cpus, as needed for the Burstable QoS class", role.Name)
+		}
+	case QoSGuaranteed:
+		if resources.memoryLimit == 0 {
+			resources.memoryLimit = resources.memoryRequest
+		}
+		if resources.cpuLimit == 0 {
+			resources.cpuLimit = resources.cpuRequest
+		}
+		if resources.memoryLimit == 0 || resources.cpuLimit == 0 {
+			return nil, fmt.Errorf("Role %s needs both memory and virtual-cpus for the Guaranteed QoS class", role.Name)
+		}
+		resources.memoryRequest = resources.memoryLimit
+		resources.cpuRequest = resources.cpuLimit
+	default:
+		return nil, fmt.Errorf("Invalid QoS class %s, expected one of %s or %s", settings.QoS, QoSBurstable, QoSGuaranteed)
+	}
+
+	if resources.memoryLimit != 0 && resources.memoryLimit < resources.memoryRequest {
+		return nil, fmt.Errorf("Role %s has a memory limit of %dMi below its request of %dMi",
+			role.Name, resources.memoryLimit, resources.memoryRequest)
+	}
+	if resources.cpuLimit != 0 && resources.cpuLimit < resources.cpuRequest {
+		return nil, fmt.Errorf("Role %s has a limit of %g virtual CPUs below its request of %g",
+			role.Name, resources.cpuLimit, resources.cpuRequest)
+	}
+
+	return resources, nil
+}
+
+// getContainerResources returns the resource requirements of the containers
+// of a role
+func getContainerResources(role *model.Role, settings *ExportSettings) (v1.ResourceRequirements, error) {
+	var requirements v1.ResourceRequirements
+
+	resources, err := getRoleResources(role, settings)
+	if err != nil {
+		return requirements, err
+	}
+
+	add := func(list *v1.ResourceList, name v1.ResourceName, quantity *resource.Quantity) {
+		if *list == nil {
+			*list = v1.ResourceList{}
+		}
+		(*list)[name] = *quantity
+	}
+
+	// Memory requests are kept even if empty, so that helm charts can set them
+	if resources.memoryRequest != 0 || settings.UseMemoryLimits {
+		add(&requirements.Requests, v1.ResourceMemory, resource.NewQuantity(int64(resources.memoryRequest)*1024*1024, resource.BinarySI))
+	}
+	if resources.cpuRequest != 0 {
+		add(&requirements.Requests, v1.ResourceCPU, resource.NewMilliQuantity(int64(resources.cpuRequest*1000), resource.DecimalSI))
+	}
+	if resources.memoryLimit != 0 {
+		add(&requirements.Limits, v1.ResourceMemory, resource.NewQuantity(int64(resources.memoryLimit)*1024*1024, resource.BinarySI))
+	}
+	if resources.cpuLimit != 0 {
+		add(&requirements.Limits, v1.ResourceCPU, resource.NewMilliQuantity(int64(resources.cpuLimit*1000), resource.DecimalSI))
+	}
+
+	return requirements, nil
+}
+
 // getContainerImageName returns the name of the docker image to use for a role
 func getContainerImageName(role *model.Role, settings *ExportSettings) string {
-	devImageName := builder.GetRoleDevImageName(settings.Repository, role, role.GetRoleDevVersion())
+	devImageName := builder.GetRoleDevImageName(settings.Repository, settings.StemcellOS, role, role.GetRoleDevVersion())
+	if settings.CreateHelmChart {
+		// The registry and organization are taken from the values of the chart
+		return devImageName
+	}
 	imageName := devImageName
 
 	if settings.Organization != "" && settings.Registry != "" {
@@ -152,14 +261,14 @@ func getContainerPorts(role *model.Role) ([]v1.ContainerPort, error) {
 		}
 
 		// Convert port range specifications to port numbers
-		minInternalPort, maxInternalPort, err := parsePortRange(port.Internal, port.Name, "internal")
+		minInternalPort, maxInternalPort, err := model.ParsePortRange(port.Internal, port.Name, "internal")
 		if err != nil {
 			return nil, err
 		}
 		// The external port is optional here; we only need it if it's public
 		var minExternalPort, maxExternalPort int32
 		if port.External != "" {
-			minExternalPort, maxExternalPort, err = parsePortRange(port.External, port.Name, "external")
+			minExternalPort, maxExternalPort, err = model.ParsePortRange(port.External, port.Name, "external")
 			if err != nil {
 				return nil, err
 			}
@@ -171,7 +280,7 @@ func getContainerPorts(role *model.Role) ([]v1.ContainerPort, error) {
 
 		rangeSize := maxInternalPort - minInternalPort
 		suffixLength := 0
-		if rangeSize > 1 {
+		if rangeSize > 0 {
 			suffixLength = len(fmt.Sprintf("-%d", rangeSize))
 		}
 		if len(name)+suffixLength > 15 {
@@ -198,29 +307,58 @@ func getContainerPorts(role *model.Role) ([]v1.ContainerPort, error) {
 
 // getVolumeMounts gets the list of volume mounts for a role
 func getVolumeMounts(role *model.Role) []v1.VolumeMount {
-	resultLen := len(role.Run.PersistentVolumes) + len(role.Run.SharedVolumes)
+	resultLen := len(role.Run.PersistentVolumes) + len(role.Run.SharedVolumes) +
+		len(role.Run.EphemeralVolumes) + len(role.Run.HostPathVolumes)
 	result := make([]v1.VolumeMount, 0, resultLen)
 
-	for _, volume := range role.Run.PersistentVolumes {
-		result = append(result, v1.VolumeMount{
-			Name:      volume.Tag,
-			MountPath: volume.Path,
-			ReadOnly:  false,
+	for _, volumes := range [][]*model.RoleRunVolume{
+		role.Run.PersistentVolumes,
+		role.Run.SharedVolumes,
+		role.Run.EphemeralVolumes,
+		role.Run.HostPathVolumes,
+	} {
+		for _, volume := range volumes {
+			result = append(result, v1.VolumeMount{
+				Name:      volume.Tag,
+				MountPath: volume.Path,
+				ReadOnly:  false,
+			})
+		}
+	}
+
+	return result
+}
+
+// getVolumes returns the volumes of the pods of a role that are not claimed
+// by a stateful set: ephemeral volumes, possibly backed by memory, and host
+// path volumes
+func getVolumes(role *model.Role) []v1.Volume {
+	var result []v1.Volume
+
+	for _, volume := range role.Run.EphemeralVolumes {
+		source := &v1.EmptyDirVolumeSource{}
+		if volume.Memory {
+			source.Medium = v1.StorageMediumMemory
+		}
+		result = append(result, v1.Volume{
+			Name:         volume.Tag,
+			VolumeSource: v1.VolumeSource{EmptyDir: source},
 		})
 	}
 
-	for _, volume := range role.Run.SharedVolumes {
-		result = append(result, v1.VolumeMount{
-			Name:      volume.Tag,
-			MountPath: volume.Path,
-			ReadOnly:  false,
+	for _, volume := range role.Run.HostPathVolumes {
+		result = append(result, v1.Volume{
+			Name: volume.Tag,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{Path: volume.HostPath},
+			},
 		})
 	}
 
 	return result
 }
 
-func getEnvVars(role *model.Role, defaults map[string]string) ([]v1.EnvVar, error) {
+func getEnvVars(role *model.Role, settings *ExportSettings) ([]v1.EnvVar, error) {
 	configs, err := role.GetVariablesForRole()
 
 	if err != nil {
@@ -230,31 +368,39 @@ func getEnvVars(role *model.Role, defaults map[string]string) ([]v1.EnvVar, erro
 	result := make([]v1.EnvVar, 0, len(configs))
 
 	for _, config := range configs {
-		var value interface{}
-
-		value = config.Default
-
-		if defaultValue, ok := defaults[config.Name]; ok {
-			value = defaultValue
-		}
-
-		if value == nil {
+		// Helm charts hold all the variables, so that values can be given
+		// at install time
+		if _, ok := getVariableValue(config, settings.Defaults); !ok && !settings.CreateHelmChart {
 			continue
 		}
 
-		var stringifiedValue string
-		if valueAsString, ok := value.(string); ok {
-			stringifiedValue, err = strconv.Unquote(fmt.Sprintf(`"%s"`, valueAsString))
-			if err != nil {
-				stringifiedValue = valueAsString
+		// The values live in the secret and the config map, so that the
+		// manifests of the roles contain no values at all
+		source := &v1.EnvVarSource{}
+		if config.Secret {
+			source.SecretKeyRef = &v1.SecretKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: SecretName(settings.DeploymentName)},
+				Key:                  config.Name,
 			}
 		} else {
-			stringifiedValue = fmt.Sprintf("%v", value)
+			source.ConfigMapKeyRef = &v1.ConfigMapKeySelector{
+				LocalObjectReference: v1.LocalObjectReference{Name: ConfigMapName(settings.DeploymentName)},
+				Key:                  config.Name,
+			}
 		}
 
 		result = append(result, v1.EnvVar{
-			Name:  config.Name,
-			Value: stringifiedValue,
+			Name:      config.Name,
+			ValueFrom: source,
+		})
+	}
+
+	// The run script lists the instances of the roles providing links from
+	// their instance counts
+	for _, provider := range role.LinkProviderRoles() {
+		result = append(result, v1.EnvVar{
+			Name:  provider.LinkInstancesEnvVar(),
+			Value: strconv.Itoa(provider.InstanceCount()),
 		})
 	}
 
@@ -267,9 +413,67 @@ func getEnvVars(role *model.Role, defaults map[string]string) ([]v1.EnvVar, erro
 		},
 	})
 
+	result = append(result, v1.EnvVar{
+		Name: "KUBERNETES_POD_IP",
+		ValueFrom: &v1.EnvVarSource{
+			FieldRef: &v1.ObjectFieldSelector{
+				FieldPath: "status.podIP",
+			},
+		},
+	})
+
 	return result, nil
 }
 
+// GetVariableValues returns the values of the variables, taken from the
+// defaults or the role manifest, split into secret and non-secret ones.
+// Variables without a value are left out.
+func GetVariableValues(variables model.ConfigurationVariableSlice, defaults map[string]string) (secrets, config map[string]string) {
+	secrets = map[string]string{}
+	config = map[string]string{}
+
+	for _, variable := range variables {
+		value, ok := getVariableValue(variable, defaults)
+		if !ok {
+			continue
+		}
+
+		if variable.Secret {
+			secrets[variable.Name] = value
+		} else {
+			config[variable.Name] = value
+		}
+	}
+
+	return secrets, config
+}
+
+// getVariableValue returns the value of a variable as a string; the defaults
+// take precedence over the role manifest
+func getVariableValue(config *model.ConfigurationVariable, defaults map[string]string) (string, bool) {
+	var value interface{}
+
+	value = config.Default
+
+	if defaultValue, ok := defaults[config.Name]; ok {
+		value = defaultValue
+	}
+
+	if value == nil {
+		return "", false
+	}
+
+	if valueAsString, ok := value.(string); ok {
+		stringifiedValue, err := strconv.Unquote(fmt.Sprintf(`"%s"`, valueAsString))
+		if err != nil {
+			stringifiedValue = valueAsString
+		}
+		return stringifiedValue, true
+	}
+
+	return fmt.Sprintf("%v", value), true
+}
+
 func getSecurityContext(role *model.Role) *v1.SecurityContext {
 	privileged := true
 
@@ -292,82 +496,125 @@ func getSecurityContext(role *model.Role) *v1.SecurityContext {
 	return sc
 }
 
-func getContainerLivenessProbe(role *model.Role) *v1.Probe {
-	switch role.Type {
-	case model.RoleTypeBosh:
-		return &v1.Probe{
+// getContainerLivenessProbe returns the liveness probe of a role. BOSH roles
+// are checked through monit by default, once they had time to start; the
+// liveness section of the health check of a role replaces the check, and
+// tunes its timing.
+func getContainerLivenessProbe(role *model.Role) (*v1.Probe, error) {
+	var defaultProbe *v1.Probe
+	if role.Type == model.RoleTypeBosh {
+		defaultProbe = &v1.Probe{
 			Handler: v1.Handler{
 				TCPSocket: &v1.TCPSocketAction{
 					Port: intstr.FromInt(monitPort),
 				},
 			},
-			// TODO: make this configurable (figure out where the knob should live)
-			InitialDelaySeconds: 600,
+			InitialDelaySeconds: defaultLivenessInitialDelay,
 		}
-	default:
-		return nil
 	}
+	if role.Run == nil {
+		return defaultProbe, nil
+	}
+	return getContainerProbe(role, role.Run.HealthCheck.LivenessProbe(), defaultProbe)
 }
 
+// getContainerReadinessProbe returns the readiness probe of a role. BOSH roles
+// are checked on their first TCP port by default; the readiness section of the
+// health check of a role, or its shorthand, replaces the check, and tunes its
+// timing.
 func getContainerReadinessProbe(role *model.Role) (*v1.Probe, error) {
 	if role.Run == nil {
 		return nil, nil
 	}
-	if role.Run.HealthCheck != nil {
-		if role.Run.HealthCheck.URL != "" {
-			return getContainerURLReadinessProbe(role)
-		}
-		if role.Run.HealthCheck.Port != 0 {
-			return &v1.Probe{
-				Handler: v1.Handler{
-					TCPSocket: &v1.TCPSocketAction{
-						Port: intstr.FromInt(int(role.Run.HealthCheck.Port)),
-					},
-				},
-			}, nil
-		}
-		if len(role.Run.HealthCheck.Command) > 0 {
-			return &v1.Probe{
-				Handler: v1.Handler{
-					Exec: &v1.ExecAction{
-						Command: role.Run.HealthCheck.Command,
-					},
-				},
-			}, nil
-		}
+	defaultProbe, err := getContainerDefaultReadinessProbe(role)
+	if err != nil {
+		return nil, err
 	}
-	switch role.Type {
-	case model.RoleTypeBosh:
-		var readinessPort *model.RoleRunExposedPort
-		for _, port := range role.Run.ExposedPorts {
-			if strings.ToUpper(port.Protocol) != "TCP" {
-				continue
-			}
-			if readinessPort == nil {
-				readinessPort = port
-			}
+	return getContainerProbe(role, role.Run.HealthCheck.ReadinessProbe(), defaultProbe)
+}
+
+func getContainerDefaultReadinessProbe(role *model.Role) (*v1.Probe, error) {
+	if role.Type != model.RoleTypeBosh {
+		return nil, nil
+	}
+	var readinessPort *model.RoleRunExposedPort
+	for _, port := range role.Run.ExposedPorts {
+		if strings.ToUpper(port.Protocol) != "TCP" {
+			continue
 		}
 		if readinessPort == nil {
-			return nil, nil
+			readinessPort = port
 		}
-		probePort, _, err := parsePortRange(readinessPort.Internal, readinessPort.Name, "internal")
+	}
+	if readinessPort == nil {
+		return nil, nil
+	}
+	probePort, _, err := model.ParsePortRange(readinessPort.Internal, readinessPort.Name, "internal")
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Probe{
+		Handler: v1.Handler{
+			TCPSocket: &v1.TCPSocketAction{
+				Port: intstr.FromInt(int(probePort)),
+			},
+		},
+	}, nil
+}
+
+// getContainerProbe maps a health check probe of a role to a k8s probe,
+// starting from the default probe of the role. Probes without a check keep the
+// check of the default probe, and timing not given is kept from it.
+func getContainerProbe(role *model.Role, probe *model.HealthProbe, defaultProbe *v1.Probe) (*v1.Probe, error) {
+	if probe == nil {
+		return defaultProbe, nil
+	}
+
+	result := &v1.Probe{}
+	if defaultProbe != nil {
+		*result = *defaultProbe
+	}
+
+	if probe.URL != "" {
+		handler, err := getContainerURLProbeHandler(role, probe)
 		if err != nil {
 			return nil, err
 		}
-		return &v1.Probe{
-			Handler: v1.Handler{
-				TCPSocket: &v1.TCPSocketAction{
-					Port: intstr.FromInt(int(probePort)),
-				},
+		result.Handler = *handler
+	} else if probe.Port != 0 {
+		result.Handler = v1.Handler{
+			TCPSocket: &v1.TCPSocketAction{
+				Port: intstr.FromInt(int(probe.Port)),
 			},
-		}, nil
-	default:
+		}
+	} else if len(probe.Command) > 0 {
+		result.Handler = v1.Handler{
+			Exec: &v1.ExecAction{
+				Command: probe.Command,
+			},
+		}
+	} else if defaultProbe == nil {
+		// There is nothing to check
 		return nil, nil
 	}
+
+	if probe.InitialDelay != 0 {
+		result.InitialDelaySeconds = probe.InitialDelay
+	}
+	if probe.Period != 0 {
+		result.PeriodSeconds = probe.Period
+	}
+	if probe.Timeout != 0 {
+		result.TimeoutSeconds = probe.Timeout
+	}
+	if probe.FailureThreshold != 0 {
+		result.FailureThreshold = probe.FailureThreshold
+	}
+	return result, nil
 }
 
-func getContainerURLReadinessProbe(role *model.Role) (*v1.Probe, error) {
-	probeURL, err := url.Parse(role.Run.HealthCheck.URL)
+func getContainerURLProbeHandler(role *model.Role, probe *model.HealthProbe) (*v1.Handler, error) {
+	probeURL, err := url.Parse(probe.URL)
 	if err != nil {
 		return nil, fmt.Errorf("Invalid URL health check for %s: %s", role.Name, err)
 	}
@@ -407,7 +654,7 @@ func getContainerURLReadinessProbe(role *model.Role) (*v1.Probe, error) {
 			Value: base64.StdEncoding.EncodeToString([]byte(probeURL.User.String())),
 		})
 	}
-	for key, value := range role.Run.HealthCheck.Headers {
+	for key, value := range probe.Headers {
 		headers = append(headers, v1.HTTPHeader{
 			Name:  http.CanonicalHeaderKey(key),
 			Value: value,
@@ -421,15 +668,13 @@ func getContainerURLReadinessProbe(role *model.Role) (*v1.Probe, error) {
 	}
 	// probeURL.Fragment should not be sent to the server, so we ignore it here
 
-	return &v1.Probe{
-		Handler: v1.Handler{
-			HTTPGet: &v1.HTTPGetAction{
-				Host:        host,
-				Port:        port,
-				Path:        path,
-				Scheme:      scheme,
-				HTTPHeaders: headers,
-			},
+	return &v1.Handler{
+		HTTPGet: &v1.HTTPGetAction{
+			Host:        host,
+			Port:        port,
+			Path:        path,
+			Scheme:      scheme,
+			HTTPHeaders: headers,
 		},
 	}, nil
 }
@@ -22,7 +22,7 @@ func podTestLoadRole(assert *assert.Assertions) *model.Role {
 	manifestPath := filepath.Join(workDir, "../test-assets/role-manifests/volumes.yml")
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	if !assert.NoError(err) {
 		return nil
 	}
@@ -53,7 +53,10 @@ func TestPodGetVolumes(t *testing.T) {
 		return
 	}
 
-	claims := getVolumeClaims(role)
+	claims, err := getVolumeClaims(role, &ExportSettings{})
+	if !assert.NoError(err) {
+		return
+	}
 
 	assert.Len(claims, 2, "expected two claims")
 
@@ -98,6 +101,74 @@ func TestPodGetVolumes(t *testing.T) {
 	}
 }
 
+func TestPodGetVolumesStorageClasses(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	role.Run.PersistentVolumes[0].Size = "500Mi"
+	role.Run.SharedVolumes[0].StorageClass = "nfs"
+	settings := &ExportSettings{
+		PersistentStorageClass: "ssd",
+		SharedStorageClass:     "gluster",
+	}
+
+	claims, err := getVolumeClaims(role, settings)
+	if !assert.NoError(err) || !assert.Len(claims, 2) {
+		return
+	}
+
+	assert.Equal("ssd", claims[0].Annotations[VolumeStorageClassAnnotation], "Storage classes should default to the settings")
+	quantity := claims[0].Spec.Resources.Requests[v1.ResourceStorage]
+	assert.Equal("500Mi", quantity.String())
+	assert.Equal("nfs", claims[1].Annotations[VolumeStorageClassAnnotation], "Volumes should override the storage class")
+
+	role.Run.PersistentVolumes[0].Size = "lots"
+	_, err = getVolumeClaims(role, settings)
+	assert.EqualError(err, "Invalid size of volume persistent-volume of role myrole: quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'")
+}
+
+func TestPodGetPodVolumes(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	assert.Empty(getVolumes(role), "Claimed volumes are not pod volumes")
+
+	role.Run.EphemeralVolumes = []*model.RoleRunVolume{
+		{Path: "/var/tmp", Tag: "scratch"},
+		{Path: "/var/cache", Tag: "cache", Memory: true},
+	}
+	role.Run.HostPathVolumes = []*model.RoleRunVolume{
+		{Path: "/var/run/docker.sock", Tag: "docker-socket", HostPath: "/var/run/docker.sock"},
+	}
+
+	assert.Equal([]v1.Volume{
+		{
+			Name:         "scratch",
+			VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}},
+		},
+		{
+			Name:         "cache",
+			VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{Medium: v1.StorageMediumMemory}},
+		},
+		{
+			Name:         "docker-socket",
+			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/run/docker.sock"}},
+		},
+	}, getVolumes(role))
+
+	volumeMounts := getVolumeMounts(role)
+	if assert.Len(volumeMounts, 5) {
+		assert.Equal(v1.VolumeMount{Name: "cache", MountPath: "/var/cache"}, volumeMounts[3])
+		assert.Equal(v1.VolumeMount{Name: "docker-socket", MountPath: "/var/run/docker.sock"}, volumeMounts[4])
+	}
+}
+
 func TestPodGetVolumeMounts(t *testing.T) {
 	assert := assert.New(t)
 	role := podTestLoadRole(assert)
@@ -166,7 +237,7 @@ func TestPodGetEnvVars(t *testing.T) {
 	for _, sample := range samples {
 		defaults := map[string]string{"SOME_VAR": sample.input}
 
-		vars, err := getEnvVars(role, defaults)
+		vars, err := getEnvVars(role, &ExportSettings{Defaults: defaults})
 		assert.NoError(err)
 		assert.NotEmpty(vars)
 
@@ -174,13 +245,71 @@ func TestPodGetEnvVars(t *testing.T) {
 		for _, result := range vars {
 			if result.Name == "SOME_VAR" {
 				found = true
-				assert.Equal(sample.expected, result.Value)
+				assert.Empty(result.Value, "Values should not be in the role manifests")
+				if assert.NotNil(result.ValueFrom) && assert.NotNil(result.ValueFrom.ConfigMapKeyRef) {
+					assert.Equal("config", result.ValueFrom.ConfigMapKeyRef.Name)
+					assert.Equal("SOME_VAR", result.ValueFrom.ConfigMapKeyRef.Key)
+				}
 			}
 		}
 		assert.True(found, "failed to find expected variable")
+
+		variables, err := role.GetVariablesForRole()
+		assert.NoError(err)
+		secrets, config := GetVariableValues(variables, defaults)
+		assert.Empty(secrets)
+		assert.Equal(sample.expected, config["SOME_VAR"], sample.desc)
 	}
 }
 
+func TestPodGetEnvVarsSecret(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	role.Jobs[0].Properties = []*model.JobProperty{
+		&model.JobProperty{
+			Name: "some-property",
+		},
+	}
+	role.Configuration.Templates["property.some-property"] = "((SOME_VAR))"
+
+	variables, err := role.GetVariablesForRole()
+	if !assert.NoError(err) {
+		return
+	}
+	for _, variable := range variables {
+		if variable.Name == "SOME_VAR" {
+			variable.Secret = true
+		}
+	}
+
+	defaults := map[string]string{"SOME_VAR": "hunter2"}
+	vars, err := getEnvVars(role, &ExportSettings{Defaults: defaults, DeploymentName: "mycf"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	found := false
+	for _, result := range vars {
+		if result.Name == "SOME_VAR" {
+			found = true
+			if assert.NotNil(result.ValueFrom) && assert.NotNil(result.ValueFrom.SecretKeyRef) {
+				assert.Equal("mycf-secrets", result.ValueFrom.SecretKeyRef.Name)
+				assert.Equal("SOME_VAR", result.ValueFrom.SecretKeyRef.Key)
+			}
+			assert.Nil(result.ValueFrom.ConfigMapKeyRef)
+		}
+	}
+	assert.True(found, "failed to find expected variable")
+
+	secrets, config := GetVariableValues(variables, defaults)
+	assert.Equal(map[string]string{"SOME_VAR": "hunter2"}, secrets)
+	assert.NotContains(config, "SOME_VAR")
+}
+
 func TestPodGetContainerPorts(t *testing.T) {
 	assert := assert.New(t)
 	role := podTestLoadRole(assert)
@@ -513,3 +642,209 @@ func TestPodGetContainerReadinessProbe(t *testing.T) {
 		}
 	}
 }
+
+func TestPodGetContainerLivenessProbe(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	monitHandler := v1.Handler{
+		TCPSocket: &v1.TCPSocketAction{
+			Port: intstr.FromInt(2289),
+		},
+	}
+
+	samples := []struct {
+		desc     string
+		probe    *model.HealthProbe
+		expected *v1.Probe
+	}{
+		{
+			desc:     "Default probe",
+			probe:    nil,
+			expected: &v1.Probe{Handler: monitHandler, InitialDelaySeconds: 600},
+		},
+		{
+			desc: "Default probe with custom timing",
+			probe: &model.HealthProbe{
+				InitialDelay:     120,
+				Period:           30,
+				Timeout:          5,
+				FailureThreshold: 6,
+			},
+			expected: &v1.Probe{
+				Handler:             monitHandler,
+				InitialDelaySeconds: 120,
+				PeriodSeconds:       30,
+				TimeoutSeconds:      5,
+				FailureThreshold:    6,
+			},
+		},
+		{
+			desc: "Command probe",
+			probe: &model.HealthProbe{
+				Command: []string{"/bin/true"},
+				Period:  10,
+			},
+			expected: &v1.Probe{
+				Handler: v1.Handler{
+					Exec: &v1.ExecAction{
+						Command: []string{"/bin/true"},
+					},
+				},
+				InitialDelaySeconds: 600,
+				PeriodSeconds:       10,
+			},
+		},
+	}
+
+	for _, sample := range samples {
+		role.Run.HealthCheck = &model.HealthCheck{Liveness: sample.probe}
+		actual, err := getContainerLivenessProbe(role)
+		if assert.NoError(err, sample.desc) {
+			assert.Equal(sample.expected, actual, sample.desc)
+		}
+	}
+
+	role.Run.HealthCheck = &model.HealthCheck{Liveness: &model.HealthProbe{Period: 10}}
+	role.Type = model.RoleTypeBoshTask
+	actual, err := getContainerLivenessProbe(role)
+	if assert.NoError(err) {
+		assert.Nil(actual, "Tasks have nothing to check by default")
+	}
+}
+
+func TestPodGetContainerReadinessProbeSection(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	role.Run.HealthCheck = &model.HealthCheck{
+		Readiness: &model.HealthProbe{
+			URL:              "http://container-ip:8080/health",
+			InitialDelay:     10,
+			FailureThreshold: 3,
+		},
+	}
+	actual, err := getContainerReadinessProbe(role)
+	if assert.NoError(err) {
+		assert.Equal(&v1.Probe{
+			Handler: v1.Handler{
+				HTTPGet: &v1.HTTPGetAction{
+					Scheme: v1.URISchemeHTTP,
+					Port:   intstr.FromInt(8080),
+					Path:   "/health",
+				},
+			},
+			InitialDelaySeconds: 10,
+			FailureThreshold:    3,
+		}, actual)
+	}
+
+	// Timing of the default readiness probe, on the first TCP port
+	role.Run.ExposedPorts = []*model.RoleRunExposedPort{{Name: "http", Protocol: "TCP", External: "80", Internal: "8080"}}
+	role.Run.HealthCheck = &model.HealthCheck{Readiness: &model.HealthProbe{Timeout: 3}}
+	actual, err = getContainerReadinessProbe(role)
+	if assert.NoError(err) {
+		assert.Equal(&v1.Probe{
+			Handler: v1.Handler{
+				TCPSocket: &v1.TCPSocketAction{
+					Port: intstr.FromInt(8080),
+				},
+			},
+			TimeoutSeconds: 3,
+		}, actual)
+	}
+}
+
+func TestPodGetContainerResources(t *testing.T) {
+	assert := assert.New(t)
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	samples := []struct {
+		desc     string
+		run      model.RoleRun
+		settings ExportSettings
+		requests map[string]string
+		limits   map[string]string
+		err      string
+	}{
+		{
+			desc:     "Memory is only requested with memory limits",
+			run:      model.RoleRun{Memory: 256, VirtualCPUs: 0.5},
+			requests: map[string]string{"cpu": "500m"},
+		},
+		{
+			desc:     "Requests and limits are taken from the role manifest",
+			run:      model.RoleRun{Memory: 256, MemoryLimit: 512, VirtualCPUs: 1, VirtualCPUsLimit: 2},
+			settings: ExportSettings{UseMemoryLimits: true},
+			requests: map[string]string{"memory": "256Mi", "cpu": "1"},
+			limits:   map[string]string{"memory": "512Mi", "cpu": "2"},
+		},
+		{
+			desc:     "Burstable pods request memory",
+			run:      model.RoleRun{Memory: 256},
+			settings: ExportSettings{QoS: QoSBurstable},
+			requests: map[string]string{"memory": "256Mi"},
+		},
+		{
+			desc:     "Burstable pods need requests",
+			run:      model.RoleRun{MemoryLimit: 256},
+			settings: ExportSettings{QoS: QoSBurstable},
+			err:      "Role myrole has neither memory nor virtual-cpus, as needed for the Burstable QoS class",
+		},
+		{
+			desc:     "Guaranteed pods request their limits",
+			run:      model.RoleRun{Memory: 256, MemoryLimit: 512, VirtualCPUs: 0.25},
+			settings: ExportSettings{QoS: QoSGuaranteed},
+			requests: map[string]string{"memory": "512Mi", "cpu": "250m"},
+			limits:   map[string]string{"memory": "512Mi", "cpu": "250m"},
+		},
+		{
+			desc:     "Guaranteed pods need memory and CPUs",
+			run:      model.RoleRun{Memory: 256},
+			settings: ExportSettings{QoS: QoSGuaranteed},
+			err:      "Role myrole needs both memory and virtual-cpus for the Guaranteed QoS class",
+		},
+		{
+			desc: "Limits can't be below requests",
+			run:  model.RoleRun{VirtualCPUs: 2, VirtualCPUsLimit: 1},
+			err:  "Role myrole has a limit of 1 virtual CPUs below its request of 2",
+		},
+	}
+
+	for _, sample := range samples {
+		run := sample.run
+		role.Run = &run
+		actual, err := getContainerResources(role, &sample.settings)
+		if sample.err != "" {
+			assert.EqualError(err, sample.err, sample.desc)
+			continue
+		}
+		if !assert.NoError(err, sample.desc) {
+			continue
+		}
+
+		for _, expected := range []struct {
+			values map[string]string
+			list   v1.ResourceList
+		}{{sample.requests, actual.Requests}, {sample.limits, actual.Limits}} {
+			values := map[string]string{}
+			for name, quantity := range expected.list {
+				values[string(name)] = quantity.String()
+			}
+			if expected.values == nil {
+				assert.Empty(values, sample.desc)
+			} else {
+				assert.Equal(expected.values, values, sample.desc)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package kube
+
+import (
+	"github.com/hpcloud/fissile/model"
+
+	meta "k8s.io/client-go/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/runtime"
+)
+
+// RBACRole is a rbac.authorization.k8s.io/v1beta1 Role; the vendored client
+// has no types for the rbac API group
+type RBACRole struct {
+	meta.TypeMeta    `json:",inline"`
+	apiv1.ObjectMeta `json:"metadata,omitempty"`
+	Rules            []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is a rule of a RBACRole
+type PolicyRule struct {
+	APIGroups []string `json:"apiGroups"`
+	Resources []string `json:"resources"`
+	Verbs     []string `json:"verbs"`
+}
+
+// RoleBinding is a rbac.authorization.k8s.io/v1beta1 RoleBinding
+type RoleBinding struct {
+	meta.TypeMeta    `json:",inline"`
+	apiv1.ObjectMeta `json:"metadata,omitempty"`
+	Subjects         []RoleBindingSubject `json:"subjects"`
+	RoleRef          RoleRef              `json:"roleRef"`
+}
+
+// RoleBindingSubject is who a RoleBinding grants its role to
+type RoleBindingSubject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// RoleRef is the role granted by a RoleBinding
+type RoleRef struct {
+	APIGroup string `json:"apiGroup"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+}
+
+// NewWaitRBAC creates the service account of the pods of a role whose init
+// containers query the kube API, with a role granting read access to what
+// they wait for, and the binding between the two. All are named after the
+// role. Nothing is returned for roles that don't wait through the API.
+func NewWaitRBAC(role *model.Role) *apiv1.List {
+	rules := getWaitPolicyRules(role)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	labels := map[string]string{RoleNameLabel: role.Name}
+
+	serviceAccount := &apiv1.ServiceAccount{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ServiceAccount",
+		},
+		ObjectMeta: apiv1.ObjectMeta{Name: role.Name, Labels: labels},
+	}
+
+	rbacRole := &RBACRole{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "rbac.authorization.k8s.io/v1beta1",
+			Kind:       "Role",
+		},
+		ObjectMeta: apiv1.ObjectMeta{Name: role.Name, Labels: labels},
+		Rules:      rules,
+	}
+
+	binding := &RoleBinding{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "rbac.authorization.k8s.io/v1beta1",
+			Kind:       "RoleBinding",
+		},
+		ObjectMeta: apiv1.ObjectMeta{Name: role.Name, Labels: labels},
+		Subjects:   []RoleBindingSubject{{Kind: "ServiceAccount", Name: role.Name}},
+		RoleRef: RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     role.Name,
+		},
+	}
+
+	return &apiv1.List{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "List",
+		},
+		Items: []runtime.RawExtension{
+			{Object: serviceAccount},
+			{Object: rbacRole},
+			{Object: binding},
+		},
+	}
+}
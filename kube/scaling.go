@@ -0,0 +1,128 @@
+package kube
+
+import (
+	"github.com/hpcloud/fissile/model"
+
+	"k8s.io/client-go/pkg/api"
+	meta "k8s.io/client-go/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/autoscaling"
+	"k8s.io/client-go/pkg/runtime"
+	"k8s.io/client-go/pkg/util/intstr"
+)
+
+// NewHorizontalPodAutoscaler creates an autoscaler scaling the pods of a role,
+// managed by the deployment or stateful set of the given type, between its
+// minimum and maximum scale. Nothing is returned for roles that can't scale.
+func NewHorizontalPodAutoscaler(role *model.Role, target meta.TypeMeta) *autoscaling.HorizontalPodAutoscaler {
+	if role.Type != model.RoleTypeBosh || role.Run == nil || role.Run.Scaling == nil {
+		return nil
+	}
+	scaling := role.Run.Scaling
+	if scaling.Max <= scaling.Min {
+		return nil
+	}
+
+	minReplicas := scaling.Min
+	return &autoscaling.HorizontalPodAutoscaler{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "autoscaling/v1",
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: api.ObjectMeta{
+			Name: role.Name,
+			Labels: map[string]string{
+				RoleNameLabel: role.Name,
+			},
+		},
+		Spec: autoscaling.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+				APIVersion: target.APIVersion,
+				Kind:       target.Kind,
+				Name:       role.Name,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: scaling.Max,
+		},
+	}
+}
+
+// PodDisruptionBudget is a policy/v1beta1 PodDisruptionBudget; the vendored
+// client has no types for the policy API group
+type PodDisruptionBudget struct {
+	meta.TypeMeta    `json:",inline"`
+	apiv1.ObjectMeta `json:"metadata,omitempty"`
+	Spec             PodDisruptionBudgetSpec `json:"spec"`
+}
+
+// PodDisruptionBudgetSpec is the spec of a PodDisruptionBudget; only one of
+// MinAvailable and MaxUnavailable is set
+type PodDisruptionBudgetSpec struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	Selector       *meta.LabelSelector `json:"selector"`
+}
+
+// NewPodDisruptionBudget creates a disruption budget for the pods of a role
+// that can scale above one pod or is clustered. Voluntary disruptions, like
+// draining nodes, may take down one pod at a time, or as many as clustered
+// roles can lose while keeping a majority of their pods; clustered roles with
+// a single pod keep it. Roles that may scale down to a single pod can't keep
+// any minimum, so they may lose one pod at a time, too. Nothing is returned
+// for other roles with a single pod.
+func NewPodDisruptionBudget(role *model.Role) *PodDisruptionBudget {
+	if role.Type != model.RoleTypeBosh || role.Run == nil {
+		return nil
+	}
+	scaling := role.Run.Scaling
+	if scaling == nil {
+		scaling = &model.RoleRunScaling{Min: 1, Max: 1}
+	}
+	clustered := role.HasTag("clustered")
+	if scaling.Max <= 1 && !clustered {
+		return nil
+	}
+
+	spec := PodDisruptionBudgetSpec{
+		Selector: &meta.LabelSelector{
+			MatchLabels: map[string]string{RoleNameLabel: role.Name},
+		},
+	}
+
+	minAvailable := scaling.Min - 1
+	if clustered {
+		minAvailable = scaling.Min/2 + 1
+	}
+	if scaling.Min > 1 || scaling.Max <= 1 {
+		value := intstr.FromInt(int(minAvailable))
+		spec.MinAvailable = &value
+	} else {
+		value := intstr.FromInt(1)
+		spec.MaxUnavailable = &value
+	}
+
+	return &PodDisruptionBudget{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "policy/v1beta1",
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: apiv1.ObjectMeta{
+			Name: role.Name,
+			Labels: map[string]string{
+				RoleNameLabel: role.Name,
+			},
+		},
+		Spec: spec,
+	}
+}
+
+// addScalingObjects adds the autoscaler and the disruption budget of a role
+// to a list, for roles that need them
+func addScalingObjects(list *apiv1.List, role *model.Role, target meta.TypeMeta) {
+	if autoscaler := NewHorizontalPodAutoscaler(role, target); autoscaler != nil {
+		list.Items = append(list.Items, runtime.RawExtension{Object: autoscaler})
+	}
+	if budget := NewPodDisruptionBudget(role); budget != nil {
+		list.Items = append(list.Items, runtime.RawExtension{Object: budget})
+	}
+}
@@ -0,0 +1,153 @@
+package kube
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+	meta "k8s.io/client-go/pkg/api/unversioned"
+)
+
+func scalingTestRole(min, max int32, tags ...string) *model.Role {
+	return &model.Role{
+		Name: "myrole",
+		Type: model.RoleTypeBosh,
+		Tags: tags,
+		Run: &model.RoleRun{
+			Scaling: &model.RoleRunScaling{Min: min, Max: max},
+		},
+	}
+}
+
+func TestHorizontalPodAutoscaler(t *testing.T) {
+	assert := assert.New(t)
+
+	deployment := meta.TypeMeta{APIVersion: "extensions/v1beta1", Kind: "Deployment"}
+	statefulSet := meta.TypeMeta{APIVersion: "apps/v1beta1", Kind: "StatefulSet"}
+
+	assert.Nil(NewHorizontalPodAutoscaler(scalingTestRole(2, 2), deployment), "Roles that can't scale need no autoscaler")
+
+	autoscaler := NewHorizontalPodAutoscaler(scalingTestRole(1, 3), deployment)
+	if assert.NotNil(autoscaler) {
+		assert.Equal("Deployment", autoscaler.Spec.ScaleTargetRef.Kind)
+		assert.Equal("myrole", autoscaler.Spec.ScaleTargetRef.Name)
+		if assert.NotNil(autoscaler.Spec.MinReplicas) {
+			assert.Equal(int32(1), *autoscaler.Spec.MinReplicas)
+		}
+		assert.Equal(int32(3), autoscaler.Spec.MaxReplicas)
+	}
+
+	autoscaler = NewHorizontalPodAutoscaler(scalingTestRole(3, 5, "clustered"), statefulSet)
+	if assert.NotNil(autoscaler) {
+		assert.Equal("apps/v1beta1", autoscaler.Spec.ScaleTargetRef.APIVersion)
+		assert.Equal("StatefulSet", autoscaler.Spec.ScaleTargetRef.Kind)
+	}
+
+	task := scalingTestRole(1, 3)
+	task.Type = model.RoleTypeBoshTask
+	assert.Nil(NewHorizontalPodAutoscaler(task, deployment), "Tasks are not scaled")
+}
+
+func TestPodDisruptionBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	unscaled := scalingTestRole(1, 1, "clustered")
+	unscaled.Run.Scaling = nil
+
+	samples := []struct {
+		desc           string
+		role           *model.Role
+		minAvailable   int
+		maxUnavailable int
+	}{
+		{"Roles with a single pod need no budget", scalingTestRole(1, 1), 0, 0},
+		{"Clustered roles with a single pod keep it", scalingTestRole(1, 1, "clustered"), 1, 0},
+		{"Clustered roles without scaling keep their pod", unscaled, 1, 0},
+		{"Roles scaling up from a single pod may lose one pod", scalingTestRole(1, 3), 0, 1},
+		{"Clustered roles scaling up from a single pod may lose one pod", scalingTestRole(1, 3, "clustered"), 0, 1},
+		{"Scaled roles may lose one pod", scalingTestRole(3, 5), 2, 0},
+		{"Clustered roles keep a majority", scalingTestRole(5, 5, "clustered"), 3, 0},
+		{"Small clustered roles keep all pods", scalingTestRole(2, 2, "clustered"), 2, 0},
+	}
+
+	for _, sample := range samples {
+		budget := NewPodDisruptionBudget(sample.role)
+		if sample.minAvailable == 0 && sample.maxUnavailable == 0 {
+			assert.Nil(budget, sample.desc)
+			continue
+		}
+		if !assert.NotNil(budget, sample.desc) {
+			continue
+		}
+		if sample.minAvailable == 0 {
+			assert.Nil(budget.Spec.MinAvailable, sample.desc)
+		} else if assert.NotNil(budget.Spec.MinAvailable, sample.desc) {
+			assert.Equal(sample.minAvailable, budget.Spec.MinAvailable.IntValue(), sample.desc)
+		}
+		if sample.maxUnavailable == 0 {
+			assert.Nil(budget.Spec.MaxUnavailable, sample.desc)
+		} else if assert.NotNil(budget.Spec.MaxUnavailable, sample.desc) {
+			assert.Equal(sample.maxUnavailable, budget.Spec.MaxUnavailable.IntValue(), sample.desc)
+		}
+	}
+}
+
+func TestScalingObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	role := podTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+	role.Run.Scaling = &model.RoleRunScaling{Min: 3, Max: 5}
+	role.Run.ExposedPorts = []*model.RoleRunExposedPort{{Name: "http", External: "80", Internal: "8080"}}
+
+	_, deps, err := NewStatefulSet(role, &ExportSettings{})
+	if !assert.NoError(err) {
+		return
+	}
+
+	yamlConfig := bytes.Buffer{}
+	if err := WriteYamlConfig(deps, &yamlConfig); !assert.NoError(err) {
+		return
+	}
+	var expected, actual interface{}
+	if !assert.NoError(yaml.Unmarshal(yamlConfig.Bytes(), &actual)) {
+		return
+	}
+	expectedYAML := `---
+items:
+- kind: Service
+  metadata:
+    name: myrole
+- kind: Service
+  metadata:
+    name: myrole-pod
+- apiVersion: autoscaling/v1
+  kind: HorizontalPodAutoscaler
+  metadata:
+    name: myrole
+  spec:
+    scaleTargetRef:
+      apiVersion: apps/v1beta1
+      kind: StatefulSet
+      name: myrole
+    minReplicas: 3
+    maxReplicas: 5
+- apiVersion: policy/v1beta1
+  kind: PodDisruptionBudget
+  metadata:
+    name: myrole
+  spec:
+    minAvailable: 2
+    selector:
+      matchLabels:
+        skiff-role-name: myrole
+`
+	if assert.NoError(yaml.Unmarshal([]byte(expectedYAML), &expected)) {
+		isYAMLSubset(assert, expected, actual, []string{})
+	}
+}
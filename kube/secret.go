@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	meta "k8s.io/client-go/pkg/api/unversioned"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SecretName returns the name of the secret holding the values of the secret
+// configuration variables of a deployment, so that several deployments can
+// live in the same namespace
+func SecretName(deploymentName string) string {
+	if deploymentName == "" {
+		return "secrets"
+	}
+	return fmt.Sprintf("%s-secrets", deploymentName)
+}
+
+// NewSecret creates a new k8s secret holding the given values
+func NewSecret(name string, values map[string]string) *apiv1.Secret {
+	secret := &apiv1.Secret{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: apiv1.ObjectMeta{
+			Name: name,
+		},
+		Type: apiv1.SecretTypeOpaque,
+		Data: make(map[string][]byte, len(values)),
+	}
+
+	for key, value := range values {
+		secret.Data[key] = []byte(value)
+	}
+
+	return secret
+}
+
+// ReadSecretValues returns the values of a secret, as written by WriteYamlConfig
+func ReadSecretValues(reader io.Reader) (map[string]string, error) {
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Kind string            `yaml:"kind"`
+		Data map[string]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal(contents, &secret); err != nil {
+		return nil, err
+	}
+	if secret.Kind != "Secret" {
+		return nil, fmt.Errorf("Expected a Secret, got a %s", secret.Kind)
+	}
+
+	values := make(map[string]string, len(secret.Data))
+	for key, encoded := range secret.Data {
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding value of %s: %s", key, err.Error())
+		}
+		values[key] = string(value)
+	}
+
+	return values, nil
+}
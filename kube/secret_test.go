@@ -0,0 +1,36 @@
+package kube
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	values := map[string]string{
+		"PASSWORD": "hunter2",
+		"CERT":     "-----BEGIN CERTIFICATE-----\nabc\n-----END CERTIFICATE-----\n",
+	}
+
+	secret := NewSecret(SecretName("mycf"), values)
+	assert.Equal("mycf-secrets", secret.ObjectMeta.Name)
+	assert.Equal([]byte("hunter2"), secret.Data["PASSWORD"])
+
+	yamlConfig := &bytes.Buffer{}
+	if !assert.NoError(WriteYamlConfig(secret, yamlConfig)) {
+		return
+	}
+	assert.NotContains(yamlConfig.String(), "hunter2", "Values should be base64 encoded")
+
+	actual, err := ReadSecretValues(yamlConfig)
+	if assert.NoError(err) {
+		assert.Equal(values, actual)
+	}
+
+	_, err = ReadSecretValues(strings.NewReader("kind: ConfigMap\n"))
+	assert.EqualError(err, "Expected a Secret, got a ConfigMap")
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/hpcloud/fissile/model"
 	meta "k8s.io/client-go/pkg/api/unversioned"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/runtime"
 	"k8s.io/client-go/pkg/util/intstr"
 )
 
@@ -43,7 +44,7 @@ func NewClusterIPService(role *model.Role, headless bool) (*apiv1.Service, error
 		if strings.ToUpper(portDef.Protocol) == "UDP" {
 			protocol = apiv1.ProtocolUDP
 		}
-		minPort, maxPort, err := parsePortRange(portDef.External, portDef.Name, "external")
+		minPort, maxPort, err := model.ParsePortRange(portDef.External, portDef.Name, "external")
 		if err != nil {
 			return nil, err
 		}
@@ -58,9 +59,184 @@ func NewClusterIPService(role *model.Role, headless bool) (*apiv1.Service, error
 			}
 			service.Spec.Ports = append(service.Spec.Ports, svcPort)
 		}
-		if portDef.Public {
-			service.Spec.ExternalIPs = []string{"192.168.77.77"} // TODO Make this work on not-vagrant
+	}
+	return service, nil
+}
+
+// getPublicExposure returns how the public ports of a role are exposed, and
+// the external IPs to expose them on; the role manifest takes precedence over
+// the settings
+func getPublicExposure(role *model.Role, settings *ExportSettings) (model.PublicExposure, []string) {
+	exposure := settings.PublicExposure
+	externalIPs := settings.ExternalIPs
+
+	if public := role.Run.PublicExposure; public != nil {
+		if public.Type != "" {
+			exposure = public.Type
+		}
+		if len(public.ExternalIPs) > 0 {
+			externalIPs = public.ExternalIPs
+		}
+	}
+
+	if exposure == "" {
+		exposure = model.PublicExposureExternalIPs
+	}
+
+	return exposure, externalIPs
+}
+
+// NewPublicService creates a service exposing the public ports of a role
+// outside of the cluster, as a load balancer, on node ports, or on external
+// IPs. Nothing is returned for roles without public ports, or exposed through
+// an ingress instead; roles exposed on external IPs need some.
+func NewPublicService(role *model.Role, settings *ExportSettings) (*apiv1.Service, error) {
+	exposure, externalIPs := getPublicExposure(role, settings)
+
+	service := &apiv1.Service{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Service",
+		},
+		ObjectMeta: apiv1.ObjectMeta{
+			Name: fmt.Sprintf("%s-public", role.Name),
+		},
+		Spec: apiv1.ServiceSpec{
+			Selector: map[string]string{
+				RoleNameLabel: role.Name,
+			},
+		},
+	}
+
+	switch exposure {
+	case model.PublicExposureLoadBalancer:
+		service.Spec.Type = apiv1.ServiceTypeLoadBalancer
+	case model.PublicExposureNodePort:
+		service.Spec.Type = apiv1.ServiceTypeNodePort
+	case model.PublicExposureExternalIPs:
+		service.Spec.Type = apiv1.ServiceTypeClusterIP
+		service.Spec.ExternalIPs = externalIPs
+	case model.PublicExposureIngress:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Role %s has an invalid public exposure %s", role.Name, exposure)
+	}
+
+	// The container ports carry the names the service ports refer to, in
+	// the order of the exposed ports
+	containerPorts, err := getContainerPorts(role)
+	if err != nil {
+		return nil, err
+	}
+
+	index := 0
+	for _, portDef := range role.Run.ExposedPorts {
+		minInternalPort, maxInternalPort, err := model.ParsePortRange(portDef.Internal, portDef.Name, "internal")
+		if err != nil {
+			return nil, err
+		}
+		rangeSize := maxInternalPort - minInternalPort
+		ports := containerPorts[index : index+int(rangeSize)+1]
+		index += len(ports)
+
+		if !portDef.Public {
+			continue
+		}
+
+		minExternalPort, _, err := model.ParsePortRange(portDef.External, portDef.Name, "external")
+		if err != nil {
+			return nil, err
+		}
+
+		var minNodePort int32
+		if portDef.NodePort != "" && service.Spec.Type != apiv1.ServiceTypeClusterIP {
+			var maxNodePort int32
+			minNodePort, maxNodePort, err = model.ParsePortRange(portDef.NodePort, portDef.Name, "node")
+			if err != nil {
+				return nil, err
+			}
+			if maxNodePort-minNodePort != rangeSize {
+				return nil, fmt.Errorf("Port %s has mismatched internal and node port ranges %s and %s",
+					portDef.Name, portDef.Internal, portDef.NodePort)
+			}
+		}
+
+		for i, port := range ports {
+			svcPort := apiv1.ServicePort{
+				Name:       port.Name,
+				Port:       minExternalPort + int32(i),
+				Protocol:   port.Protocol,
+				TargetPort: intstr.FromString(port.Name),
+			}
+			if minNodePort != 0 {
+				svcPort.NodePort = minNodePort + int32(i)
+			}
+			service.Spec.Ports = append(service.Spec.Ports, svcPort)
 		}
 	}
+
+	if len(service.Spec.Ports) == 0 {
+		return nil, nil
+	}
+
+	// Public ports without any way in would be silently unreachable
+	if exposure == model.PublicExposureExternalIPs && len(externalIPs) == 0 {
+		return nil, fmt.Errorf("Role %s has public ports but no external IPs; pass --external-ips or choose another exposure", role.Name)
+	}
+
 	return service, nil
 }
+
+// newServiceList returns a list of the given services of a role, along with
+// the objects exposing its public ports
+func newServiceList(role *model.Role, settings *ExportSettings, services ...*apiv1.Service) (*apiv1.List, error) {
+	list := &apiv1.List{
+		TypeMeta: meta.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "List",
+		},
+	}
+
+	for _, service := range services {
+		if service != nil {
+			list.Items = append(list.Items, runtime.RawExtension{Object: service})
+		}
+	}
+
+	publicService, err := NewPublicService(role, settings)
+	if err != nil {
+		return nil, err
+	}
+	if publicService != nil {
+		list.Items = append(list.Items, runtime.RawExtension{Object: publicService})
+	}
+
+	ingress, err := NewIngress(role, settings)
+	if err != nil {
+		return nil, err
+	}
+	if ingress != nil {
+		list.Items = append(list.Items, runtime.RawExtension{Object: ingress})
+	}
+
+	return list, nil
+}
+
+// ServiceNames returns the DNS names under which the services of a role can
+// be reached inside the namespace; these are the subject alternative names of
+// certificates generated for the role
+func ServiceNames(role *model.Role) []string {
+	if role.Run == nil || len(role.Run.ExposedPorts) == 0 {
+		// No services are created for roles without ports
+		return nil
+	}
+
+	names := []string{role.Name}
+	if UsesStatefulSet(role) {
+		// The pods of a stateful set are addressed via the headless service
+		headlessName := fmt.Sprintf("%s-pod", role.Name)
+		names = append(names, headlessName, fmt.Sprintf("*.%s", headlessName))
+	}
+
+	return names
+}
@@ -11,7 +11,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	yaml "gopkg.in/yaml.v2"
-	//	apiv1 "k8s.io/client-go/pkg/api/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/util/intstr"
 )
 
 func serviceTestLoadRole(assert *assert.Assertions, manifestName string) (*model.RoleManifest, *model.Role) {
@@ -21,7 +22,7 @@ func serviceTestLoadRole(assert *assert.Assertions, manifestName string) (*model
 	manifestPath := filepath.Join(workDir, "../test-assets/role-manifests", manifestName)
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	if !assert.NoError(err) {
 		return nil, nil
 	}
@@ -149,3 +150,221 @@ func TestHeadlessServiceOK(t *testing.T) {
 	}
 	_ = isYAMLSubset(assert, expected, actual, []string{})
 }
+
+func TestServiceNames(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	assert.Equal([]string{"myrole"}, ServiceNames(role))
+
+	role.Tags = []string{"clustered"}
+	assert.Equal([]string{"myrole", "myrole-pod", "*.myrole-pod"}, ServiceNames(role))
+
+	role.Run.ExposedPorts = nil
+	assert.Empty(ServiceNames(role))
+}
+
+func TestPublicServiceExternalIPs(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	_, err := NewPublicService(role, &ExportSettings{})
+	assert.EqualError(err, "Role myrole has public ports but no external IPs; pass --external-ips or choose another exposure")
+
+	service, err := NewPublicService(role, &ExportSettings{ExternalIPs: []string{"192.168.77.77"}})
+	if !assert.NoError(err) || !assert.NotNil(service) {
+		return
+	}
+
+	yamlConfig := bytes.Buffer{}
+	if err := WriteYamlConfig(service, &yamlConfig); !assert.NoError(err) {
+		return
+	}
+	var expected, actual interface{}
+	if !assert.NoError(yaml.Unmarshal(yamlConfig.Bytes(), &actual)) {
+		return
+	}
+	expectedYAML := strings.Replace(`---
+			metadata:
+				name: myrole-public
+			spec:
+				externalIPs:
+				- 192.168.77.77
+				ports:
+				-
+						name: http
+						port: 80
+						protocol: TCP
+						targetPort: http
+				-
+						name: https
+						port: 443
+						targetPort: https
+				selector:
+					skiff-role-name: myrole
+				type: ClusterIP
+	`, "\t", "    ", -1)
+	if !assert.NoError(yaml.Unmarshal([]byte(expectedYAML), &expected)) {
+		return
+	}
+	_ = isYAMLSubset(assert, expected, actual, []string{})
+
+	// The role manifest takes precedence over the settings
+	role.Run.PublicExposure = &model.RoleRunPublic{
+		Type:        model.PublicExposureExternalIPs,
+		ExternalIPs: []string{"10.0.0.1"},
+	}
+	service, err = NewPublicService(role, &ExportSettings{ExternalIPs: []string{"192.168.77.77"}})
+	if assert.NoError(err) && assert.NotNil(service) {
+		assert.Equal([]string{"10.0.0.1"}, service.Spec.ExternalIPs)
+	}
+
+	// The in-cluster service is no longer exposed
+	service, err = NewClusterIPService(role, false)
+	if assert.NoError(err) {
+		assert.Empty(service.Spec.ExternalIPs)
+	}
+}
+
+func TestPublicServiceLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+	role.Run.ExposedPorts[1].Public = false
+
+	service, err := NewPublicService(role, &ExportSettings{PublicExposure: model.PublicExposureLoadBalancer})
+	if !assert.NoError(err) || !assert.NotNil(service) {
+		return
+	}
+
+	assert.Equal(apiv1.ServiceTypeLoadBalancer, service.Spec.Type)
+	assert.Empty(service.Spec.ExternalIPs)
+	if assert.Len(service.Spec.Ports, 1, "Only public ports should be exposed") {
+		assert.Equal("http", service.Spec.Ports[0].Name)
+		assert.Equal(int32(80), service.Spec.Ports[0].Port)
+		assert.Equal(int32(0), service.Spec.Ports[0].NodePort)
+	}
+}
+
+func TestPublicServiceNodePort(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, _ := serviceTestLoadRole(assert, "public-exposure.yml")
+	if manifest == nil {
+		return
+	}
+	role := manifest.LookupRole("router")
+	if !assert.NotNil(role) {
+		return
+	}
+
+	service, err := NewPublicService(role, &ExportSettings{PublicExposure: model.PublicExposureLoadBalancer})
+	if !assert.NoError(err) || !assert.NotNil(service) {
+		return
+	}
+
+	assert.Equal("router-public", service.Name)
+	assert.Equal(apiv1.ServiceTypeNodePort, service.Spec.Type)
+	assert.Equal([]apiv1.ServicePort{
+		{
+			Name:       "routes-0",
+			Port:       2000,
+			NodePort:   32000,
+			TargetPort: intstr.FromString("routes-0"),
+		},
+		{
+			Name:       "routes-1",
+			Port:       2001,
+			NodePort:   32001,
+			TargetPort: intstr.FromString("routes-1"),
+		},
+	}, service.Spec.Ports)
+
+	role.Run.ExposedPorts[0].NodePort = "32000"
+	_, err = NewPublicService(role, &ExportSettings{})
+	assert.EqualError(err, "Port routes has mismatched internal and node port ranges 2000-2001 and 32000")
+}
+
+func TestIngress(t *testing.T) {
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "public-exposure.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	service, err := NewPublicService(role, &ExportSettings{})
+	if assert.NoError(err) {
+		assert.Nil(service, "Roles exposed through an ingress need no public service")
+	}
+
+	ingress, err := NewIngress(role, &ExportSettings{IngressDomain: "example.org"})
+	if !assert.NoError(err) || !assert.NotNil(ingress) {
+		return
+	}
+
+	yamlConfig := bytes.Buffer{}
+	if err := WriteYamlConfig(ingress, &yamlConfig); !assert.NoError(err) {
+		return
+	}
+	var expected, actual interface{}
+	if !assert.NoError(yaml.Unmarshal(yamlConfig.Bytes(), &actual)) {
+		return
+	}
+	expectedYAML := strings.Replace(`---
+			apiVersion: extensions/v1beta1
+			kind: Ingress
+			metadata:
+				name: myrole
+			spec:
+				rules:
+				-
+					host: myrole.example.com
+					http:
+						paths:
+						-
+							path: /
+							backend:
+								serviceName: myrole
+								servicePort: 80
+						-
+							path: /v2
+							backend:
+								serviceName: myrole
+								servicePort: 9022
+	`, "\t", "    ", -1)
+	if !assert.NoError(yaml.Unmarshal([]byte(expectedYAML), &expected)) {
+		return
+	}
+	_ = isYAMLSubset(assert, expected, actual, []string{})
+
+	// Without a host in the role manifest, it is named after the role
+	role.Run.PublicExposure.Host = ""
+	ingress, err = NewIngress(role, &ExportSettings{IngressDomain: "example.org"})
+	if assert.NoError(err) && assert.NotNil(ingress) {
+		assert.Equal("myrole.example.org", ingress.Spec.Rules[0].Host)
+	}
+
+	ingress, err = NewIngress(role, &ExportSettings{PublicExposure: model.PublicExposureIngress})
+	if assert.NoError(err) && assert.NotNil(ingress) {
+		assert.Equal("", ingress.Spec.Rules[0].Host)
+	}
+
+	// Only roles exposed through an ingress get one
+	role.Run.PublicExposure = nil
+	ingress, err = NewIngress(role, &ExportSettings{})
+	if assert.NoError(err) {
+		assert.Nil(ingress)
+	}
+}
@@ -2,15 +2,21 @@ package kube
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/hpcloud/fissile/model"
 	"k8s.io/client-go/pkg/api/resource"
 	meta "k8s.io/client-go/pkg/api/unversioned"
 	v1 "k8s.io/client-go/pkg/api/v1"
 	v1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
-	"k8s.io/client-go/pkg/runtime"
 )
 
+// UsesStatefulSet reports whether the role is deployed as a stateful set
+// (instead of a deployment), because it is clustered or needs storage
+func UsesStatefulSet(role *model.Role) bool {
+	return role.IsStateful()
+}
+
 // NewStatefulSet returns a k8s stateful set for the given role
 func NewStatefulSet(role *model.Role, settings *ExportSettings) (*v1beta1.StatefulSet, *v1.List, error) {
 	// For each StatefulSet, we need two services -- one for the public (inside
@@ -25,7 +31,10 @@ func NewStatefulSet(role *model.Role, settings *ExportSettings) (*v1beta1.Statef
 		return nil, nil, err
 	}
 
-	volumeClaimTemplates := getVolumeClaims(role)
+	volumeClaimTemplates, err := getVolumeClaims(role, settings)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	headedService, err := NewClusterIPService(role, false)
 	if err != nil {
@@ -36,7 +45,12 @@ func NewStatefulSet(role *model.Role, settings *ExportSettings) (*v1beta1.Statef
 		return nil, nil, err
 	}
 
-	return &v1beta1.StatefulSet{
+	deps, err := newServiceList(role, settings, headedService, headlessService)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	statefulSet := &v1beta1.StatefulSet{
 			TypeMeta: meta.TypeMeta{
 				APIVersion: "apps/v1beta1",
 				Kind:       "StatefulSet",
@@ -53,27 +67,28 @@ func NewStatefulSet(role *model.Role, settings *ExportSettings) (*v1beta1.Statef
 				Template:             podTemplate,
 				VolumeClaimTemplates: volumeClaimTemplates,
 			},
-		}, &v1.List{
-			TypeMeta: meta.TypeMeta{
-				APIVersion: "v1",
-				Kind:       "List",
-			},
-			Items: []runtime.RawExtension{
-				runtime.RawExtension{
-					Object: headedService,
-				},
-				runtime.RawExtension{
-					Object: headlessService,
-				},
-			},
-		}, nil
+		}
+	addScalingObjects(deps, role, statefulSet.TypeMeta)
+
+	return statefulSet, deps, nil
 }
 
-// getVolumeClaims returns the list of persistent volume claims from a role
-func getVolumeClaims(role *model.Role) []v1.PersistentVolumeClaim {
+// getVolumeClaims returns the list of persistent volume claims from a role;
+// volumes without a storage class of their own use the default storage class
+// of their kind
+func getVolumeClaims(role *model.Role, settings *ExportSettings) ([]v1.PersistentVolumeClaim, error) {
 	totalLength := len(role.Run.PersistentVolumes) + len(role.Run.SharedVolumes)
 	claims := make([]v1.PersistentVolumeClaim, 0, totalLength)
 
+	persistentStorageClass := settings.PersistentStorageClass
+	if persistentStorageClass == "" {
+		persistentStorageClass = DefaultPersistentStorageClass
+	}
+	sharedStorageClass := settings.SharedStorageClass
+	if sharedStorageClass == "" {
+		sharedStorageClass = DefaultSharedStorageClass
+	}
+
 	types := []struct {
 		volumeDefinitions []*model.RoleRunVolume
 		storageClass      string
@@ -81,23 +96,33 @@ func getVolumeClaims(role *model.Role) []v1.PersistentVolumeClaim {
 	}{
 		{
 			role.Run.PersistentVolumes,
-			"persistent",
+			persistentStorageClass,
 			v1.ReadWriteOnce,
 		},
 		{
 			role.Run.SharedVolumes,
-			"shared",
+			sharedStorageClass,
 			v1.ReadWriteMany,
 		},
 	}
 
 	for _, volumeTypeInfo := range types {
 		for _, volume := range volumeTypeInfo.volumeDefinitions {
+			size, err := getVolumeSize(volume)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid size of volume %s of role %s: %s", volume.Tag, role.Name, err.Error())
+			}
+
+			storageClass := volumeTypeInfo.storageClass
+			if volume.StorageClass != "" {
+				storageClass = volume.StorageClass
+			}
+
 			pvc := v1.PersistentVolumeClaim{
 				ObjectMeta: v1.ObjectMeta{
 					Name: volume.Tag,
 					Annotations: map[string]string{
-						"volume.beta.kubernetes.io/storage-class": volumeTypeInfo.storageClass,
+						VolumeStorageClassAnnotation: storageClass,
 					},
 				},
 				Spec: v1.PersistentVolumeClaimSpec{
@@ -106,7 +131,7 @@ func getVolumeClaims(role *model.Role) []v1.PersistentVolumeClaim {
 					},
 					Resources: v1.ResourceRequirements{
 						Requests: v1.ResourceList{
-							v1.ResourceStorage: *resource.NewScaledQuantity(int64(volume.Size), resource.Giga),
+							v1.ResourceStorage: size,
 						},
 					},
 				},
@@ -116,5 +141,15 @@ func getVolumeClaims(role *model.Role) []v1.PersistentVolumeClaim {
 		}
 	}
 
-	return claims
+	return claims, nil
+}
+
+// getVolumeSize returns the size of a volume; sizes are kube quantities, with
+// plain numbers being gigabytes
+func getVolumeSize(volume *model.RoleRunVolume) (resource.Quantity, error) {
+	size := volume.Size
+	if _, err := strconv.ParseFloat(size, 64); err == nil {
+		size += "G"
+	}
+	return resource.ParseQuantity(size)
 }
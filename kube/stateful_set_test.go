@@ -63,7 +63,7 @@ func statefulSetTestLoadManifest(assert *assert.Assertions, manifestName string)
 	manifestPath := filepath.Join(workDir, "../test-assets/role-manifests", manifestName)
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := model.NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	if !assert.NoError(err) {
 		return nil, nil
 	}
@@ -99,18 +99,23 @@ func TestStatefulSetPorts(t *testing.T) {
 	if !assert.NotNil(portDef) {
 		return
 	}
-	statefulset, deps, err := NewStatefulSet(role, &ExportSettings{})
+	statefulset, deps, err := NewStatefulSet(role, &ExportSettings{ExternalIPs: []string{"192.168.77.77"}})
 	if !assert.NoError(err) {
 		return
 	}
 	var endpointService, headlessService *apiv1.Service
 
-	if assert.Len(deps.Items, 2, "Should have two services per stateful role") {
+	// The role also has public ports and scales, and comes with a public
+	// service, an autoscaler and a disruption budget
+	if assert.Len(deps.Items, 5, "Should have two services per stateful role") {
 		for _, item := range deps.Items {
-			svc := item.Object.(*apiv1.Service)
+			svc, ok := item.Object.(*apiv1.Service)
+			if !ok {
+				continue
+			}
 			if svc.Spec.ClusterIP == apiv1.ClusterIPNone {
 				headlessService = svc
-			} else {
+			} else if svc.Name == role.Name {
 				endpointService = svc
 			}
 		}
@@ -175,6 +180,26 @@ func TestStatefulSetPorts(t *testing.T) {
 					skiff-role-name: myrole
 				type: ClusterIP
 				clusterIP: None
+		-
+			# This is the service exposing the public ports
+			metadata:
+				name: myrole-public
+			spec:
+				externalIPs:
+				- 192.168.77.77
+				type: ClusterIP
+		-
+			# This is the autoscaler
+			kind: HorizontalPodAutoscaler
+			spec:
+				scaleTargetRef:
+					kind: StatefulSet
+					name: myrole
+		-
+			# This is the disruption budget, as the role scales from one pod
+			kind: PodDisruptionBudget
+			spec:
+				maxUnavailable: 1
 		-
 			# This is the actual StatefulSet
 			metadata:
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ArchiveProblem is a job or package archive of a release that is missing or
+// does not match the digest from the release manifest
+type ArchiveProblem struct {
+	Release string `json:"release" yaml:"release"`
+	Kind    string `json:"kind" yaml:"kind"` // job or package
+	Name    string `json:"name" yaml:"name"`
+	Path    string `json:"path" yaml:"path"`
+	Missing bool   `json:"missing" yaml:"missing"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (p *ArchiveProblem) Error() string {
+	return fmt.Sprintf("%s %s/%s: %s", p.Kind, p.Release, p.Name, p.Message)
+}
+
+// archiveCheck is an archive waiting to be verified
+type archiveCheck struct {
+	release  string
+	kind     string
+	name     string
+	path     string
+	digest   string
+	validate func() error
+}
+
+// VerifyArchives checks the archives of all jobs and packages of the releases
+// against the digests from their release manifests, using up to workerCount
+// archives at a time. All problems found are returned, ordered by release,
+// kind and name.
+// Archives that were verified before are remembered in cacheDir, keyed by
+// their path, size, modification time and digest, so that they are only
+// hashed again once they change; the cache is disabled if cacheDir is empty.
+func VerifyArchives(releases []*Release, workerCount int, cacheDir string) []*ArchiveProblem {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	var checks []archiveCheck
+	for _, release := range releases {
+		for _, job := range release.Jobs {
+			checks = append(checks, archiveCheck{release.Name, "job", job.Name, job.Path, job.SHA1, job.ValidateSHA1})
+		}
+		for _, pkg := range release.Packages {
+			checks = append(checks, archiveCheck{release.Name, "package", pkg.Name, pkg.Path, pkg.SHA1, pkg.ValidateSHA1})
+		}
+	}
+
+	checksCh := make(chan archiveCheck)
+	problemsCh := make(chan *ArchiveProblem)
+
+	var workers sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for check := range checksCh {
+				if problem := check.run(cacheDir); problem != nil {
+					problemsCh <- problem
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, check := range checks {
+			checksCh <- check
+		}
+		close(checksCh)
+		workers.Wait()
+		close(problemsCh)
+	}()
+
+	var problems []*ArchiveProblem
+	for problem := range problemsCh {
+		problems = append(problems, problem)
+	}
+
+	sort.Sort(archiveProblems(problems))
+
+	return problems
+}
+
+func (c archiveCheck) run(cacheDir string) *ArchiveProblem {
+	problem := &ArchiveProblem{
+		Release: c.release,
+		Kind:    c.kind,
+		Name:    c.name,
+		Path:    c.path,
+	}
+
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		problem.Missing = true
+		problem.Message = fmt.Sprintf("archive %s is missing", c.path)
+		return problem
+	}
+
+	var markerPath string
+	if cacheDir != "" && err == nil {
+		key := fmt.Sprintf("%s\x00%d\x00%d\x00%s", c.path, info.Size(), info.ModTime().UnixNano(), c.digest)
+		markerPath = filepath.Join(cacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(key))))
+		if _, err := os.Stat(markerPath); err == nil {
+			return nil
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		problem.Message = err.Error()
+		return problem
+	}
+
+	// Failing to remember the archive only means hashing it again next time
+	if markerPath != "" && os.MkdirAll(cacheDir, 0755) == nil {
+		ioutil.WriteFile(markerPath, nil, 0644)
+	}
+
+	return nil
+}
+
+// archiveProblems sorts problems by release, kind and name
+type archiveProblems []*ArchiveProblem
+
+func (p archiveProblems) Len() int {
+	return len(p)
+}
+
+func (p archiveProblems) Less(i, j int) bool {
+	if p[i].Release != p[j].Release {
+		return p[i].Release < p[j].Release
+	}
+	if p[i].Kind != p[j].Kind {
+		return p[i].Kind < p[j].Kind
+	}
+	return p[i].Name < p[j].Name
+}
+
+func (p archiveProblems) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
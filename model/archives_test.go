@@ -0,0 +1,111 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyArchives(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Empty(VerifyArchives([]*Release{release}, 2, ""))
+
+	release.Packages[0].SHA1 = "sha256:" + otherSHA256
+	release.Packages[1].Path = filepath.Join(workDir, "missing.tgz")
+	release.Jobs[0].SHA1 += "foo"
+
+	problems := VerifyArchives([]*Release{release}, 2, "")
+	if !assert.Len(problems, 3) {
+		return
+	}
+
+	assert.Equal("job", problems[0].Kind)
+	assert.Equal(release.Jobs[0].Name, problems[0].Name)
+	assert.False(problems[0].Missing)
+	assert.Contains(problems[0].Message, "Computed sha1")
+
+	assert.Equal("package", problems[1].Kind)
+	assert.Equal("package", problems[2].Kind)
+
+	for _, problem := range problems[1:] {
+		assert.Equal("tor", problem.Release)
+		switch problem.Name {
+		case release.Packages[0].Name:
+			assert.False(problem.Missing)
+			assert.Contains(problem.Message, "Computed sha256")
+		case release.Packages[1].Name:
+			assert.True(problem.Missing)
+			assert.Equal("package tor/"+problem.Name+": archive "+problem.Path+" is missing", problem.Error())
+		default:
+			assert.Fail("Unexpected problem", problem.Error())
+		}
+	}
+}
+
+func TestVerifyArchivesCache(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	tempDir, err := ioutil.TempDir("", "fissile-verified-archives")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// Copy a job archive, so that it can be changed
+	job := release.Jobs[0]
+	contents, err := ioutil.ReadFile(job.Path)
+	if !assert.NoError(err) {
+		return
+	}
+	job.Path = filepath.Join(tempDir, "job.tgz")
+	if !assert.NoError(ioutil.WriteFile(job.Path, contents, 0644)) {
+		return
+	}
+
+	cacheDir := filepath.Join(tempDir, "verified")
+	assert.Empty(VerifyArchives([]*Release{release}, 2, cacheDir))
+
+	markers, err := ioutil.ReadDir(cacheDir)
+	if assert.NoError(err) {
+		assert.Len(markers, len(release.Jobs)+len(release.Packages), "Verified archives should be remembered")
+	}
+	assert.Empty(VerifyArchives([]*Release{release}, 2, cacheDir))
+
+	// Changed archives and digests have to be verified again
+	assert.NoError(ioutil.WriteFile(job.Path, append(contents, 0), 0644))
+	problems := VerifyArchives([]*Release{release}, 2, cacheDir)
+	if assert.Len(problems, 1) {
+		assert.Equal(job.Name, problems[0].Name)
+	}
+
+	assert.NoError(ioutil.WriteFile(job.Path, contents, 0644))
+	release.Packages[0].SHA1 = "sha256:" + otherSHA256
+	problems = VerifyArchives([]*Release{release}, 2, cacheDir)
+	if assert.Len(problems, 1) {
+		assert.Equal(release.Packages[0].Name, problems[0].Name)
+	}
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DependsOnRoles returns the roles the role depends on, in the order of its
+// depends-on list
+func (r *Role) DependsOnRoles() Roles {
+	if r.Run == nil || r.rolesManifest == nil {
+		return nil
+	}
+
+	var result Roles
+	for _, name := range r.Run.DependsOn {
+		if role := r.rolesManifest.LookupRole(name); role != nil {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// DependencyAddresses returns the addresses (host:port) of the services of
+// the roles the role depends on, which are reachable once the roles are ready
+func (r *Role) DependencyAddresses() []string {
+	var result []string
+	for _, role := range r.DependsOnRoles() {
+		if address := role.serviceAddress(); address != "" {
+			result = append(result, address)
+		}
+	}
+	return result
+}
+
+// serviceAddress returns the address of the first TCP port of the service of
+// the role, or nothing if it has none
+func (r *Role) serviceAddress() string {
+	if r.Run == nil {
+		return ""
+	}
+	for _, port := range r.Run.ExposedPorts {
+		if protocol := strings.ToUpper(port.Protocol); protocol != "" && protocol != "TCP" {
+			continue
+		}
+		minPort, _, err := ParsePortRange(port.External, port.Name, "external")
+		if err != nil {
+			continue
+		}
+		return fmt.Sprintf("%s:%d", r.Name, minPort)
+	}
+	return ""
+}
+
+// DependencyOrder returns the roles of the manifest with the roles they depend
+// on first, and otherwise in the order of the manifest
+func (m *RoleManifest) DependencyOrder() (Roles, error) {
+	order, cycle := dependencyOrder(m.Roles)
+	if cycle != nil {
+		return nil, fmt.Errorf("Role dependencies form a cycle: %s", cycle)
+	}
+	return order, nil
+}
+
+// roleCycle is a cycle of role dependencies, starting and ending with the
+// same role
+type roleCycle Roles
+
+func (c roleCycle) String() string {
+	names := make([]string, len(c))
+	for i, role := range c {
+		names[i] = role.Name
+	}
+	return strings.Join(names, " -> ")
+}
+
+// dependencyOrder sorts the roles so that the roles they depend on come first,
+// keeping their order otherwise. If the dependencies form a cycle, the cycle is
+// returned instead. Dependencies on unknown roles are ignored.
+func dependencyOrder(roles Roles) (Roles, roleCycle) {
+	byName := map[string]*Role{}
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := map[*Role]int{}
+	var order, stack Roles
+	var cycle roleCycle
+
+	var visit func(role *Role) bool
+	visit = func(role *Role) bool {
+		switch state[role] {
+		case visited:
+			return true
+		case visiting:
+			for i := range stack {
+				if stack[i] == role {
+					cycle = append(roleCycle{}, stack[i:]...)
+					cycle = append(cycle, role)
+					break
+				}
+			}
+			return false
+		}
+
+		state[role] = visiting
+		stack = append(stack, role)
+		if role.Run != nil {
+			for _, name := range role.Run.DependsOn {
+				if dependency, ok := byName[name]; ok && !visit(dependency) {
+					return false
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[role] = visited
+		order = append(order, role)
+		return true
+	}
+
+	for _, role := range roles {
+		if !visit(role) {
+			return nil, cycle
+		}
+	}
+	return order, nil
+}
+
+// checkRoleDependencies checks the depends-on lists of the roles. Roles can
+// only depend on other roles that are not tasks, and that have a TCP port to
+// wait for; the dependencies can't form a cycle. The problems found are
+// returned with the paths of the offending role manifest nodes; the roles are
+// expected to be those of the manifest, in order.
+func checkRoleDependencies(roles Roles) ValidationErrors {
+	var errs ValidationErrors
+	addError := func(path, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	byName := map[string]*Role{}
+	indexes := map[*Role]int{}
+	for i, role := range roles {
+		byName[role.Name] = role
+		indexes[role] = i
+	}
+
+	for i, role := range roles {
+		if role.Run == nil {
+			continue
+		}
+		for j, name := range role.Run.DependsOn {
+			path := fmt.Sprintf("roles[%d].run.depends-on[%d]", i, j)
+			dependency, ok := byName[name]
+			switch {
+			case !ok:
+				addError(path, "Role %s depends on role %s, which does not exist", role.Name, name)
+			case dependency == role:
+				addError(path, "Role %s depends on itself", role.Name)
+			case dependency.Type == RoleTypeBoshTask:
+				addError(path, "Role %s depends on role %s, which is a task", role.Name, name)
+			case dependency.serviceAddress() == "":
+				addError(path, "Role %s depends on role %s, which has no TCP port to wait for", role.Name, name)
+			}
+		}
+	}
+
+	// Cycles are only looked for once the dependencies are valid, so roles
+	// depending on themselves aren't reported twice
+	if len(errs) == 0 {
+		if _, cycle := dependencyOrder(roles); cycle != nil {
+			addError(fmt.Sprintf("roles[%d].run.depends-on", indexes[cycle[0]]), "Role dependencies form a cycle: %s", cycle)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on.yml")
+	rolesManifest, err := LoadRoleManifest(roleManifestPath, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	api := rolesManifest.LookupRole("api")
+	database := rolesManifest.LookupRole("database")
+	nats := rolesManifest.LookupRole("nats")
+
+	assert.Equal(Roles{nats, database}, api.DependsOnRoles())
+	assert.Empty(database.DependsOnRoles())
+	assert.Equal([]string{"nats:4222", "database:3306"}, api.DependencyAddresses(), "Dependencies are reached on their first TCP port")
+
+	order, err := rolesManifest.DependencyOrder()
+	if assert.NoError(err) {
+		assert.Equal(Roles{database, nats, api}, order)
+	}
+}
+
+func TestRoleDependenciesCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on-cycle.yml")
+	_, err = LoadRoleManifest(roleManifestPath, nil, false)
+	assert.EqualError(err, "line 14: roles[1].run.depends-on: Role dependencies form a cycle: nats -> database -> nats")
+}
+
+func TestRoleDependenciesOnDevRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on-dev.yml")
+	_, err = LoadRoleManifest(roleManifestPath, nil, false)
+	assert.NoError(err)
+
+	// Without the dev-only roles, the dependency is gone
+	_, err = LoadRoleManifest(roleManifestPath, nil, true)
+	assert.EqualError(err, "Role api depends on role debug, which does not exist")
+}
+
+func TestValidateRoleManifestDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/depends-on-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 6: roles[0].run.depends-on[0]: Role api depends on role nats, which has no TCP port to wait for",
+		"line 6: roles[0].run.depends-on[1]: Role api depends on role migrations, which is a task",
+		"line 6: roles[0].run.depends-on[2]: Role api depends on role queue, which does not exist",
+		"line 6: roles[0].run.depends-on[3]: Role api depends on itself",
+	}, actual)
+}
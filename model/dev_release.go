@@ -7,17 +7,18 @@ import (
 
 	"github.com/hpcloud/fissile/util"
 
-	"github.com/cppforlife/go-semi-semantic/version"
 	"gopkg.in/yaml.v2"
 )
 
 // NewDevRelease will create an instance of a BOSH development release
-func NewDevRelease(path, releaseName, version, boshCacheDir string) (*Release, error) {
+func NewDevRelease(path, releaseName, version, boshCacheDir string, options *ReleaseOptions) (*Release, error) {
 	release := &Release{
 		Path:            path,
 		Name:            releaseName,
 		Version:         version,
 		DevBOSHCacheDir: boshCacheDir,
+		Type:            ReleaseTypeDev,
+		options:         releaseOptions(options),
 	}
 
 	if err := release.validateDevPathStructure(); err != nil {
@@ -88,82 +89,11 @@ func (r *Release) getDefaultDevReleaseName() (ver string, err error) {
 		}
 	}
 
-	releaseConfigContent, err = ioutil.ReadFile(r.getDevReleaseFinalConfigFile())
-	if err != nil {
-		return "", err
-	}
-
-	if err := yaml.Unmarshal([]byte(releaseConfigContent), &releaseConfig); err != nil {
-		return "", err
-	}
-
-	if value, ok := releaseConfig["name"]; !ok {
-		if value, ok := releaseConfig["final_name"]; !ok {
-			return "", fmt.Errorf("name or final_name key did not exist in configuration file for release: %s", r.Path)
-		} else if name, ok = value.(string); !ok {
-			return "", fmt.Errorf("final_name was not a string in release: %s, type: %T, value: %v", r.Path, value, value)
-		}
-	} else if name, ok = value.(string); !ok {
-		return "", fmt.Errorf("name was not a string in release: %s, type: %T, value: %v", r.Path, value, value)
-	}
-
-	return name, nil
+	return r.getDefaultFinalReleaseName()
 }
 
 func (r *Release) getLatestDevVersion() (ver string, err error) {
-	devReleaseIndexContent, err := ioutil.ReadFile(r.getDevReleaseIndexPath())
-	if err != nil {
-		return "", err
-	}
-
-	var devReleaseIndex map[interface{}]interface{}
-
-	if err := yaml.Unmarshal([]byte(devReleaseIndexContent), &devReleaseIndex); err != nil {
-		return "", err
-	}
-
-	var semiVer version.Version
-	var builds map[interface{}]interface{}
-
-	if value, ok := devReleaseIndex["builds"]; !ok {
-		return "", fmt.Errorf("builds key did not exist in dev releases index file for release: %s", r.Name)
-	} else if builds, ok = value.(map[interface{}]interface{}); !ok {
-		return "", fmt.Errorf("builds key in dev releases index file was not a map for release: %s, type: %T, value: %v", r.Name, value, value)
-	}
-
-	for _, build := range builds {
-		var buildVersion string
-
-		if buildMap, ok := build.(map[interface{}]interface{}); !ok {
-			return "", fmt.Errorf("build entry was not a map in release: %s, type: %T, value: %v", r.Name, build, build)
-		} else if value, ok := buildMap["version"]; !ok {
-			return "", fmt.Errorf("version key did not exist in a build entry for release: %s", r.Name)
-		} else if buildVersion, ok = value.(string); !ok {
-			return "", fmt.Errorf("version was not a string in a build entry for release: %s, type: %T, value: %v", r.Name, value, value)
-		}
-
-		if ver == "" {
-			ver = buildVersion
-			semiVer, err = version.NewVersionFromString(ver)
-			if err != nil {
-				return "", err
-			}
-
-			continue
-		}
-
-		semiBuildVer, err := version.NewVersionFromString(buildVersion)
-		if err != nil {
-			return "", err
-		}
-
-		if semiBuildVer.IsGt(semiVer) {
-			ver = buildVersion
-			semiVer = semiBuildVer
-		}
-	}
-
-	return ver, nil
+	return r.getLatestVersionFromIndex(r.getDevReleaseIndexPath(), "dev releases index file")
 }
 
 func (r *Release) validateDevPathStructure() error {
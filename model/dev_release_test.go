@@ -20,7 +20,7 @@ func TestDevReleaseValidationOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 }
@@ -34,7 +34,7 @@ func TestDevReleaseLatestVersionOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
@@ -51,7 +51,7 @@ func TestDevReleaseSpecificVersionOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "0+dev.1", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "0+dev.1", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
@@ -67,7 +67,7 @@ func TestDevReleaseSpecificNameOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "test2", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "test2", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.Equal("test2", release.Name)
@@ -83,7 +83,7 @@ func TestDevReleaseValidationNotOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "foo-dev", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "foo-dev", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "release dev manifests directory")
@@ -98,7 +98,7 @@ func TestDevReleaseValidationBadConfigNoDevNameKeyWithFinalName(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release-missing-dev-name")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.Equal("test-final", release.Name)
@@ -113,7 +113,7 @@ func TestDevReleaseValidationBadConfigNoDevNameKeyNoFinalName(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release-missing-final-name")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "final_name key did not exist in configuration file for release")
@@ -128,7 +128,7 @@ func TestDevReleaseValidationBadConfigWrongFinalNameType(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release-wrong-final-name-type")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "final_name was not a string in release")
@@ -143,7 +143,7 @@ func TestDevReleaseValidationBadIndexNoBuildsKey(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-no-builds-key", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-no-builds-key", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "builds key did not exist in dev releases index file for release")
@@ -158,7 +158,7 @@ func TestDevReleaseValidationBadIndexWrongBuildsKeyType(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-wrong-builds-key-type", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-wrong-builds-key-type", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "builds key in dev releases index file was not a map for release")
@@ -173,7 +173,7 @@ func TestDevReleaseValidationBadIndexNoVersionKeyInBuild(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-no-version-in-build", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-no-version-in-build", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "version key did not exist in a build entry for release")
@@ -188,7 +188,7 @@ func TestDevReleaseValidationBadIndexWrongVersionTypeInBuild(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-wrong-version-type-in-build", "", emptyDevReleaseCachePath)
+	_, err = NewDevRelease(emptyDevReleasePath, "bad-index-wrong-version-type-in-build", "", emptyDevReleaseCachePath, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "version was not a string in a build entry for release")
@@ -203,7 +203,7 @@ func TestDevReleasePackagesOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
@@ -226,7 +226,7 @@ func TestDevReleasePackageExtractOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
@@ -255,7 +255,7 @@ func TestDevReleaseJobsOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
@@ -278,7 +278,7 @@ func TestDevReleaseJobExtractOk(t *testing.T) {
 	emptyDevReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
 	emptyDevReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
 
-	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath)
+	release, err := NewDevRelease(emptyDevReleasePath, "", "", emptyDevReleaseCachePath, nil)
 
 	assert.NoError(err)
 	assert.NotNil(release)
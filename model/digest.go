@@ -0,0 +1,90 @@
+package model
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// digestAlgorithms are the algorithms supported in the digests of jobs and
+// packages in release manifests
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// parseMultiDigest parses the digest of a job or package. Older releases only
+// have a plain SHA1; newer ones use the BOSH multi-digest format, a list of
+// "<algorithm>:<hex digest>" separated by semicolons (e.g. "sha256:3a4f...").
+// Unsupported algorithms are skipped, as long as one supported one is left.
+func parseMultiDigest(digest string) (map[string]string, error) {
+	digests := map[string]string{}
+
+	for _, part := range strings.Split(digest, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		algorithm, value := "sha1", part
+		if idx := strings.Index(part, ":"); idx >= 0 {
+			algorithm, value = part[:idx], part[idx+1:]
+		}
+
+		if _, ok := digestAlgorithms[algorithm]; ok {
+			digests[algorithm] = strings.ToLower(value)
+		}
+	}
+
+	if len(digests) == 0 {
+		return nil, fmt.Errorf("Digest '%s' has no supported algorithm", digest)
+	}
+
+	return digests, nil
+}
+
+// validateArchiveDigest checks the archive at path against all supported
+// digests in the manifest digest, reading the archive only once
+func validateArchiveDigest(path, digest, description string) error {
+	expected, err := parseMultiDigest(digest)
+	if err != nil {
+		return fmt.Errorf("Error validating %s %s: %s", description, path, err.Error())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Error opening the %s %s for digest calculation: %s", description, path, err.Error())
+	}
+	defer file.Close()
+
+	algorithms := make([]string, 0, len(expected))
+	hashes := map[string]hash.Hash{}
+	writers := make([]io.Writer, 0, len(expected))
+	for algorithm := range expected {
+		algorithms = append(algorithms, algorithm)
+		hashes[algorithm] = digestAlgorithms[algorithm]()
+		writers = append(writers, hashes[algorithm])
+	}
+	sort.Strings(algorithms)
+
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return fmt.Errorf("Error reading the %s %s for digest calculation: %s", description, path, err.Error())
+	}
+
+	for _, algorithm := range algorithms {
+		computed := fmt.Sprintf("%x", hashes[algorithm].Sum(nil))
+		if computed != expected[algorithm] {
+			return fmt.Errorf("Computed %s (%s) is different than manifest %s (%s) for %s %s",
+				algorithm, computed, algorithm, expected[algorithm], description, path)
+		}
+	}
+
+	return nil
+}
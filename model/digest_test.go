@@ -0,0 +1,62 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testArchiveContents = "archive contents"
+	testArchiveSHA1     = "88b99d3ee9aa6d57d5126cec991e9776a0f94fb1"
+	testArchiveSHA256   = "f69f4865f861193a91d1c5544a894167a7137b788d10bac8edbf5d095f45cb4d"
+	otherSHA256         = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+func TestParseMultiDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	digests, err := parseMultiDigest("6098E7AB")
+	if assert.NoError(err) {
+		assert.Equal(map[string]string{"sha1": "6098e7ab"}, digests, "Plain digests are SHA1")
+	}
+
+	digests, err = parseMultiDigest("sha256:abc;sha1:def;md5:123")
+	if assert.NoError(err) {
+		assert.Equal(map[string]string{"sha256": "abc", "sha1": "def"}, digests)
+	}
+
+	_, err = parseMultiDigest("md5:123")
+	assert.EqualError(err, "Digest 'md5:123' has no supported algorithm")
+}
+
+func TestValidateArchiveDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "fissile-digest-tests")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, "archive.tgz")
+	assert.NoError(ioutil.WriteFile(archivePath, []byte(testArchiveContents), 0644))
+
+	assert.NoError(validateArchiveDigest(archivePath, testArchiveSHA1, "job archive"))
+	assert.NoError(validateArchiveDigest(archivePath, "sha1:"+testArchiveSHA1, "job archive"))
+	assert.NoError(validateArchiveDigest(archivePath, "sha256:"+testArchiveSHA256, "job archive"))
+	assert.NoError(validateArchiveDigest(archivePath, "sha1:"+testArchiveSHA1+";sha256:"+testArchiveSHA256, "job archive"))
+
+	err = validateArchiveDigest(archivePath, "sha1:"+testArchiveSHA1+";sha256:"+otherSHA256, "job archive")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Computed sha256 ("+testArchiveSHA256+") is different than manifest sha256 ("+otherSHA256+") for job archive")
+	}
+
+	err = validateArchiveDigest(filepath.Join(tempDir, "missing.tgz"), testArchiveSHA1, "package archive")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Error opening the package archive")
+	}
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"path/filepath"
+
+	"github.com/hpcloud/fissile/util"
+)
+
+// NewFinalRelease will create an instance of a BOSH final release
+func NewFinalRelease(path, releaseName, version, boshCacheDir string, options *ReleaseOptions) (*Release, error) {
+	release := &Release{
+		Path:            path,
+		Name:            releaseName,
+		Version:         version,
+		DevBOSHCacheDir: boshCacheDir,
+		Type:            ReleaseTypeFinal,
+		options:         releaseOptions(options),
+	}
+
+	if err := release.validateFinalPathStructure(); err != nil {
+		return nil, err
+	}
+
+	if releaseName == "" {
+		releaseName, err := release.getDefaultFinalReleaseName()
+		if err != nil {
+			return nil, err
+		}
+
+		release.Name = releaseName
+	}
+
+	if err := release.validateSpecificFinalReleasePathStructure(); err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		version, err := release.getLatestFinalVersion()
+		if err != nil {
+			return nil, err
+		}
+
+		release.Version = version
+	}
+
+	if err := release.loadMetadata(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadPackages(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadDependenciesForPackages(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadJobs(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadLicense(); err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+func (r *Release) getLatestFinalVersion() (ver string, err error) {
+	return r.getLatestVersionFromIndex(r.getFinalReleaseIndexPath(), "final releases index file")
+}
+
+func (r *Release) validateFinalPathStructure() error {
+	if err := util.ValidatePath(r.Path, true, "release directory"); err != nil {
+		return err
+	}
+
+	if err := util.ValidatePath(r.getFinalReleasesDir(), true, "release 'releases' directory"); err != nil {
+		return err
+	}
+
+	if err := util.ValidatePath(r.getFinalBuildsDir(), true, "release '.final_builds' directory"); err != nil {
+		return err
+	}
+
+	if err := util.ValidatePath(r.getDevReleaseFinalConfigFile(), false, "release final config file"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Release) validateSpecificFinalReleasePathStructure() error {
+	if err := util.ValidatePath(r.getFinalReleaseManifestsDir(), true, "release final manifests directory"); err != nil {
+		return err
+	}
+
+	if err := util.ValidatePath(r.getFinalReleaseIndexPath(), false, "release index file"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Release) getFinalReleaseManifestsDir() string {
+	return filepath.Join(r.getFinalReleasesDir(), r.Name)
+}
+
+func (r *Release) getFinalReleaseIndexPath() string {
+	return filepath.Join(r.getFinalReleaseManifestsDir(), "index.yml")
+}
+
+func (r *Release) getFinalReleasesDir() string {
+	return filepath.Join(r.Path, "releases")
+}
+
+func (r *Release) getFinalBuildsDir() string {
+	return filepath.Join(r.Path, ".final_builds")
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinalReleaseValidationOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	finalReleasePath := filepath.Join(workDir, "../test-assets/ntp-final-release")
+	finalReleaseCachePath := filepath.Join(workDir, "../test-assets/ntp-release/bosh-cache")
+
+	release, err := NewFinalRelease(finalReleasePath, "", "", finalReleaseCachePath, nil)
+
+	assert.NoError(err)
+	assert.Equal(ReleaseTypeFinal, release.Type)
+}
+
+func TestFinalReleaseLatestVersionOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	finalReleasePath := filepath.Join(workDir, "../test-assets/ntp-final-release")
+	finalReleaseCachePath := filepath.Join(workDir, "../test-assets/ntp-release/bosh-cache")
+
+	release, err := NewFinalRelease(finalReleasePath, "", "", finalReleaseCachePath, nil)
+
+	assert.NoError(err)
+	assert.NotNil(release)
+	assert.Equal("ntp", release.Name)
+	assert.Equal("2", release.Version)
+}
+
+func TestFinalReleaseSpecificVersionOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	finalReleasePath := filepath.Join(workDir, "../test-assets/ntp-final-release")
+	finalReleaseCachePath := filepath.Join(workDir, "../test-assets/ntp-release/bosh-cache")
+
+	release, err := NewFinalRelease(finalReleasePath, "", "1", finalReleaseCachePath, nil)
+
+	assert.NoError(err)
+	assert.NotNil(release)
+	assert.Equal("1", release.Version)
+}
+
+func TestFinalReleaseJobsOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	finalReleasePath := filepath.Join(workDir, "../test-assets/ntp-final-release")
+	finalReleaseCachePath := filepath.Join(workDir, "../test-assets/ntp-release/bosh-cache")
+
+	release, err := NewFinalRelease(finalReleasePath, "", "", finalReleaseCachePath, nil)
+	assert.NoError(err)
+
+	assert.Len(release.Jobs, 1)
+	assert.Equal("ntpd", release.Jobs[0].Name)
+	assert.Equal(filepath.Join(finalReleaseCachePath, "aab8da0094ac318f790ca40c53f7a5f4e137f841"), release.Jobs[0].Path)
+
+	assert.Len(release.Packages, 1)
+	assert.Equal("ntp-4.2.8p2", release.Packages[0].Name)
+	assert.Equal(filepath.Join(finalReleaseCachePath, "e41461c222b05f961350547da086569cc4264e54"), release.Packages[0].Path)
+}
+
+func TestFinalReleaseValidationNotOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	// The dev release fixture has no 'releases' directory
+	devReleasePath := filepath.Join(workDir, "../test-assets/test-dev-release")
+	devReleaseCachePath := filepath.Join(workDir, "../test-assets/test-dev-release-cache")
+
+	_, err = NewFinalRelease(devReleasePath, "", "", devReleaseCachePath, nil)
+
+	assert.Error(err)
+	assert.Contains(err.Error(), "release 'releases' directory")
+}
@@ -1,10 +1,8 @@
 package model
 
 import (
-	"crypto/sha1"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -27,24 +25,53 @@ type Job struct {
 	Properties  []*JobProperty
 	Version     string
 	Release     *Release
-
-	jobReleaseInfo map[interface{}]interface{}
-	jobSpec        map[interface{}]interface{}
+	Consumes    []*JobLinkSpec // The links the job consumes, from its spec
+	Provides    []*JobLinkSpec // The links the job provides, from its spec
 }
 
 // Jobs is an array of Job*
 type Jobs []*Job
 
-func newJob(release *Release, jobReleaseInfo map[interface{}]interface{}) (*Job, error) {
-	job := &Job{
-		Release: release,
+// JobLinkSpec is a link a job consumes or provides, as declared in its spec
+type JobLinkSpec struct {
+	Name       string   `yaml:"name"`
+	Type       string   `yaml:"type"`
+	Optional   bool     `yaml:"optional"`   // Consumed links only
+	Properties []string `yaml:"properties"` // Provided links only
+}
 
-		jobReleaseInfo: jobReleaseInfo,
-	}
+// jobSpec is the job.MF of a job
+type jobSpec struct {
+	Name        string                      `yaml:"name"`
+	Description string                      `yaml:"description"`
+	Templates   map[string]string           `yaml:"templates"`
+	Packages    []string                    `yaml:"packages"`
+	Properties  map[string]*jobSpecProperty `yaml:"properties"`
+	Consumes    []*JobLinkSpec              `yaml:"consumes"`
+	Provides    []*JobLinkSpec              `yaml:"provides"`
+	Logs        map[string]string           `yaml:"logs"`
+
+	*manifest `yaml:"-"`
+}
 
-	if err := job.loadJobInfo(); err != nil {
-		return nil, err
+// jobSpecProperty is the definition of a property in a job spec
+type jobSpecProperty struct {
+	Description string      `yaml:"description"`
+	Default     interface{} `yaml:"default"`
+	Type        string      `yaml:"type"`
+	Example     interface{} `yaml:"example"`
+	Examples    interface{} `yaml:"examples"`
+}
+
+func newJob(release *Release, releaseInfo *releaseManifestEntry) (*Job, error) {
+	job := &Job{
+		Release:     release,
+		Name:        releaseInfo.Name,
+		Version:     releaseInfo.Version,
+		Fingerprint: releaseInfo.Fingerprint,
+		SHA1:        releaseInfo.SHA1,
 	}
+	job.Path = job.jobArchivePath()
 
 	if err := job.loadJobSpec(); err != nil {
 		return nil, err
@@ -63,30 +90,11 @@ func (j *Job) getProperty(name string) (*JobProperty, error) {
 	return nil, fmt.Errorf("Property %s not found in job %s", name, j.Name)
 }
 
-// ValidateSHA1 validates that the SHA1 of the actual job archive is the same
-// as the one from the release manifest
+// ValidateSHA1 validates that the digest of the actual job archive is the
+// same as the one from the release manifest; despite the name, the manifest
+// may also use the BOSH multi-digest format (e.g. sha256:...)
 func (j *Job) ValidateSHA1() error {
-	file, err := os.Open(j.Path)
-	if err != nil {
-		return fmt.Errorf("Error opening the job archive %s for sha1 calculation", j.Path)
-	}
-
-	defer file.Close()
-
-	h := sha1.New()
-
-	_, err = io.Copy(h, file)
-	if err != nil {
-		return fmt.Errorf("Error copying job archive %s for sha1 calculation", j.Path)
-	}
-
-	computedSha1 := fmt.Sprintf("%x", h.Sum(nil))
-
-	if computedSha1 != j.SHA1 {
-		return fmt.Errorf("Computed sha1 (%s) is different than manifest sha1 (%s) for job archive %s", computedSha1, j.SHA1, j.Path)
-	}
-
-	return nil
+	return validateArchiveDigest(j.Path, j.SHA1, "job archive")
 }
 
 // Extract will extract the contents of the job archive to destination
@@ -105,29 +113,88 @@ func (j *Job) Extract(destination string) (string, error) {
 	return targetDir, nil
 }
 
-func (j *Job) loadJobInfo() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load job information: %s", r)
+func (j *Job) loadJobSpec() error {
+	entry, err := readJobSpecCache(j)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		if entry, err = j.readJobSpecArchive(); err != nil {
+			return err
 		}
-	}()
+		if err := writeJobSpecCache(j, entry); err != nil {
+			return err
+		}
+	}
 
-	j.Name = j.jobReleaseInfo["name"].(string)
-	j.Version = j.jobReleaseInfo["version"].(string)
-	j.Fingerprint = j.jobReleaseInfo["fingerprint"].(string)
-	j.SHA1 = j.jobReleaseInfo["sha1"].(string)
-	j.Path = j.jobArchivePath()
+	var spec jobSpec
+	spec.manifest, err = unmarshalManifest(j.Path, "job.MF", []byte(entry.Spec), &spec)
+	if err != nil {
+		return fmt.Errorf("Error trying to load spec of job %s:\n%s", j.Name, err.Error())
+	}
 
-	return nil
-}
+	j.Description = spec.Description
+	j.Consumes = spec.Consumes
+	j.Provides = spec.Provides
 
-func (j *Job) loadJobSpec() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load job spec: %s", r)
+	for idx, pkgName := range spec.Packages {
+		dependency, err := j.Release.LookupPackage(pkgName)
+		if err != nil {
+			path := fmt.Sprintf("packages[%d]", idx)
+			return spec.errorf(path, "Cannot find dependency for job %s: %v", j.Name, err.Error())
 		}
-	}()
 
+		j.Packages = append(j.Packages, dependency)
+	}
+
+	// Templates and properties are loaded in sorted order, so that we are
+	// consistent and avoid flaky tests
+	var sources []string
+	for source := range spec.Templates {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		templateContent, ok := entry.Templates[source]
+		if !ok {
+			return spec.errorf("templates."+source, "Template %s of job %s not found", source, j.Name)
+		}
+
+		j.Templates = append(j.Templates, &JobTemplate{
+			SourcePath:      source,
+			DestinationPath: spec.Templates[source],
+			Job:             j,
+			Content:         templateContent,
+		})
+	}
+
+	var propertyNames []string
+	for propertyName := range spec.Properties {
+		propertyNames = append(propertyNames, propertyName)
+	}
+	sort.Strings(propertyNames)
+	for _, propertyName := range propertyNames {
+		property := &JobProperty{
+			Name: propertyName,
+			Job:  j,
+		}
+
+		if definition := spec.Properties[propertyName]; definition != nil {
+			property.Description = definition.Description
+			property.Default = definition.Default
+			property.Type = definition.Type
+			property.Example = definition.Example
+		}
+
+		j.Properties = append(j.Properties, property)
+	}
+
+	return nil
+}
+
+// readJobSpecArchive extracts the job archive into a temporary directory to
+// read the job spec and its templates
+func (j *Job) readJobSpecArchive() (entry *jobSpecCacheEntry, err error) {
 	tempJobDir, err := ioutil.TempDir("", "fissile-job-dir")
 	defer func() {
 		if cleanupErr := os.RemoveAll(tempJobDir); cleanupErr != nil && err != nil {
@@ -137,94 +204,42 @@ func (j *Job) loadJobSpec() (err error) {
 		}
 	}()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	jobDir, err := j.Extract(tempJobDir)
 	if err != nil {
-		return fmt.Errorf("Error extracting archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
+		return nil, fmt.Errorf("Error extracting archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
 	}
 
-	specFile := filepath.Join(jobDir, "job.MF")
-
-	specContents, err := ioutil.ReadFile(specFile)
+	specContents, err := ioutil.ReadFile(filepath.Join(jobDir, "job.MF"))
 	if err != nil {
-		return err
-	}
-
-	if err := yaml.Unmarshal([]byte(specContents), &j.jobSpec); err != nil {
-		return err
+		return nil, err
 	}
 
-	if j.jobSpec["description"] != nil {
-		j.Description = j.jobSpec["description"].(string)
+	// Problems with the spec are reported, with their location, when it is
+	// parsed; only the template names are needed here
+	var spec struct {
+		Templates map[string]string `yaml:"templates"`
 	}
+	yaml.Unmarshal(specContents, &spec)
 
-	if j.jobSpec["packages"] != nil {
-		for _, pkg := range j.jobSpec["packages"].([]interface{}) {
-			pkgName := pkg.(string)
-			dependency, err := j.Release.LookupPackage(pkgName)
-			if err != nil {
-				return fmt.Errorf("Cannot find dependency for job %s: %v", j.Name, err.Error())
-			}
-
-			j.Packages = append(j.Packages, dependency)
-		}
+	entry = &jobSpecCacheEntry{
+		Name:        j.Name,
+		Fingerprint: j.Fingerprint,
+		Spec:        string(specContents),
+		Templates:   make(map[string]string, len(spec.Templates)),
 	}
 
-	if j.jobSpec["templates"] != nil {
-		for source, destination := range j.jobSpec["templates"].(map[interface{}]interface{}) {
-			templateFile := filepath.Join(jobDir, "templates", source.(string))
-
-			templateContent, err := ioutil.ReadFile(templateFile)
-			if err != nil {
-				return err
-			}
-
-			template := &JobTemplate{
-				SourcePath:      source.(string),
-				DestinationPath: destination.(string),
-				Job:             j,
-				Content:         string(templateContent),
-			}
-
-			j.Templates = append(j.Templates, template)
-		}
-	}
-
-	if j.jobSpec["properties"] != nil {
-		// We want to load the properties in sorted order, so that we are
-		// consistent and avoid flaky tests
-		properties := j.jobSpec["properties"].(map[interface{}]interface{})
-		var propertyNames []string
-		for propertyName := range properties {
-			propertyNames = append(propertyNames, propertyName.(string))
-		}
-		sort.Strings(propertyNames)
-		for _, propertyName := range propertyNames {
-
-			property := &JobProperty{
-				Name: propertyName,
-				Job:  j,
-			}
-
-			propertyDefinition := properties[propertyName]
-			if propertyDefinition != nil {
-				propertyDefinitionMap := propertyDefinition.(map[interface{}]interface{})
-
-				if propertyDefinitionMap["description"] != nil {
-					property.Description = propertyDefinitionMap["description"].(string)
-				}
-				if propertyDefinitionMap["default"] != nil {
-					property.Default = propertyDefinitionMap["default"]
-				}
-			}
-
-			j.Properties = append(j.Properties, property)
+	for source := range spec.Templates {
+		templateContent, err := ioutil.ReadFile(filepath.Join(jobDir, "templates", source))
+		if err != nil {
+			return nil, err
 		}
+		entry.Templates[source] = string(templateContent)
 	}
 
-	return nil
+	return entry, nil
 }
 
 // MergeSpec is used to merge temporary spec patches into each job. otherJob should only be
@@ -253,6 +268,13 @@ func (j *Job) WriteConfigs(role *Role, outputPath, lightOpinionsPath, darkOpinio
 	}
 	config["job"].(map[string]interface{})["templates"] = templates
 
+	// The instance spec depends on the pod the job ends up in, so it is only
+	// filled in by the run script at container start
+	config["name"] = role.Name
+	for field, placeholder := range InstanceSpecPlaceholders {
+		config[field] = placeholder
+	}
+
 	opinions, err := newOpinions(lightOpinionsPath, darkOpinionsPath)
 	if err != nil {
 		return err
@@ -263,6 +285,14 @@ func (j *Job) WriteConfigs(role *Role, outputPath, lightOpinionsPath, darkOpinio
 	}
 	config["properties"] = properties
 
+	links, err := j.getLinksForJob(role, opinions)
+	if err != nil {
+		return err
+	}
+	if len(links) > 0 {
+		config["links"] = links
+	}
+
 	// Write out the configuration
 	err = os.MkdirAll(filepath.Dir(outputPath), 0755)
 	if err != nil {
@@ -279,6 +309,25 @@ func (j *Job) WriteConfigs(role *Role, outputPath, lightOpinionsPath, darkOpinio
 	return nil
 }
 
+// getLinksForJob returns the data of the links the job consumes in the role,
+// keyed by link name
+func (j *Job) getLinksForJob(role *Role, opinions *opinions) (map[string]interface{}, error) {
+	links := map[string]interface{}{}
+	for _, roleJob := range role.JobNameList {
+		if roleJob.job != j {
+			continue
+		}
+		for name, provider := range roleJob.links {
+			link, err := provider.linkConfig(opinions)
+			if err != nil {
+				return nil, fmt.Errorf("Error configuring link %s of job %s: %s", name, j.Name, err.Error())
+			}
+			links[name] = link
+		}
+	}
+	return links, nil
+}
+
 // getPropertiesForJob returns the parameters for the given job, using its specs and opinions
 func (j *Job) getPropertiesForJob(opinions *opinions) (map[string]interface{}, error) {
 	props := make(map[string]interface{})
@@ -341,6 +390,20 @@ func (j *Job) getPropertiesForJob(opinions *opinions) (map[string]interface{}, e
 	return props, nil
 }
 
+// InstanceSpecPlaceholders are the values of the BOSH instance spec fields in
+// the config spec of jobs, keyed by field; the run script replaces them with
+// the actual values (including the quotes, as index and bootstrap are not
+// strings) before rendering the job templates
+var InstanceSpecPlaceholders = map[string]string{
+	"id":         "__FISSILE_SPEC_ID__",
+	"index":      "__FISSILE_SPEC_INDEX__",
+	"az":         "__FISSILE_SPEC_AZ__",
+	"bootstrap":  "__FISSILE_SPEC_BOOTSTRAP__",
+	"address":    "__FISSILE_SPEC_ADDRESS__",
+	"deployment": "__FISSILE_SPEC_DEPLOYMENT__",
+	"ip":         "__FISSILE_SPEC_IP__",
+}
+
 // initializeConfigJSON returns the scaffolding for the BOSH-style JSON structure
 func initializeConfigJSON() (map[string]interface{}, error) {
 	var config map[string]interface{}
@@ -376,5 +439,9 @@ func (slice Jobs) Swap(i, j int) {
 }
 
 func (j *Job) jobArchivePath() string {
+	if j.Release.Type == ReleaseTypeTarball {
+		return j.Release.tarballJobArchivePath(j.Name)
+	}
+
 	return filepath.Join(j.Release.DevBOSHCacheDir, j.SHA1)
 }
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// jobSpecCacheEntry is the cached spec of a job archive
+type jobSpecCacheEntry struct {
+	Name        string            `yaml:"name"`
+	Fingerprint string            `yaml:"fingerprint"`
+	Spec        string            `yaml:"spec"`      // The contents of job.MF
+	Templates   map[string]string `yaml:"templates"` // The contents of the templates, by source path
+}
+
+// jobSpecCachePath returns the path of the cache entry for the job; digests
+// in the BOSH multi-digest format are turned into a file name
+func jobSpecCachePath(j *Job) string {
+	name := strings.NewReplacer(":", "-", ";", "_", string(filepath.Separator), "_").Replace(j.SHA1)
+	return filepath.Join(j.Release.options.JobSpecCacheDir, name+".yml")
+}
+
+// readJobSpecCache returns the cached spec of the job, or nil if there is
+// none. Entries for a different job or fingerprint are ignored, so that they
+// get replaced.
+func readJobSpecCache(j *Job) (*jobSpecCacheEntry, error) {
+	if j.Release.options.JobSpecCacheDir == "" || j.SHA1 == "" {
+		return nil, nil
+	}
+
+	contents, err := ioutil.ReadFile(jobSpecCachePath(j))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading cached spec of job %s: %s", j.Name, err.Error())
+	}
+
+	var entry jobSpecCacheEntry
+	if err := yaml.Unmarshal(contents, &entry); err != nil {
+		// A corrupt entry is as good as a missing one
+		return nil, nil
+	}
+
+	if entry.Name != j.Name || entry.Fingerprint != j.Fingerprint {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// writeJobSpecCache stores the spec of the job in the cache. The entry is
+// renamed into place, so concurrent fissile runs never see a partial entry.
+func writeJobSpecCache(j *Job, entry *jobSpecCacheEntry) error {
+	if j.Release.options.JobSpecCacheDir == "" || j.SHA1 == "" {
+		return nil
+	}
+
+	contents, err := yaml.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Error serializing spec of job %s: %s", j.Name, err.Error())
+	}
+
+	cacheDir := j.Release.options.JobSpecCacheDir
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("Error creating job spec cache directory %s: %s", cacheDir, err.Error())
+	}
+
+	tempFile, err := ioutil.TempFile(cacheDir, ".job-spec")
+	if err != nil {
+		return fmt.Errorf("Error caching spec of job %s: %s", j.Name, err.Error())
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(contents)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), jobSpecCachePath(j))
+	}
+	if err != nil {
+		return fmt.Errorf("Error caching spec of job %s: %s", j.Name, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestJobSpecCache(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	tempDir, err := ioutil.TempDir("", "fissile-job-spec-cache")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+
+	// Copy the job archives, so that they can be removed
+	boshCacheDir := filepath.Join(tempDir, "bosh-cache")
+	if !assert.NoError(os.MkdirAll(boshCacheDir, 0755)) {
+		return
+	}
+	original, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	for _, job := range original.Jobs {
+		contents, err := ioutil.ReadFile(job.Path)
+		if !assert.NoError(err) {
+			return
+		}
+		assert.NoError(ioutil.WriteFile(filepath.Join(boshCacheDir, filepath.Base(job.Path)), contents, 0644))
+	}
+
+	options := &ReleaseOptions{JobSpecCacheDir: filepath.Join(tempDir, "job-specs")}
+
+	release, err := NewDevRelease(torReleasePath, "", "", boshCacheDir, options)
+	if !assert.NoError(err) {
+		return
+	}
+
+	for _, job := range release.Jobs {
+		assert.NoError(util.ValidatePath(jobSpecCachePath(job), false, "cached job spec"))
+		assert.NoError(os.Remove(job.Path))
+	}
+
+	cached, err := NewDevRelease(torReleasePath, "", "", boshCacheDir, options)
+	if !assert.NoError(err, "Cached job specs should be used without the archives") {
+		return
+	}
+	if assert.Len(cached.Jobs, len(release.Jobs)) {
+		for idx, job := range cached.Jobs {
+			assert.Equal(release.Jobs[idx].Name, job.Name)
+			assert.Equal(release.Jobs[idx].Description, job.Description)
+			assert.Equal(len(release.Jobs[idx].Properties), len(job.Properties))
+			assert.Equal(len(release.Jobs[idx].Packages), len(job.Packages))
+			if assert.Equal(len(release.Jobs[idx].Templates), len(job.Templates)) {
+				for _, template := range job.Templates {
+					assert.NotEmpty(template.Content)
+				}
+			}
+		}
+	}
+
+	// An entry with a different fingerprint is stale, so the missing archive
+	// has to be extracted again
+	job := release.Jobs[0]
+	entry, err := readJobSpecCache(job)
+	if !assert.NoError(err) || !assert.NotNil(entry) {
+		return
+	}
+	entry.Fingerprint = "stale"
+	contents, err := yaml.Marshal(entry)
+	assert.NoError(err)
+	assert.NoError(ioutil.WriteFile(jobSpecCachePath(job), contents, 0644))
+
+	_, err = NewDevRelease(torReleasePath, "", "", boshCacheDir, options)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "Error extracting archive")
+	}
+}
+
+func TestJobSpecCachePath(t *testing.T) {
+	assert := assert.New(t)
+
+	release := &Release{options: ReleaseOptions{JobSpecCacheDir: "/cache"}}
+	job := &Job{SHA1: "sha256:abc;sha512:def", Release: release}
+	assert.Equal("/cache/sha256-abc_sha512-def.yml", jobSpecCachePath(job))
+}
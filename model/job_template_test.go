@@ -16,7 +16,7 @@ func TestJobTemplatesContentOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -21,7 +21,7 @@ func TestJobInfoOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -49,7 +49,7 @@ func TestJobSha1Ok(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -65,7 +65,7 @@ func TestJobSha1NotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -84,7 +84,7 @@ func TestJobExtractOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -108,7 +108,7 @@ func TestJobPackagesOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -125,7 +125,7 @@ func TestJobTemplatesOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathCacheDir := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathCacheDir, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -147,7 +147,7 @@ func TestJobPropertiesOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -170,7 +170,7 @@ func TestGetJobPropertyOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -191,7 +191,7 @@ func TestGetJobPropertyNotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -232,7 +232,7 @@ func TestJobsProperties(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -34,6 +34,25 @@ func insertConfig(config map[string]interface{}, name string, value interface{})
 	return nil
 }
 
+// lookupConfig returns a value from a configuration map built by insertConfig
+func lookupConfig(config map[string]interface{}, name string) (interface{}, bool) {
+	keyPieces, err := getKeyGrams(name)
+	if err != nil {
+		return nil, false
+	}
+
+	parent := config
+	for _, key := range keyPieces[:len(keyPieces)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		parent = child
+	}
+	value, ok := parent[keyPieces[len(keyPieces)-1]]
+	return value, ok
+}
+
 func getOpinionValue(parent map[interface{}]interface{}, keys []string) (interface{}, bool) {
 	var key string
 	for _, key = range keys[:len(keys)-1] {
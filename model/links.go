@@ -0,0 +1,241 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// roleJobConsumes overrides how a link consumed by a job of a role is resolved
+type roleJobConsumes struct {
+	From string `yaml:"from"` // The name (or alias) of the provided link to use
+}
+
+// roleJobProvides overrides how a link provided by a job of a role is known
+type roleJobProvides struct {
+	As string `yaml:"as"` // The alias consumers can refer to the link by
+}
+
+// linkProvider is a link provided by a job of a role
+type linkProvider struct {
+	name string // The alias from the role manifest, or the name from the job spec
+	role *Role
+	job  *Job
+	spec *JobLinkSpec
+}
+
+func (p *linkProvider) String() string {
+	return fmt.Sprintf("%s/%s", p.role.Name, p.job.Name)
+}
+
+// resolveLinks resolves the links consumed by the jobs of the roles to the
+// links provided by the jobs of the roles. Consumed links are matched by the
+// name given in the role manifest, or else by type, preferring providers in
+// the same role. The problems found are returned with the paths of the
+// offending role manifest nodes; the roles are expected to be those of the
+// manifest, in order.
+func resolveLinks(roles Roles) ValidationErrors {
+	var errs ValidationErrors
+	addError := func(path, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var providers []*linkProvider
+	for i, role := range roles {
+		for j, roleJob := range role.JobNameList {
+			if roleJob.job == nil {
+				continue
+			}
+			path := fmt.Sprintf("roles[%d].jobs[%d]", i, j)
+
+			for _, name := range roleJob.providesOverrides() {
+				if findLinkSpec(roleJob.job.Provides, name) == nil {
+					addError(path+".provides."+name, "Job %s in role %s does not provide a link %s", roleJob.Name, role.Name, name)
+				}
+			}
+
+			for _, spec := range roleJob.job.Provides {
+				provider := &linkProvider{name: spec.Name, role: role, job: roleJob.job, spec: spec}
+				if override := roleJob.Provides[spec.Name]; override != nil && override.As != "" {
+					provider.name = override.As
+				}
+				providers = append(providers, provider)
+			}
+		}
+	}
+
+	for i, role := range roles {
+		for j, roleJob := range role.JobNameList {
+			if roleJob.job == nil {
+				continue
+			}
+			path := fmt.Sprintf("roles[%d].jobs[%d]", i, j)
+			roleJob.links = map[string]*linkProvider{}
+
+			for _, name := range roleJob.consumesOverrides() {
+				if findLinkSpec(roleJob.job.Consumes, name) == nil {
+					addError(path+".consumes."+name, "Job %s in role %s does not consume a link %s", roleJob.Name, role.Name, name)
+				}
+			}
+
+			for _, spec := range roleJob.job.Consumes {
+				var candidates []*linkProvider
+				consumerPath := path
+
+				if override := roleJob.Consumes[spec.Name]; override != nil && override.From != "" {
+					consumerPath = path + ".consumes." + spec.Name + ".from"
+					for _, provider := range providers {
+						if provider.name == override.From {
+							candidates = append(candidates, provider)
+						}
+					}
+					if len(candidates) == 1 && candidates[0].spec.Type != spec.Type {
+						addError(consumerPath, "Link %s consumed by job %s in role %s is a %s link, but %s provides a %s link",
+							spec.Name, roleJob.Name, role.Name, spec.Type, candidates[0], candidates[0].spec.Type)
+						continue
+					}
+					if len(candidates) == 0 {
+						addError(consumerPath, "Link %s consumed by job %s in role %s is taken from %s, which no job provides",
+							spec.Name, roleJob.Name, role.Name, override.From)
+						continue
+					}
+				} else {
+					var sameRole []*linkProvider
+					for _, provider := range providers {
+						if provider.spec.Type != spec.Type {
+							continue
+						}
+						candidates = append(candidates, provider)
+						if provider.role == role {
+							sameRole = append(sameRole, provider)
+						}
+					}
+					if len(sameRole) == 1 {
+						candidates = sameRole
+					}
+					if len(candidates) == 0 {
+						if !spec.Optional {
+							addError(consumerPath, "Link %s (%s) consumed by job %s in role %s is not provided by any job",
+								spec.Name, spec.Type, roleJob.Name, role.Name)
+						}
+						continue
+					}
+				}
+
+				if len(candidates) > 1 {
+					names := make([]string, len(candidates))
+					for k, candidate := range candidates {
+						names[k] = candidate.String()
+					}
+					addError(consumerPath, "Link %s (%s) consumed by job %s in role %s is provided by more than one job: %s",
+						spec.Name, spec.Type, roleJob.Name, role.Name, strings.Join(names, ", "))
+					continue
+				}
+
+				roleJob.links[spec.Name] = candidates[0]
+			}
+		}
+	}
+
+	return errs
+}
+
+// linkConfig returns the data of a resolved link, as it is found in the
+// "links" section of a BOSH job spec. The instances are the pods of the
+// providing role; their number may change without the images being rebuilt,
+// so the run script fills them in at container start in place of the
+// placeholder of the role. Properties are those the providing job declares
+// for the link.
+func (p *linkProvider) linkConfig(opinions *opinions) (map[string]interface{}, error) {
+	jobProperties, err := p.job.getPropertiesForJob(opinions)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := map[string]interface{}{}
+	for _, name := range p.spec.Properties {
+		value, _ := lookupConfig(jobProperties, name)
+		if err := insertConfig(properties, name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"address":    p.role.Name,
+		"instances":  p.role.LinkInstancesPlaceholder(),
+		"properties": properties,
+	}, nil
+}
+
+// linkProviderRoles returns the roles providing the links consumed by the
+// jobs of a role, once the links are resolved
+func (r *Role) linkProviderRoles() map[*Role]bool {
+	result := map[*Role]bool{}
+	for _, roleJob := range r.JobNameList {
+		for _, provider := range roleJob.links {
+			result[provider.role] = true
+		}
+	}
+	return result
+}
+
+// LinkProviderRoles returns the roles providing the links consumed by the jobs
+// of the role, in the order of the role manifest
+func (r *Role) LinkProviderRoles() Roles {
+	if r.rolesManifest == nil {
+		return nil
+	}
+
+	providers := r.linkProviderRoles()
+	var result Roles
+	for _, role := range r.rolesManifest.Roles {
+		if providers[role] {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// LinkInstancesEnvVar returns the name of the environment variable holding the
+// number of instances of the role in the pods of the roles consuming its links
+func (r *Role) LinkInstancesEnvVar() string {
+	return "FISSILE_LINK_INSTANCES_" + strings.ToUpper(strings.Replace(r.Name, "-", "_", -1))
+}
+
+// LinkInstancesPlaceholder returns the value of the instances of the links
+// provided by the role in the config spec of the consuming jobs; the run script
+// replaces it (including the quotes) with the list of the instances
+func (r *Role) LinkInstancesPlaceholder() string {
+	return "__" + r.LinkInstancesEnvVar() + "__"
+}
+
+func findLinkSpec(specs []*JobLinkSpec, name string) *JobLinkSpec {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	return nil
+}
+
+// consumesOverrides returns the names of the consumed links overridden in the
+// role manifest, sorted
+func (j *roleJob) consumesOverrides() []string {
+	var names []string
+	for name := range j.Consumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providesOverrides returns the names of the provided links overridden in the
+// role manifest, sorted
+func (j *roleJob) providesOverrides() []string {
+	var names []string
+	for name := range j.Provides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,169 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// linkTestRole creates a role whose jobs are given with the role manifest
+// entries referring to them
+func linkTestRole(name string, jobs ...*roleJob) *Role {
+	role := &Role{Name: name, JobNameList: jobs}
+	for _, roleJob := range jobs {
+		roleJob.Name = roleJob.job.Name
+		role.Jobs = append(role.Jobs, roleJob.job)
+	}
+	return role
+}
+
+func TestResolveLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	mysql := &Job{Name: "mysql", Provides: []*JobLinkSpec{{Name: "db", Type: "database"}}}
+	postgres := &Job{Name: "postgres", Provides: []*JobLinkSpec{{Name: "db", Type: "database"}}}
+	api := &Job{Name: "api", Consumes: []*JobLinkSpec{
+		{Name: "database", Type: "database"},
+		{Name: "cache", Type: "memcached", Optional: true},
+	}}
+	worker := &Job{Name: "worker", Consumes: []*JobLinkSpec{{Name: "database", Type: "database"}}}
+
+	apiJob := &roleJob{job: api}
+	workerJob := &roleJob{job: worker}
+	roles := Roles{
+		linkTestRole("mysql", &roleJob{job: mysql}),
+		linkTestRole("api", apiJob, &roleJob{job: postgres}),
+		linkTestRole("worker", workerJob),
+	}
+
+	errs := resolveLinks(roles)
+	if assert.Len(errs, 1) {
+		assert.Equal("roles[2].jobs[0]", errs[0].Path)
+		assert.Equal("Link database (database) consumed by job worker in role worker is provided by more than one job: mysql/mysql, api/postgres", errs[0].Message)
+	}
+
+	// Providers in the same role are preferred; optional links may be missing
+	if assert.Len(apiJob.links, 1) {
+		assert.Equal("postgres", apiJob.links["database"].job.Name)
+	}
+
+	// Aliases from the role manifest pick the provider explicitly
+	roles[0].JobNameList[0].Provides = map[string]*roleJobProvides{"db": {As: "main-db"}}
+	workerJob.Consumes = map[string]*roleJobConsumes{"database": {From: "main-db"}}
+
+	assert.Empty(resolveLinks(roles))
+	if assert.Len(workerJob.links, 1) {
+		assert.Equal("mysql", workerJob.links["database"].role.Name)
+	}
+}
+
+func TestResolveLinksErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	web := &Job{Name: "web", Provides: []*JobLinkSpec{{Name: "web", Type: "http"}}}
+	api := &Job{Name: "api", Consumes: []*JobLinkSpec{
+		{Name: "database", Type: "database"},
+		{Name: "backend", Type: "database"},
+	}}
+
+	roles := Roles{
+		linkTestRole("web", &roleJob{job: web, Provides: map[string]*roleJobProvides{"http": {As: "frontend"}}}),
+		linkTestRole("api", &roleJob{job: api, Consumes: map[string]*roleJobConsumes{
+			"backend": {From: "web"},
+			"cache":   {From: "memcached"},
+		}}),
+	}
+
+	errs := resolveLinks(roles)
+	if !assert.Len(errs, 4) {
+		return
+	}
+
+	assert.Equal("roles[0].jobs[0].provides.http", errs[0].Path)
+	assert.Equal("Job web in role web does not provide a link http", errs[0].Message)
+	assert.Equal("roles[1].jobs[0].consumes.cache", errs[1].Path)
+	assert.Equal("Job api in role api does not consume a link cache", errs[1].Message)
+	assert.Equal("roles[1].jobs[0]", errs[2].Path)
+	assert.Equal("Link database (database) consumed by job api in role api is not provided by any job", errs[2].Message)
+	assert.Equal("roles[1].jobs[0].consumes.backend.from", errs[3].Path)
+	assert.Equal("Link backend consumed by job api in role api is a database link, but web/web provides a http link", errs[3].Message)
+}
+
+func TestLinkConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	mysql := &Job{Name: "mysql", Provides: []*JobLinkSpec{{Name: "db", Type: "database", Properties: []string{"db.port", "db.user"}}}}
+	mysql.Properties = []*JobProperty{
+		{Name: "db.port", Default: 3306, Job: mysql},
+		{Name: "db.user", Default: "admin", Job: mysql},
+		{Name: "db.password", Default: "secret", Job: mysql},
+	}
+	api := &Job{Name: "api", Consumes: []*JobLinkSpec{{Name: "database", Type: "database"}}}
+
+	mysqlRole := linkTestRole("mysql", &roleJob{job: mysql})
+	apiRole := linkTestRole("api", &roleJob{job: api})
+
+	if !assert.Empty(resolveLinks(Roles{mysqlRole, apiRole})) {
+		return
+	}
+
+	opinions := &opinions{
+		Light: map[string]interface{}{"properties": map[interface{}]interface{}{
+			"db": map[interface{}]interface{}{"port": 3307},
+		}},
+		Dark: map[string]interface{}{"properties": map[interface{}]interface{}{}},
+	}
+
+	links, err := api.getLinksForJob(apiRole, opinions)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(map[string]interface{}{
+		"database": map[string]interface{}{
+			"address":   "mysql",
+			"instances": "__FISSILE_LINK_INSTANCES_MYSQL__",
+			"properties": map[string]interface{}{
+				"db": map[string]interface{}{"port": 3307, "user": "admin"},
+			},
+		},
+	}, links)
+
+	links, err = mysql.getLinksForJob(mysqlRole, opinions)
+	if assert.NoError(err) {
+		assert.Empty(links, "Jobs that consume no links should have none")
+	}
+}
+
+func TestLinkProviderRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	mysql := &Job{Name: "mysql", Provides: []*JobLinkSpec{{Name: "db", Type: "database"}}}
+	memcached := &Job{Name: "memcached", Provides: []*JobLinkSpec{{Name: "cache", Type: "memcached"}}}
+	api := &Job{Name: "api", Consumes: []*JobLinkSpec{
+		{Name: "cache", Type: "memcached"},
+		{Name: "database", Type: "database"},
+	}}
+
+	rolesManifest := &RoleManifest{Roles: Roles{
+		linkTestRole("cache", &roleJob{job: memcached}),
+		linkTestRole("api", &roleJob{job: api}),
+		linkTestRole("mysql-db", &roleJob{job: mysql}),
+	}}
+	for _, role := range rolesManifest.Roles {
+		role.rolesManifest = rolesManifest
+	}
+
+	if !assert.Empty(resolveLinks(rolesManifest.Roles)) {
+		return
+	}
+
+	providers := rolesManifest.Roles[1].LinkProviderRoles()
+	if assert.Len(providers, 2) {
+		assert.Equal("cache", providers[0].Name)
+		assert.Equal("mysql-db", providers[1].Name)
+		assert.Equal("FISSILE_LINK_INSTANCES_MYSQL_DB", providers[1].LinkInstancesEnvVar())
+		assert.Equal("__FISSILE_LINK_INSTANCES_MYSQL_DB__", providers[1].LinkInstancesPlaceholder())
+	}
+	assert.Empty(rolesManifest.Roles[0].LinkProviderRoles())
+}
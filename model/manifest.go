@@ -0,0 +1,211 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestError is a problem found while parsing a release manifest or a job
+// spec, located by file and line
+type ManifestError struct {
+	File    string
+	Entry   string // The file inside the archive File, if any
+	Line    int    // 0 if the line isn't known
+	Message string
+}
+
+func (e *ManifestError) Error() string {
+	location := e.File
+	if e.Entry != "" {
+		location = fmt.Sprintf("%s: %s", e.File, e.Entry)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", location, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", location, e.Message)
+}
+
+// ManifestErrors are all the problems found in a manifest
+type ManifestErrors []*ManifestError
+
+func (e ManifestErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// yamlErrorLineRegexp matches the line numbers starting the messages of YAML
+// syntax and type errors
+var yamlErrorLineRegexp = regexp.MustCompile(`^line (\d+): `)
+
+// yamlErrorLine splits an error message of the YAML parser into the line it
+// points at (0 if none) and the message without its location
+func yamlErrorLine(message string) (int, string) {
+	message = strings.TrimPrefix(message, "yaml: ")
+	if match := yamlErrorLineRegexp.FindStringSubmatch(message); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return line, message[len(match[0]):]
+	}
+	return 0, message
+}
+
+// manifest is a parsed YAML manifest, remembering where it came from so that
+// problems found later can still point at the right line
+type manifest struct {
+	file  string
+	entry string // The file inside the archive file, if any
+	lines yamlLines
+}
+
+// unmarshalManifest parses a YAML manifest into a typed struct. Malformed
+// values and fields not known to the struct are reported as ManifestErrors.
+// Manifests read from archives name the archive as file and their path in it
+// as entry.
+func unmarshalManifest(file, entry string, contents []byte, out interface{}) (*manifest, error) {
+	m := &manifest{file: file, entry: entry, lines: indexYAMLLines(contents)}
+
+	var errs ManifestErrors
+	if err := yaml.Unmarshal(contents, out); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, ManifestErrors{m.yamlError(err.Error())}
+		}
+		for _, message := range typeErr.Errors {
+			errs = append(errs, m.yamlError(message))
+		}
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, ManifestErrors{m.yamlError(err.Error())}
+	}
+	for _, path := range unknownYAMLFields(raw, reflect.TypeOf(out), "") {
+		errs = append(errs, m.errorf(path, "unknown field %s", path))
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return m, nil
+}
+
+// yamlError converts an error message of the YAML parser into a ManifestError
+func (m *manifest) yamlError(message string) *ManifestError {
+	line, message := yamlErrorLine(message)
+	return &ManifestError{File: m.file, Entry: m.entry, Line: line, Message: message}
+}
+
+// errorf returns a ManifestError located at the node at path
+func (m *manifest) errorf(path, format string, args ...interface{}) *ManifestError {
+	return &ManifestError{
+		File:    m.file,
+		Entry:   m.entry,
+		Line:    m.lines.lookup(path),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// requireFields reports the fields at path that are empty; fields are
+// given as pairs of name and value
+func (m *manifest) requireFields(path string, fields ...string) ManifestErrors {
+	var errs ManifestErrors
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			errs = append(errs, m.errorf(path, "%s has no %s", path, fields[i]))
+		}
+	}
+	return errs
+}
+
+// unknownYAMLFields returns the paths of the mapping keys in value that have
+// no matching field in typ, following the yaml tags of struct fields
+func unknownYAMLFields(value interface{}, typ reflect.Type, path string) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var unknown []string
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		mapping, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+
+		fields := map[string]reflect.Type{}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			fields[name] = field.Type
+		}
+
+		keys, values := sortedYAMLMapping(mapping)
+		for _, key := range keys {
+			keyPath := joinYAMLPath(path, key)
+			fieldType, ok := fields[key]
+			if !ok {
+				unknown = append(unknown, keyPath)
+				continue
+			}
+			unknown = append(unknown, unknownYAMLFields(values[key], fieldType, keyPath)...)
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownYAMLFields(item, typ.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+
+	case reflect.Map:
+		mapping, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		keys, values := sortedYAMLMapping(mapping)
+		for _, key := range keys {
+			unknown = append(unknown, unknownYAMLFields(values[key], typ.Elem(), joinYAMLPath(path, key))...)
+		}
+	}
+
+	return unknown
+}
+
+// sortedYAMLMapping returns the keys of a YAML mapping as sorted strings,
+// along with the mapping keyed by those strings
+func sortedYAMLMapping(mapping map[interface{}]interface{}) ([]string, map[string]interface{}) {
+	keys := make([]string, 0, len(mapping))
+	values := make(map[string]interface{}, len(mapping))
+	for key, value := range mapping {
+		name := fmt.Sprintf("%v", key)
+		keys = append(keys, name)
+		values[name] = value
+	}
+	sort.Strings(keys)
+	return keys, values
+}
+
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// loadTestReleaseManifest loads release.MF contents as the manifest of a
+// release tarball
+func loadTestReleaseManifest(assert *assert.Assertions, contents string) (string, error) {
+	tempDir, err := ioutil.TempDir("", "fissile-release-manifest")
+	if !assert.NoError(err) {
+		return "", nil
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifestPath := filepath.Join(tempDir, manifestFile)
+	assert.NoError(ioutil.WriteFile(manifestPath, []byte(contents), 0644))
+
+	release := &Release{Path: tempDir, Type: ReleaseTypeTarball}
+	return manifestPath, release.loadMetadata()
+}
+
+func TestReleaseManifestMalformedFields(t *testing.T) {
+	assert := assert.New(t)
+
+	manifestPath, err := loadTestReleaseManifest(assert, `name: bad
+version: "1"
+commit_hash: abc
+uncommitted_changes: maybe
+jobs:
+- name: myjob
+  version: abc
+  fingerprint: abc
+  checksum: abc
+`)
+	if !assert.Error(err) {
+		return
+	}
+
+	assert.Contains(err.Error(), manifestPath+":4: cannot unmarshal !!str `maybe` into bool")
+	assert.Contains(err.Error(), manifestPath+":9: unknown field jobs[0].checksum")
+}
+
+func TestReleaseManifestMissingFields(t *testing.T) {
+	assert := assert.New(t)
+
+	manifestPath, err := loadTestReleaseManifest(assert, `name: bad
+version: "1"
+jobs:
+- name: myjob
+  version: abc
+  fingerprint: abc
+packages:
+- name: mypkg
+  sha1: abc
+`)
+	if !assert.Error(err) {
+		return
+	}
+
+	assert.Contains(err.Error(), manifestPath+":4: jobs[0] has no sha1")
+	assert.Contains(err.Error(), manifestPath+":8: packages[0] has no version")
+	assert.Contains(err.Error(), manifestPath+":8: packages[0] has no fingerprint")
+}
+
+func TestReleaseManifestSyntaxError(t *testing.T) {
+	assert := assert.New(t)
+
+	manifestPath, err := loadTestReleaseManifest(assert, `name: bad
+version: [1
+`)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), manifestPath+":2: did not find expected ',' or ']'")
+	}
+}
+
+// loadTestJobSpec loads a job spec through the job spec cache
+func loadTestJobSpec(assert *assert.Assertions, spec string, templates map[string]string) (*Job, error) {
+	tempDir, err := ioutil.TempDir("", "fissile-job-spec")
+	if !assert.NoError(err) {
+		return nil, nil
+	}
+	defer os.RemoveAll(tempDir)
+
+	release := &Release{
+		Name:            "test",
+		Type:            ReleaseTypeDev,
+		DevBOSHCacheDir: tempDir,
+		options:         ReleaseOptions{JobSpecCacheDir: tempDir},
+	}
+	release.Packages = Packages{&Package{Name: "mypkg", Release: release}}
+
+	job := &Job{Name: "myjob", Fingerprint: "abc", SHA1: "def", Release: release}
+	job.Path = job.jobArchivePath()
+
+	assert.NoError(writeJobSpecCache(job, &jobSpecCacheEntry{
+		Name:        job.Name,
+		Fingerprint: job.Fingerprint,
+		Spec:        spec,
+		Templates:   templates,
+	}))
+
+	return job, job.loadJobSpec()
+}
+
+func TestJobSpecOptionalFields(t *testing.T) {
+	assert := assert.New(t)
+
+	job, err := loadTestJobSpec(assert, `name: myjob
+templates:
+  run.erb: bin/run
+packages:
+- mypkg
+consumes:
+- name: db
+  type: database
+  optional: true
+provides:
+- name: web
+  type: http
+  properties:
+  - port
+properties:
+  port:
+    description: The port
+    type: integer
+    default: 8080
+    example: 80
+  empty:
+`, map[string]string{"run.erb": "#!/bin/sh"})
+	if !assert.NoError(err) {
+		return
+	}
+
+	if assert.Len(job.Templates, 1) {
+		assert.Equal("bin/run", job.Templates[0].DestinationPath)
+		assert.Equal("#!/bin/sh", job.Templates[0].Content)
+	}
+	if assert.Len(job.Packages, 1) {
+		assert.Equal("mypkg", job.Packages[0].Name)
+	}
+
+	assert.Equal([]*JobLinkSpec{{Name: "db", Type: "database", Optional: true}}, job.Consumes)
+	assert.Equal([]*JobLinkSpec{{Name: "web", Type: "http", Properties: []string{"port"}}}, job.Provides)
+
+	if assert.Len(job.Properties, 2) {
+		assert.Equal("empty", job.Properties[0].Name)
+		assert.Nil(job.Properties[0].Default)
+
+		port := job.Properties[1]
+		assert.Equal("port", port.Name)
+		assert.Equal("The port", port.Description)
+		assert.Equal("integer", port.Type)
+		assert.Equal(8080, port.Default)
+		assert.Equal(80, port.Example)
+	}
+}
+
+func TestJobSpecErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	job, err := loadTestJobSpec(assert, `name: myjob
+packages:
+- mypkg
+properties:
+  port:
+    descripton: The port
+consumes: db
+`, nil)
+	if assert.Error(err) {
+		specPath := job.Path + ": job.MF"
+		assert.Contains(err.Error(), "Error trying to load spec of job myjob")
+		assert.Contains(err.Error(), specPath+":7: cannot unmarshal !!str `db` into []*model.JobLinkSpec")
+		assert.Contains(err.Error(), specPath+":6: unknown field properties.port.descripton")
+	}
+
+	job, err = loadTestJobSpec(assert, `name: myjob
+packages:
+- mypkg
+- otherpkg
+`, nil)
+	if assert.Error(err) {
+		assert.Equal(job.Path+": job.MF:4: Cannot find dependency for job myjob: Cannot find package otherpkg in release", err.Error())
+	}
+
+	job, err = loadTestJobSpec(assert, `name: myjob
+templates:
+  run.erb: bin/run
+`, nil)
+	if assert.Error(err) {
+		assert.Equal(job.Path+": job.MF:3: Template run.erb of job myjob not found", err.Error())
+	}
+}
@@ -13,5 +13,7 @@ type JobProperty struct {
 	Name        string
 	Description string
 	Default     interface{}
+	Type        string      // The type from the job spec, if any
+	Example     interface{} // The example value from the job spec, if any
 	Job         *Job
 }
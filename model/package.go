@@ -1,9 +1,7 @@
 package model
 
 import (
-	"crypto/sha1"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -19,51 +17,43 @@ type Package struct {
 	Release      *Release
 	Path         string
 	Dependencies Packages
+	// Stemcell is the stemcell (e.g. ubuntu-trusty/3421.11) the package was
+	// compiled against; it is only set for packages of compiled releases
+	Stemcell string
 
-	packageReleaseInfo map[interface{}]interface{}
+	releaseInfo *releaseManifestEntry
 }
 
 // Packages is an array of *Package
 type Packages []*Package
 
-func newPackage(release *Release, packageReleaseInfo map[interface{}]interface{}) (*Package, error) {
+func newPackage(release *Release, releaseInfo *releaseManifestEntry) *Package {
 	pkg := &Package{
-		Release: release,
-
-		packageReleaseInfo: packageReleaseInfo,
-	}
-
-	if err := pkg.loadPackageInfo(); err != nil {
-		return nil, err
+		Release:     release,
+		Name:        releaseInfo.Name,
+		Version:     releaseInfo.Version,
+		Fingerprint: releaseInfo.Fingerprint,
+		SHA1:        releaseInfo.SHA1,
+		Stemcell:    releaseInfo.Stemcell,
+
+		releaseInfo: releaseInfo,
 	}
+	pkg.Path = pkg.packageArchivePath()
 
-	return pkg, nil
+	return pkg
 }
 
-// ValidateSHA1 validates that the SHA1 of the actual package archive is the same
-// as the one from the release manifest
+// ValidateSHA1 validates that the digest of the actual package archive is the
+// same as the one from the release manifest; despite the name, the manifest
+// may also use the BOSH multi-digest format (e.g. sha256:...)
 func (p *Package) ValidateSHA1() error {
-	file, err := os.Open(p.Path)
-	if err != nil {
-		return fmt.Errorf("Error opening the package archive %s for SHA1 calculation", p.Path)
-	}
-
-	defer file.Close()
-
-	h := sha1.New()
-
-	_, err = io.Copy(h, file)
-	if err != nil {
-		return fmt.Errorf("Error copying package archive %s for SHA1 calculation", p.Path)
-	}
-
-	computedSHA1 := fmt.Sprintf("%x", h.Sum(nil))
-
-	if computedSHA1 != p.SHA1 {
-		return fmt.Errorf("Computed SHA1 (%s) is different than manifest SHA1 (%s) for package archive %s", computedSHA1, p.SHA1, p.Path)
-	}
+	return validateArchiveDigest(p.Path, p.SHA1, "package archive")
+}
 
-	return nil
+// IsPrecompiled returns true if the package archive holds an already compiled
+// package (from a compiled release) rather than package sources
+func (p *Package) IsPrecompiled() bool {
+	return p.Stemcell != ""
 }
 
 // Extract will extract the contents of the package archive to destination
@@ -107,34 +97,12 @@ func (slice Packages) Swap(i, j int) {
 	slice[i], slice[j] = slice[j], slice[i]
 }
 
-func (p *Package) loadPackageInfo() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load package information: %s", r)
-		}
-	}()
-
-	p.Name = p.packageReleaseInfo["name"].(string)
-	p.Version = p.packageReleaseInfo["version"].(string)
-	p.Fingerprint = p.packageReleaseInfo["fingerprint"].(string)
-	p.SHA1 = p.packageReleaseInfo["sha1"].(string)
-	p.Path = p.packageArchivePath()
-
-	return nil
-}
-
-func (p *Package) loadPackageDependencies() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load package information: %s", r)
-		}
-	}()
-
-	for _, pkg := range p.packageReleaseInfo["dependencies"].([]interface{}) {
-		pkgName := pkg.(string)
+func (p *Package) loadPackageDependencies() error {
+	for idx, pkgName := range p.releaseInfo.Dependencies {
 		dependency, err := p.Release.LookupPackage(pkgName)
 		if err != nil {
-			return fmt.Errorf("Cannot find dependency for package %s: %v", p.Name, err.Error())
+			path := fmt.Sprintf("%s.dependencies[%d]", p.releaseInfo.path, idx)
+			return p.Release.manifest.errorf(path, "Cannot find dependency for package %s: %v", p.Name, err.Error())
 		}
 
 		p.Dependencies = append(p.Dependencies, dependency)
@@ -144,6 +112,10 @@ func (p *Package) loadPackageDependencies() (err error) {
 }
 
 func (p *Package) packageArchivePath() string {
+	if p.Release.Type == ReleaseTypeTarball {
+		return p.Release.tarballPackageArchivePath(p.Name)
+	}
+
 	return filepath.Join(p.Release.DevBOSHCacheDir, p.SHA1)
 }
 
@@ -164,3 +136,9 @@ func (p *Package) GetPackageCompiledTempDir(workDir string) string {
 func (p *Package) GetPackageCompiledDir(workDir string) string {
 	return filepath.Join(workDir, p.Fingerprint, "compiled")
 }
+
+// GetPackageCompileLogPath returns the path to the log of the compilation
+// of the package, underneath the main cache directory
+func (p *Package) GetPackageCompileLogPath(workDir string) string {
+	return filepath.Join(workDir, p.Fingerprint, "compile.log")
+}
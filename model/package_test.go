@@ -19,7 +19,7 @@ func TestPackageInfoOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Packages, 1)
@@ -47,7 +47,7 @@ func TestPackageSHA1Ok(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Packages, 1)
@@ -63,7 +63,7 @@ func TestPackageSHA1NotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Packages, 1)
@@ -82,7 +82,7 @@ func TestPackageExtractOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Packages, 1)
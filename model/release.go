@@ -6,12 +6,26 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sync"
 
 	"github.com/hpcloud/fissile/util"
 
+	"github.com/cppforlife/go-semi-semantic/version"
 	"gopkg.in/yaml.v2"
 )
 
+// ReleaseType describes where the contents of a release come from; see the
+// constants below
+type ReleaseType string
+
+// These are the types of releases fissile can load
+const (
+	ReleaseTypeDev     = ReleaseType("dev")     // A dev release directory (dev_releases/, config/dev.yml)
+	ReleaseTypeFinal   = ReleaseType("final")   // A final release directory (releases/, .final_builds/)
+	ReleaseTypeTarball = ReleaseType("tarball") // A release tarball, e.g. downloaded from bosh.io
+)
+
 // Release represents a BOSH release
 type Release struct {
 	Jobs               Jobs
@@ -23,20 +37,128 @@ type Release struct {
 	Version            string
 	Path               string
 	DevBOSHCacheDir    string
+	Type               ReleaseType
+
+	manifest *releaseManifest
+	options  ReleaseOptions
+}
+
+// ReleaseOptions are the settings for loading releases; a nil *ReleaseOptions
+// means no caching and one job loader per CPU
+type ReleaseOptions struct {
+	// JobSpecCacheDir is the directory in which the specs and templates of
+	// job archives are cached, keyed by the SHA1 of the archive, so that
+	// archives don't need to be extracted every time a release is loaded.
+	// Caching is disabled when it is empty.
+	JobSpecCacheDir string
+	// JobLoadWorkers is the number of jobs of a release that are loaded
+	// concurrently
+	JobLoadWorkers int
+}
+
+// releaseOptions returns the options to load releases with, filling in the
+// defaults
+func releaseOptions(options *ReleaseOptions) ReleaseOptions {
+	result := ReleaseOptions{JobLoadWorkers: runtime.NumCPU()}
+	if options != nil {
+		result.JobSpecCacheDir = options.JobSpecCacheDir
+		if options.JobLoadWorkers > 0 {
+			result.JobLoadWorkers = options.JobLoadWorkers
+		}
+	}
+	return result
+}
 
-	manifest map[interface{}]interface{}
+// releaseManifest is the release.MF of a release
+type releaseManifest struct {
+	Name               string                  `yaml:"name"`
+	Version            string                  `yaml:"version"`
+	CommitHash         string                  `yaml:"commit_hash"`
+	UncommittedChanges bool                    `yaml:"uncommitted_changes"`
+	Jobs               []*releaseManifestEntry `yaml:"jobs"`
+	Packages           []*releaseManifestEntry `yaml:"packages"`
+	CompiledPackages   []*releaseManifestEntry `yaml:"compiled_packages"`
+	License            *releaseManifestEntry   `yaml:"license"`
+
+	*manifest `yaml:"-"`
+}
+
+// releaseManifestEntry is a job, package or license listed in a release
+// manifest
+type releaseManifestEntry struct {
+	Name         string   `yaml:"name"`
+	Version      string   `yaml:"version"`
+	Fingerprint  string   `yaml:"fingerprint"`
+	SHA1         string   `yaml:"sha1"`
+	Dependencies []string `yaml:"dependencies"` // Packages only
+	Packages     []string `yaml:"packages"`     // Jobs only
+	Stemcell     string   `yaml:"stemcell"`     // Compiled packages only
+
+	path string // The path of the entry in the manifest, e.g. jobs[3]
 }
 
 const (
 	jobsDir      = "jobs"
 	packagesDir  = "packages"
 	manifestFile = "release.MF"
+
+	compiledPackagesDir = "compiled_packages"
+	compiledPackagesKey = "compiled_packages"
+
+	// tarballExtractDir is the directory, relative to the BOSH cache
+	// directory, into which release tarballs get extracted
+	tarballExtractDir = "fissile-release-tarballs"
 )
 
 // yamlBinaryRegexp is the regexp used to look for the "!binary" YAML tag; see
 // loadMetadata() where it is used.
 var yamlBinaryRegexp = regexp.MustCompile(`([^!])!binary \|-\n`)
 
+// NewRelease will create an instance of a BOSH release, detecting which kind
+// of release is found at path: a release tarball, a directory containing dev
+// releases, or a directory containing only final releases. Dev releases are
+// preferred when a directory contains both. Release tarballs are extracted
+// into the BOSH cache directory.
+func NewRelease(path, releaseName, version, boshCacheDir string, options *ReleaseOptions) (*Release, error) {
+	releaseType, err := GetReleaseType(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch releaseType {
+	case ReleaseTypeTarball:
+		return NewReleaseFromTarball(path, releaseName, version, filepath.Join(boshCacheDir, tarballExtractDir), options)
+	case ReleaseTypeFinal:
+		return NewFinalRelease(path, releaseName, version, boshCacheDir, options)
+	default:
+		return NewDevRelease(path, releaseName, version, boshCacheDir, options)
+	}
+}
+
+// GetReleaseType determines the kind of BOSH release found at path
+func GetReleaseType(path string) (ReleaseType, error) {
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("Path %s (release) does not exist", path)
+		}
+		return "", err
+	}
+
+	if !pathInfo.IsDir() {
+		return ReleaseTypeTarball, nil
+	}
+
+	release := &Release{Path: path}
+	if _, err := os.Stat(release.getDevReleasesDir()); os.IsNotExist(err) {
+		if _, err := os.Stat(release.getFinalReleasesDir()); err == nil {
+			return ReleaseTypeFinal, nil
+		}
+	}
+
+	return ReleaseTypeDev, nil
+}
+
 // GetUniqueConfigs returns all unique configs available in a release
 func (r *Release) GetUniqueConfigs() map[string]*ReleaseConfig {
 	result := map[string]*ReleaseConfig{}
@@ -61,13 +183,7 @@ func (r *Release) GetUniqueConfigs() map[string]*ReleaseConfig {
 	return result
 }
 
-func (r *Release) loadMetadata() (err error) {
-	defer func() {
-		if p := recover(); p != nil {
-			err = fmt.Errorf("Error trying to load release metadata from YAML manifest %s: %s", r.manifestFilePath(), p)
-		}
-	}()
-
+func (r *Release) loadMetadata() error {
 	manifestContents, err := ioutil.ReadFile(r.manifestFilePath())
 	if err != nil {
 		return err
@@ -81,19 +197,64 @@ func (r *Release) loadMetadata() (err error) {
 		[]byte("$1!!binary |-\n"),
 	)
 
-	err = yaml.Unmarshal([]byte(manifestContents), &r.manifest)
+	var releaseManifest releaseManifest
+	releaseManifest.manifest, err = unmarshalManifest(r.manifestFilePath(), "", manifestContents, &releaseManifest)
 	if err != nil {
-		return err
+		return fmt.Errorf("Error trying to load release metadata from YAML manifest:\n%s", err.Error())
+	}
+
+	if err := releaseManifest.validate(); err != nil {
+		return fmt.Errorf("Error trying to load release metadata from YAML manifest:\n%s", err.Error())
 	}
 
-	r.CommitHash = r.manifest["commit_hash"].(string)
-	r.UncommittedChanges = r.manifest["uncommitted_changes"].(bool)
-	r.Name = r.manifest["name"].(string)
-	r.Version = r.manifest["version"].(string)
+	r.manifest = &releaseManifest
+	r.CommitHash = releaseManifest.CommitHash
+	r.UncommittedChanges = releaseManifest.UncommittedChanges
+	r.Name = releaseManifest.Name
+	r.Version = releaseManifest.Version
 
 	return nil
 }
 
+// validate checks that the release manifest has all required fields
+func (m *releaseManifest) validate() error {
+	errs := m.requireFields("", "name", m.Name, "version", m.Version)
+
+	for _, list := range []struct {
+		key     string
+		entries []*releaseManifestEntry
+	}{
+		{"jobs", m.Jobs},
+		{"packages", m.Packages},
+		{compiledPackagesKey, m.CompiledPackages},
+	} {
+		for i, entry := range list.entries {
+			if entry == nil {
+				entry = &releaseManifestEntry{}
+				list.entries[i] = entry
+			}
+			entry.path = fmt.Sprintf("%s[%d]", list.key, i)
+			errs = append(errs, m.requireFields(entry.path,
+				"name", entry.Name,
+				"version", entry.Version,
+				"fingerprint", entry.Fingerprint,
+				"sha1", entry.SHA1)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// IsCompiled returns true if the release is a compiled release, i.e. its
+// packages come precompiled for a specific stemcell
+func (r *Release) IsCompiled() bool {
+	return r.manifest.CompiledPackages != nil
+}
+
 // LookupPackage will find a package within a BOSH release
 func (r *Release) LookupPackage(packageName string) (*Package, error) {
 	for _, pkg := range r.Packages {
@@ -116,41 +277,58 @@ func (r *Release) LookupJob(jobName string) (*Job, error) {
 	return nil, fmt.Errorf("Cannot find job %s in release", jobName)
 }
 
-func (r *Release) loadJobs() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load release jobs from YAML manifest: %s", r)
-		}
-	}()
+func (r *Release) loadJobs() error {
+	jobs := r.manifest.Jobs
+
+	workerCount := r.options.JobLoadWorkers
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	// Jobs are loaded concurrently, as extracting their archives is slow;
+	// the results keep the order of the release manifest
+	loadedJobs := make(Jobs, len(jobs))
+	errs := make([]error, len(jobs))
+	indices := make(chan int)
+
+	var workers sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for idx := range indices {
+				loadedJobs[idx], errs[idx] = newJob(r, jobs[idx])
+			}
+		}()
+	}
 
-	jobs := r.manifest["jobs"].([]interface{})
-	for _, job := range jobs {
-		j, err := newJob(r, job.(map[interface{}]interface{}))
+	for idx := range jobs {
+		indices <- idx
+	}
+	close(indices)
+	workers.Wait()
+
+	for _, err := range errs {
 		if err != nil {
 			return err
 		}
-
-		r.Jobs = append(r.Jobs, j)
 	}
 
+	r.Jobs = append(r.Jobs, loadedJobs...)
+
 	return nil
 }
 
-func (r *Release) loadPackages() (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error trying to load release packages from YAML manifest: %s", r)
-		}
-	}()
+func (r *Release) loadPackages() error {
+	// Compiled releases list their packages under a different key; these
+	// packages come already compiled for a specific stemcell.
+	packages := r.manifest.Packages
+	if r.IsCompiled() {
+		packages = r.manifest.CompiledPackages
+	}
 
-	packages := r.manifest["packages"].([]interface{})
 	for _, pkg := range packages {
-		p, err := newPackage(r, pkg.(map[interface{}]interface{}))
-		if err != nil {
-			return err
-		}
-
-		r.Packages = append(r.Packages, p)
+		r.Packages = append(r.Packages, newPackage(r, pkg))
 	}
 
 	return nil
@@ -169,6 +347,10 @@ func (r *Release) loadDependenciesForPackages() error {
 func (r *Release) loadLicense() error {
 	r.License.Files = make(map[string][]byte)
 
+	if r.Type == ReleaseTypeTarball {
+		return r.loadTarballLicense()
+	}
+
 	licenseFile, err := os.Open(r.licensePath())
 	if os.IsNotExist(err) {
 		// There were never licenses to load.
@@ -227,5 +409,97 @@ func (r *Release) jobsDirPath() string {
 }
 
 func (r *Release) manifestFilePath() string {
-	return filepath.Join(r.getDevReleaseManifestsDir(), r.getDevReleaseManifestFilename())
+	switch r.Type {
+	case ReleaseTypeFinal:
+		return filepath.Join(r.getFinalReleaseManifestsDir(), r.getDevReleaseManifestFilename())
+	case ReleaseTypeTarball:
+		return filepath.Join(r.Path, manifestFile)
+	default:
+		return filepath.Join(r.getDevReleaseManifestsDir(), r.getDevReleaseManifestFilename())
+	}
+}
+
+// getDefaultFinalReleaseName reads the release name from config/final.yml
+func (r *Release) getDefaultFinalReleaseName() (ver string, err error) {
+	releaseConfigContent, err := ioutil.ReadFile(r.getDevReleaseFinalConfigFile())
+	if err != nil {
+		return "", err
+	}
+
+	var releaseConfig map[interface{}]interface{}
+
+	if err := yaml.Unmarshal([]byte(releaseConfigContent), &releaseConfig); err != nil {
+		return "", err
+	}
+
+	var name string
+	if value, ok := releaseConfig["name"]; !ok {
+		if value, ok := releaseConfig["final_name"]; !ok {
+			return "", fmt.Errorf("name or final_name key did not exist in configuration file for release: %s", r.Path)
+		} else if name, ok = value.(string); !ok {
+			return "", fmt.Errorf("final_name was not a string in release: %s, type: %T, value: %v", r.Path, value, value)
+		}
+	} else if name, ok = value.(string); !ok {
+		return "", fmt.Errorf("name was not a string in release: %s, type: %T, value: %v", r.Path, value, value)
+	}
+
+	return name, nil
+}
+
+// getLatestVersionFromIndex returns the highest version listed in a BOSH
+// release index file (dev_releases/<name>/index.yml or releases/<name>/index.yml)
+func (r *Release) getLatestVersionFromIndex(indexPath, indexDescription string) (ver string, err error) {
+	releaseIndexContent, err := ioutil.ReadFile(indexPath)
+	if err != nil {
+		return "", err
+	}
+
+	var releaseIndex map[interface{}]interface{}
+
+	if err := yaml.Unmarshal([]byte(releaseIndexContent), &releaseIndex); err != nil {
+		return "", err
+	}
+
+	var semiVer version.Version
+	var builds map[interface{}]interface{}
+
+	if value, ok := releaseIndex["builds"]; !ok {
+		return "", fmt.Errorf("builds key did not exist in %s for release: %s", indexDescription, r.Name)
+	} else if builds, ok = value.(map[interface{}]interface{}); !ok {
+		return "", fmt.Errorf("builds key in %s was not a map for release: %s, type: %T, value: %v", indexDescription, r.Name, value, value)
+	}
+
+	for _, build := range builds {
+		var buildVersion string
+
+		if buildMap, ok := build.(map[interface{}]interface{}); !ok {
+			return "", fmt.Errorf("build entry was not a map in release: %s, type: %T, value: %v", r.Name, build, build)
+		} else if value, ok := buildMap["version"]; !ok {
+			return "", fmt.Errorf("version key did not exist in a build entry for release: %s", r.Name)
+		} else if buildVersion, ok = value.(string); !ok {
+			return "", fmt.Errorf("version was not a string in a build entry for release: %s, type: %T, value: %v", r.Name, value, value)
+		}
+
+		if ver == "" {
+			ver = buildVersion
+			semiVer, err = version.NewVersionFromString(ver)
+			if err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		semiBuildVer, err := version.NewVersionFromString(buildVersion)
+		if err != nil {
+			return "", err
+		}
+
+		if semiBuildVer.IsGt(semiVer) {
+			ver = buildVersion
+			semiVer = semiBuildVer
+		}
+	}
+
+	return ver, nil
 }
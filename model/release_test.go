@@ -18,7 +18,7 @@ func TestReleaseValidationOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	_, err = NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	_, err = NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 
 	assert.NoError(err)
 }
@@ -33,7 +33,7 @@ func TestReleaseValidationNonExistingPath(t *testing.T) {
 	releaseDir := filepath.Join(tempDir, uuid.New())
 	releaseDirBoshCache := filepath.Join(releaseDir, "bosh-cache")
 
-	_, err = NewDevRelease(releaseDir, "", "", releaseDirBoshCache)
+	_, err = NewDevRelease(releaseDir, "", "", releaseDirBoshCache, nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "does not exist")
@@ -48,7 +48,7 @@ func TestReleaseValidationReleasePathIsAFile(t *testing.T) {
 
 	assert.NoError(err)
 
-	_, err = NewDevRelease(tempFile.Name(), "", "", "")
+	_, err = NewDevRelease(tempFile.Name(), "", "", "", nil)
 
 	assert.NotNil(err)
 	assert.Contains(err.Error(), "It should be a directory")
@@ -108,6 +108,29 @@ func TestReleaseValidationStructure(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestGetReleaseType(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	releaseType, err := GetReleaseType(filepath.Join(workDir, "../test-assets/ntp-release"))
+	assert.NoError(err)
+	assert.Equal(ReleaseTypeDev, releaseType)
+
+	releaseType, err = GetReleaseType(filepath.Join(workDir, "../test-assets/ntp-final-release"))
+	assert.NoError(err)
+	assert.Equal(ReleaseTypeFinal, releaseType)
+
+	releaseType, err = GetReleaseType(filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2.tgz"))
+	assert.NoError(err)
+	assert.Equal(ReleaseTypeTarball, releaseType)
+
+	_, err = GetReleaseType(filepath.Join(workDir, "../test-assets/no-such-release"))
+	assert.Error(err)
+	assert.Contains(err.Error(), "does not exist")
+}
+
 func TestReleaseMetadataOk(t *testing.T) {
 	assert := assert.New(t)
 
@@ -116,7 +139,7 @@ func TestReleaseMetadataOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	// These values come from the
@@ -135,7 +158,7 @@ func TestReleasePackagesOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Packages, 1)
@@ -149,7 +172,7 @@ func TestReleaseJobsOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	assert.Len(release.Jobs, 1)
@@ -163,7 +186,7 @@ func TestLookupPackageOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	pkg, err := release.LookupPackage("ntp-4.2.8p2")
@@ -180,7 +203,7 @@ func TestLookupPackageNotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	_, err = release.LookupPackage("foo")
@@ -195,7 +218,7 @@ func TestLookupJobOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	job, err := release.LookupJob("ntpd")
@@ -212,7 +235,7 @@ func TestLookupJobNotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	_, err = release.LookupJob("foo")
@@ -227,7 +250,7 @@ func TestPackageDependencies(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	assert.NoError(err)
 
 	pkg, err := release.LookupPackage("tor")
@@ -265,7 +288,7 @@ func TestReleaseNoLicense(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/no-license")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 
 	assert.Nil(err, "Release without license should be valid")
 	assert.Empty(release.License.Files)
@@ -281,7 +304,7 @@ func TestReleaseExtractedLicense(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/extracted-license")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 
 	assert.Nil(err, "Release with extracted license should be valid")
 	assert.Len(release.License.Files, 1)
@@ -298,7 +321,7 @@ func TestReleaseMissingLicense(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/missing-license")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	_, err = NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	_, err = NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 
 	assert.NotNil(err, "Release with missing license should be invalid")
 }
@@ -311,7 +334,7 @@ func TestGetDeploymentConfig(t *testing.T) {
 
 	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	releasePathBoshCache := filepath.Join(releasePath, "bosh-cache")
-	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache)
+	release, err := NewDevRelease(releasePath, "", "", releasePathBoshCache, nil)
 	assert.NoError(err)
 
 	configs := release.GetUniqueConfigs()
@@ -8,8 +8,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-
-	"gopkg.in/yaml.v2"
 )
 
 // RoleType is the type of the role; see the constants below
@@ -33,6 +31,18 @@ const (
 	FlightStageManual     = FlightStage("manual")      // A role that only runs via user intervention
 )
 
+// PublicExposure describes how the public ports of a role are reachable from
+// outside of the cluster
+type PublicExposure string
+
+// These are the kinds of public exposure available
+const (
+	PublicExposureLoadBalancer = PublicExposure("load-balancer") // A service of type LoadBalancer
+	PublicExposureNodePort     = PublicExposure("node-port")     // A service of type NodePort
+	PublicExposureExternalIPs  = PublicExposure("external-ips")  // A service with external IPs
+	PublicExposureIngress      = PublicExposure("ingress")       // An ingress for HTTP ports
+)
+
 // RoleManifest represents a collection of roles
 type RoleManifest struct {
 	Roles         Roles          `yaml:"roles"`
@@ -64,11 +74,17 @@ type RoleRun struct {
 	Capabilities      []string              `yaml:"capabilities"`
 	PersistentVolumes []*RoleRunVolume      `yaml:"persistent-volumes"`
 	SharedVolumes     []*RoleRunVolume      `yaml:"shared-volumes"`
-	Memory            int                   `yaml:"memory"`
-	VirtualCPUs       int                   `yaml:"virtual-cpus"`
+	EphemeralVolumes  []*RoleRunVolume      `yaml:"ephemeral-volumes"`
+	HostPathVolumes   []*RoleRunVolume      `yaml:"host-path-volumes"`
+	Memory            int                   `yaml:"memory"`             // MiB requested
+	MemoryLimit       int                   `yaml:"memory-limit"`       // MiB at most; optional
+	VirtualCPUs       float64               `yaml:"virtual-cpus"`       // CPUs requested
+	VirtualCPUsLimit  float64               `yaml:"virtual-cpus-limit"` // CPUs at most; optional
 	ExposedPorts      []*RoleRunExposedPort `yaml:"exposed-ports"`
 	FlightStage       FlightStage           `yaml:"flight-stage"`
 	HealthCheck       *HealthCheck          `yaml:"healthcheck,omitempty"`
+	PublicExposure    *RoleRunPublic        `yaml:"public-exposure"`
+	DependsOn         []string              `yaml:"depends-on"` // Names of the roles to be ready before the role starts
 }
 
 // RoleRunScaling describes how a role should scale out at runtime
@@ -79,9 +95,12 @@ type RoleRunScaling struct {
 
 // RoleRunVolume describes a volume to be attached at runtime
 type RoleRunVolume struct {
-	Path string `yaml:"path"`
-	Tag  string `yaml:"tag"`
-	Size int    `yaml:"size"`
+	Path         string `yaml:"path"`
+	Tag          string `yaml:"tag"`
+	Size         string `yaml:"size"`          // Quantity like 500Mi; plain numbers are gigabytes. Only for persistent and shared volumes.
+	StorageClass string `yaml:"storage-class"` // Overrides the default storage class; only for persistent and shared volumes.
+	Memory       bool   `yaml:"memory"`        // Whether the volume is backed by memory; only for ephemeral volumes.
+	HostPath     string `yaml:"host-path"`     // Path of the volume on the host; only for host path volumes.
 }
 
 // RoleRunExposedPort describes a port to be available to other roles, or the outside world
@@ -91,14 +110,90 @@ type RoleRunExposedPort struct {
 	External string `yaml:"external"`
 	Internal string `yaml:"internal"`
 	Public   bool   `yaml:"public"`
+	NodePort string `yaml:"node-port"` // Fixed node ports for node-port and load-balancer exposure
+	Path     string `yaml:"path"`      // Path of the HTTP port for ingress exposure; defaults to /
 }
 
-// HealthCheck describes a non-standard health check endpoint
+// RoleRunPublic describes how the public ports of a role are exposed; roles
+// without it use the exposure given to fissile build kube
+type RoleRunPublic struct {
+	Type        PublicExposure `yaml:"type"`
+	ExternalIPs []string       `yaml:"external-ips"` // Only for external-ips exposure
+	Host        string         `yaml:"host"`         // Only for ingress exposure
+}
+
+// HealthCheck describes the non-standard health checks of a role. A check
+// given directly is the readiness check; it is the shorthand for a readiness
+// section with just that check.
 type HealthCheck struct {
-	URL     string            `yaml:"url"`     // URL for a HTTP GET to return 200~399. Cannot be used with other checks.
-	Headers map[string]string `yaml:"headers"` // Custom headers; only used for URL.
-	Command []string          `yaml:"command"` // Custom command. Cannot be used with other checks.
-	Port    int32             `yaml:"port"`    // Port for a TCP probe. Cannot be used with other checks.
+	URL       string            `yaml:"url"`       // URL for a HTTP GET to return 200~399. Cannot be used with other checks.
+	Headers   map[string]string `yaml:"headers"`   // Custom headers; only used for URL.
+	Command   []string          `yaml:"command"`   // Custom command. Cannot be used with other checks.
+	Port      int32             `yaml:"port"`      // Port for a TCP probe. Cannot be used with other checks.
+	Liveness  *HealthProbe      `yaml:"liveness"`  // Check for the role to be restarted when failing
+	Readiness *HealthProbe      `yaml:"readiness"` // Check for the role to get traffic when passing
+}
+
+// HealthProbe describes a liveness or readiness check of a role. Probes
+// without a check tune the timing of the default check.
+type HealthProbe struct {
+	URL              string            `yaml:"url"`               // URL for a HTTP GET to return 200~399. Cannot be used with other checks.
+	Headers          map[string]string `yaml:"headers"`           // Custom headers; only used for URL.
+	Command          []string          `yaml:"command"`           // Custom command. Cannot be used with other checks.
+	Port             int32             `yaml:"port"`              // Port for a TCP probe. Cannot be used with other checks.
+	InitialDelay     int32             `yaml:"initial-delay"`     // Seconds before the first check
+	Period           int32             `yaml:"period"`            // Seconds between checks
+	Timeout          int32             `yaml:"timeout"`           // Seconds for a check to time out
+	FailureThreshold int32             `yaml:"failure-threshold"` // Failed checks in a row for the probe to fail
+}
+
+// ReadinessProbe returns the readiness check of a role, from the readiness
+// section of its health check, or the shorthand check
+func (h *HealthCheck) ReadinessProbe() *HealthProbe {
+	if h == nil {
+		return nil
+	}
+	if h.Readiness != nil {
+		return h.Readiness
+	}
+	if h.URL == "" && len(h.Command) == 0 && h.Port == 0 {
+		return nil
+	}
+	return &HealthProbe{
+		URL:     h.URL,
+		Headers: h.Headers,
+		Command: h.Command,
+		Port:    h.Port,
+	}
+}
+
+// LivenessProbe returns the liveness check of a role, if any
+func (h *HealthCheck) LivenessProbe() *HealthProbe {
+	if h == nil {
+		return nil
+	}
+	return h.Liveness
+}
+
+// checks returns the kinds of checks given in a health check probe
+func (p *HealthProbe) checks() []string {
+	checks := make([]string, 0, 3)
+	if p.URL != "" {
+		checks = append(checks, "url")
+	}
+	if len(p.Command) > 0 {
+		checks = append(checks, "command")
+	}
+	if p.Port != 0 {
+		checks = append(checks, "port")
+	}
+	return checks
+}
+
+// shorthandChecks returns the kinds of checks given directly in a health
+// check, as the readiness check
+func (h *HealthCheck) shorthandChecks() []string {
+	return (&HealthProbe{URL: h.URL, Command: h.Command, Port: h.Port}).checks()
 }
 
 // Roles is an array of Role*
@@ -117,6 +212,7 @@ type ConfigurationVariable struct {
 	Default     interface{}                     `yaml:"default"`
 	Description string                          `yaml:"description"`
 	Generator   *ConfigurationVariableGenerator `yaml:"generator"`
+	Secret      bool                            `yaml:"secret"` // Whether the value must be kept out of plain text configuration
 }
 
 // ConfigurationVariableSlice is a sortable slice of ConfigurationVariables
@@ -138,16 +234,51 @@ func (confVars ConfigurationVariableSlice) Swap(i, j int) {
 }
 
 // ConfigurationVariableGenerator describes how to automatically generate values
-// for a configuration variable
+// for a configuration variable. Variables with the same ID share the generated
+// secret, and pick different parts of it via their value type (e.g. the private
+// and the public key of a SSH key pair).
 type ConfigurationVariableGenerator struct {
-	ID        string `yaml:"id"`
-	Type      string `yaml:"type"`
-	ValueType string `yaml:"value_type"`
+	ID           string   `yaml:"id"`
+	Type         string   `yaml:"type"`
+	ValueType    string   `yaml:"value_type"`
+	RoleName     string   `yaml:"role_name"`     // Certificates only: the role whose service names are added to the SANs
+	SubjectNames []string `yaml:"subject_names"` // Certificates only: additional SANs
+	CA           string   `yaml:"ca"`            // Certificates only: the id of the signing CA certificate, if there is more than one
+}
+
+// These are the types of generators available
+const (
+	GeneratorTypePassword      = "Password"      // A random password
+	GeneratorTypeSSH           = "SSH"           // A SSH key pair
+	GeneratorTypeCACertificate = "CACertificate" // A self-signed certificate authority
+	GeneratorTypeCertificate   = "Certificate"   // A TLS certificate signed by the CA
+)
+
+// These are the value types generators can produce
+const (
+	ValueTypePassword    = "password"    // The password (Password)
+	ValueTypePrivateKey  = "private_key" // The PEM encoded private key (SSH, CACertificate, Certificate)
+	ValueTypePublicKey   = "public_key"  // The public key in authorized_keys format (SSH)
+	ValueTypeFingerprint = "fingerprint" // The MD5 fingerprint of the public key (SSH)
+	ValueTypeCertificate = "certificate" // The PEM encoded certificate (CACertificate, Certificate)
+)
+
+// GeneratorValueTypes lists the value types available for each generator type
+var GeneratorValueTypes = map[string][]string{
+	GeneratorTypePassword:      {ValueTypePassword},
+	GeneratorTypeSSH:           {ValueTypePrivateKey, ValueTypePublicKey, ValueTypeFingerprint},
+	GeneratorTypeCACertificate: {ValueTypeCertificate, ValueTypePrivateKey},
+	GeneratorTypeCertificate:   {ValueTypeCertificate, ValueTypePrivateKey},
 }
 
 type roleJob struct {
-	Name        string `yaml:"name"`
-	ReleaseName string `yaml:"release_name"`
+	Name        string                      `yaml:"name"`
+	ReleaseName string                      `yaml:"release_name"`
+	Consumes    map[string]*roleJobConsumes `yaml:"consumes"`
+	Provides    map[string]*roleJobProvides `yaml:"provides"`
+
+	job   *Job                     // The job from the release
+	links map[string]*linkProvider // The providers of the consumed links, by link name
 }
 
 // Len is the number of roles in the slice
@@ -165,7 +296,9 @@ func (roles Roles) Swap(i, j int) {
 	roles[i], roles[j] = roles[j], roles[i]
 }
 
-// LoadRoleManifest loads a yaml manifest that details how jobs get grouped into roles
+// LoadRoleManifest loads a yaml manifest that details how jobs get grouped into
+// roles. Manifests fail to load with the problems ValidateRoleManifest finds
+// that keep them from being loaded; the others are left to validation.
 func LoadRoleManifest(manifestFilePath string, releases []*Release, skipDev bool) (*RoleManifest, error) {
 	manifestContents, err := ioutil.ReadFile(manifestFilePath)
 	if err != nil {
@@ -184,27 +317,19 @@ func LoadRoleManifest(manifestFilePath string, releases []*Release, skipDev bool
 		mappedReleases[release.Name] = release
 	}
 
-	rolesManifest := RoleManifest{}
-	rolesManifest.manifestFilePath = manifestFilePath
-	if err := yaml.Unmarshal(manifestContents, &rolesManifest); err != nil {
-		return nil, err
+	rolesManifest, errs := validateRoleManifest(manifestContents, mappedReleases, false)
+	if len(errs) > 0 {
+		return nil, errs
 	}
+	rolesManifest.manifestFilePath = manifestFilePath
 
+	removedDevRoles := false
 	for i := len(rolesManifest.Roles) - 1; i >= 0; i-- {
 		role := rolesManifest.Roles[i]
 
 		// Normalize flight stage
-		if role.Run != nil {
-			switch role.Run.FlightStage {
-			case "":
-				role.Run.FlightStage = FlightStageFlight
-			case FlightStagePreFlight:
-			case FlightStageFlight:
-			case FlightStagePostFlight:
-			case FlightStageManual:
-			default:
-				return nil, fmt.Errorf("Role %s has an invalid flight stage %s", role.Name, role.Run.FlightStage)
-			}
+		if role.Run != nil && role.Run.FlightStage == "" {
+			role.Run.FlightStage = FlightStageFlight
 		}
 
 		// Remove all roles that are not of the "bosh" or "bosh-task" type
@@ -220,30 +345,24 @@ func LoadRoleManifest(manifestFilePath string, releases []*Release, skipDev bool
 				for _, tag := range role.Tags {
 					if strings.EqualFold(tag, "dev-only") {
 						rolesManifest.Roles = append(rolesManifest.Roles[:i], rolesManifest.Roles[i+1:]...)
+						removedDevRoles = true
 					}
 				}
 			}
 		case RoleTypeDocker:
 			rolesManifest.Roles = append(rolesManifest.Roles[:i], rolesManifest.Roles[i+1:]...)
-		default:
-			return nil, fmt.Errorf("Role %s has an invalid type %s", role.Name, role.Type)
 		}
+	}
 
-		// Ensure that we don't have conflicting health checks
-		if role.Run != nil && role.Run.HealthCheck != nil {
-			checks := make([]string, 0, 3)
-			if role.Run.HealthCheck.URL != "" {
-				checks = append(checks, "url")
-			}
-			if len(role.Run.HealthCheck.Command) > 0 {
-				checks = append(checks, "command")
-			}
-			if role.Run.HealthCheck.Port != 0 {
-				checks = append(checks, "port")
-			}
-			if len(checks) != 1 {
-				return nil, fmt.Errorf("Health check for role %s should have exactly one of url, command, or port; got %v", role.Name, checks)
-			}
+	// Dependencies and links may have been on the dev-only roles just removed;
+	// the paths of the problems found now would not match the manifest
+	if removedDevRoles {
+		errs := append(checkRoleDependencies(rolesManifest.Roles), resolveLinks(rolesManifest.Roles)...)
+		for _, err := range errs {
+			err.Path = ""
+		}
+		if len(errs) > 0 {
+			return nil, errs
 		}
 	}
 
@@ -257,30 +376,17 @@ func LoadRoleManifest(manifestFilePath string, releases []*Release, skipDev bool
 	rolesManifest.rolesByName = make(map[string]*Role, len(rolesManifest.Roles))
 
 	for _, role := range rolesManifest.Roles {
-		role.rolesManifest = &rolesManifest
+		role.rolesManifest = rolesManifest
 		role.Jobs = make(Jobs, 0, len(role.JobNameList))
-
 		for _, roleJob := range role.JobNameList {
-			release, ok := mappedReleases[roleJob.ReleaseName]
-
-			if !ok {
-				return nil, fmt.Errorf("Error - release %s has not been loaded and is referenced by job %s in role %s",
-					roleJob.ReleaseName, roleJob.Name, role.Name)
-			}
-
-			job, err := release.LookupJob(roleJob.Name)
-			if err != nil {
-				return nil, err
-			}
-
-			role.Jobs = append(role.Jobs, job)
+			role.Jobs = append(role.Jobs, roleJob.job)
 		}
 
 		role.calculateRoleConfigurationTemplates()
 		rolesManifest.rolesByName[role.Name] = role
 	}
 
-	return &rolesManifest, nil
+	return rolesManifest, nil
 }
 
 // GetRoleManifestDevPackageVersion gets the aggregate signature of all the packages
@@ -355,6 +461,88 @@ func (r *Role) HasTag(tag string) bool {
 	return false
 }
 
+// IsStateful returns true if the pods of the role need stable identities,
+// because the role is clustered or has volumes
+func (r *Role) IsStateful() bool {
+	if r.HasTag("clustered") {
+		return true
+	}
+	return r.Run != nil && (len(r.Run.PersistentVolumes) != 0 || len(r.Run.SharedVolumes) != 0)
+}
+
+// InstanceCount returns the number of instances the role starts with
+func (r *Role) InstanceCount() int {
+	if r.Run == nil || r.Run.Scaling == nil || r.Run.Scaling.Min < 1 {
+		return 1
+	}
+	return int(r.Run.Scaling.Min)
+}
+
+// HasBootstrapInstance returns true if the first instance of the role can be
+// the bootstrap instance of its jobs. The pods of a deployment can't tell each
+// other apart, so unless the role never scales above one instance, none of
+// them is; roles needing a bootstrap instance should be clustered, making them
+// stateful sets. Validation reports the roles whose job templates use
+// spec.bootstrap without one.
+func (r *Role) HasBootstrapInstance() bool {
+	if r.IsStateful() {
+		return true
+	}
+	return r.Run == nil || r.Run.Scaling == nil || r.Run.Scaling.Max <= 1
+}
+
+// flightStage returns the flight stage of the role; roles without run
+// information are flight roles
+func (r *Role) flightStage() FlightStage {
+	if r.Run == nil || r.Run.FlightStage == "" {
+		return FlightStageFlight
+	}
+	return r.Run.FlightStage
+}
+
+// PreFlightRoles returns the pre-flight tasks that have to complete before the
+// role starts, in the order of the role manifest. Only flight roles wait for
+// them.
+func (r *Role) PreFlightRoles() Roles {
+	if r.rolesManifest == nil || r.flightStage() != FlightStageFlight {
+		return nil
+	}
+
+	var result Roles
+	for _, role := range r.rolesManifest.Roles {
+		if role.Type == RoleTypeBoshTask && role.flightStage() == FlightStagePreFlight {
+			result = append(result, role)
+		}
+	}
+	return result
+}
+
+// FlightRoles returns the flight roles that have to be ready before the role
+// starts, in the order of the role manifest. Only post-flight roles wait for
+// them: for the flight roles they consume links from, or for all of them if
+// they consume no links from flight roles.
+func (r *Role) FlightRoles() Roles {
+	if r.rolesManifest == nil || r.flightStage() != FlightStagePostFlight {
+		return nil
+	}
+
+	providers := r.linkProviderRoles()
+	var flight, linked Roles
+	for _, role := range r.rolesManifest.Roles {
+		if role.Type != RoleTypeBosh || role.flightStage() != FlightStageFlight {
+			continue
+		}
+		flight = append(flight, role)
+		if providers[role] {
+			linked = append(linked, role)
+		}
+	}
+	if len(linked) > 0 {
+		return linked
+	}
+	return flight
+}
+
 func (r *Role) calculateRoleConfigurationTemplates() {
 	if r.Configuration == nil {
 		r.Configuration = &Configuration{}
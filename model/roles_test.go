@@ -17,7 +17,7 @@ func TestLoadRoleManifestOK(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -49,7 +49,7 @@ func TestGetScriptPaths(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -72,7 +72,7 @@ func TestLoadRoleManifestNotOKBadJobName(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-bad.yml")
@@ -81,6 +81,55 @@ func TestLoadRoleManifestNotOKBadJobName(t *testing.T) {
 	assert.Contains(err.Error(), "Cannot find job foo in release")
 }
 
+func TestLoadRoleManifestNotOKBadManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/validation-bad.yml")
+	_, err = LoadRoleManifest(roleManifestPath, []*Release{release}, false)
+
+	// All problems keeping the manifest from loading are reported; those
+	// only validation looks for are not
+	errs, ok := err.(ValidationErrors)
+	if assert.True(ok, "Expected validation errors, got %#v", err) {
+		var actual []string
+		for _, e := range errs {
+			actual = append(actual, e.Error())
+		}
+		assert.Equal([]string{
+			"line 8: roles[0].jobs[0].consumes.tor: Job new_hostname in role myrole does not consume a link tor",
+			"line 10: roles[0].jobs[1].name: Cannot find job foo in release tor for role myrole",
+			"line 13: roles[0].run.flight-stage: Role myrole has an invalid flight stage taxiing",
+			"line 32: roles[1].name: Role name myrole is used more than once",
+			"line 36: roles[1].jobs[0].release_name: The release notor has not been loaded and is referenced by job tor in role myrole",
+		}, actual)
+	}
+}
+
+func TestLoadRoleManifestLeavesLintToValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	for _, manifestName := range []string{"scaling-bad.yml", "healthcheck-bad.yml", "resources-bad.yml"} {
+		roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests", manifestName)
+		_, err = LoadRoleManifest(roleManifestPath, nil, false)
+		assert.NoError(err, "Unexpected error loading %s", manifestName)
+
+		errs, err := ValidateRoleManifest(roleManifestPath, nil)
+		assert.NoError(err)
+		assert.NotEmpty(errs, "Expected problems in %s", manifestName)
+	}
+}
+
 func TestLoadDuplicateReleases(t *testing.T) {
 	assert := assert.New(t)
 
@@ -89,7 +138,7 @@ func TestLoadDuplicateReleases(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-good.yml")
@@ -107,12 +156,12 @@ func TestLoadRoleManifestMultipleReleasesOK(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	ntpRelease, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	ntpRelease, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	torRelease, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	torRelease, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/multiple-good.yml")
@@ -142,12 +191,12 @@ func TestLoadRoleManifestMultipleReleasesNotOk(t *testing.T) {
 
 	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
 	ntpReleasePathBoshCache := filepath.Join(ntpReleasePath, "bosh-cache")
-	ntpRelease, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	ntpRelease, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	torRelease, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	torRelease, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/multiple-bad.yml")
@@ -165,7 +214,7 @@ func TestNonBoshRolesAreIgnoredOK(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/non-bosh-roles.yml")
@@ -185,7 +234,7 @@ func TestDevOnlyRolesAreIgnoredOK(t *testing.T) {
 
 	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
 	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
-	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache)
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
 	assert.NoError(err)
 
 	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/dev-only-roles.yml")
@@ -217,6 +266,39 @@ func TestRolesSort(t *testing.T) {
 	assert.Equal(roles[1].Name, "ddd")
 }
 
+func TestRoleFlightDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	mysql := &Job{Name: "mysql", Provides: []*JobLinkSpec{{Name: "db", Type: "database"}}}
+	smokeTests := &Job{Name: "smoke-tests", Consumes: []*JobLinkSpec{{Name: "database", Type: "database"}}}
+
+	migrate := &Role{Name: "migrate", Type: RoleTypeBoshTask, Run: &RoleRun{FlightStage: FlightStagePreFlight}}
+	web := &Role{Name: "web", Type: RoleTypeBosh, Run: &RoleRun{FlightStage: FlightStageFlight}}
+	db := linkTestRole("db", &roleJob{job: mysql})
+	db.Type = RoleTypeBosh
+	tests := linkTestRole("tests", &roleJob{job: smokeTests})
+	tests.Type = RoleTypeBoshTask
+	tests.Run = &RoleRun{FlightStage: FlightStagePostFlight}
+	cleanup := &Role{Name: "cleanup", Type: RoleTypeBoshTask, Run: &RoleRun{FlightStage: FlightStagePostFlight}}
+
+	manifest := &RoleManifest{Roles: Roles{migrate, web, db, tests, cleanup}}
+	for _, role := range manifest.Roles {
+		role.rolesManifest = manifest
+	}
+	if !assert.Empty(resolveLinks(manifest.Roles)) {
+		return
+	}
+
+	assert.Empty(migrate.PreFlightRoles(), "Pre-flight roles wait for nothing")
+	assert.Equal(Roles{migrate}, web.PreFlightRoles())
+	assert.Equal(Roles{migrate}, db.PreFlightRoles(), "Roles without a flight stage are flight roles")
+	assert.Empty(tests.PreFlightRoles())
+
+	assert.Empty(web.FlightRoles())
+	assert.Equal(Roles{db}, tests.FlightRoles(), "Post-flight roles wait for the roles they consume links from")
+	assert.Equal(Roles{web, db}, cleanup.FlightRoles(), "Post-flight roles without links wait for all flight roles")
+}
+
 func TestGetRoleManifestDevPackageVersion(t *testing.T) {
 	assert := assert.New(t)
 
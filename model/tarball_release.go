@@ -0,0 +1,165 @@
+package model
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hpcloud/fissile/util"
+
+	"github.com/pivotal-golang/archiver/extractor"
+)
+
+// NewReleaseFromTarball will create an instance of a BOSH release from a
+// release tarball (such as the ones available on bosh.io). The tarball is
+// extracted into a directory named after its SHA1 underneath extractDir; an
+// existing extraction is reused.
+func NewReleaseFromTarball(tarballPath, releaseName, version, extractDir string, options *ReleaseOptions) (*Release, error) {
+	if err := util.ValidatePath(tarballPath, false, "release tarball"); err != nil {
+		return nil, err
+	}
+
+	releaseDir, err := extractReleaseTarball(tarballPath, extractDir)
+	if err != nil {
+		return nil, err
+	}
+
+	release := &Release{
+		Path:    releaseDir,
+		Type:    ReleaseTypeTarball,
+		options: releaseOptions(options),
+	}
+
+	if err := release.validateTarballPathStructure(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadMetadata(); err != nil {
+		return nil, err
+	}
+
+	if releaseName != "" && releaseName != release.Name {
+		return nil, fmt.Errorf("Release tarball %s contains release %s, not %s", tarballPath, release.Name, releaseName)
+	}
+
+	if version != "" && version != release.Version {
+		return nil, fmt.Errorf("Release tarball %s contains version %s of release %s, not %s", tarballPath, release.Version, release.Name, version)
+	}
+
+	if err := release.loadPackages(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadDependenciesForPackages(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadJobs(); err != nil {
+		return nil, err
+	}
+
+	if err := release.loadLicense(); err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// extractReleaseTarball extracts the tarball into extractDir/<sha1> and
+// returns the path of the extracted release
+func extractReleaseTarball(tarballPath, extractDir string) (string, error) {
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("Error calculating sha1 of release tarball %s: %s", tarballPath, err.Error())
+	}
+
+	releaseDir := filepath.Join(extractDir, fmt.Sprintf("%x", h.Sum(nil)))
+	if _, err := os.Stat(filepath.Join(releaseDir, manifestFile)); err == nil {
+		return releaseDir, nil
+	}
+
+	// Extract next to the final location and rename, so that an interrupted
+	// extraction is never mistaken for a complete one
+	if err := os.MkdirAll(extractDir, 0755); err != nil {
+		return "", err
+	}
+
+	tempDir, err := util.TempDir(extractDir, "fissile-release-tarball")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := extractor.NewTgz().Extract(tarballPath, tempDir); err != nil {
+		return "", fmt.Errorf("Error extracting release tarball %s: %s", tarballPath, err.Error())
+	}
+
+	if err := os.RemoveAll(releaseDir); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tempDir, releaseDir); err != nil {
+		return "", err
+	}
+
+	return releaseDir, nil
+}
+
+func (r *Release) loadTarballLicense() error {
+	licenseFile, err := os.Open(r.tarballLicensePath())
+	if os.IsNotExist(err) {
+		// There were never licenses to load.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer licenseFile.Close()
+
+	files, err := util.LoadLicenseFiles(r.tarballLicensePath(), licenseFile, util.DefaultLicensePrefixFilters...)
+	if err != nil {
+		return err
+	}
+
+	for name, contents := range files {
+		r.License.Files[filepath.Clean(name)] = contents
+	}
+
+	return nil
+}
+
+func (r *Release) validateTarballPathStructure() error {
+	if err := util.ValidatePath(r.manifestFilePath(), false, "release manifest file"); err != nil {
+		return err
+	}
+
+	if err := util.ValidatePath(r.jobsDirPath(), true, "jobs directory"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Release) tarballLicensePath() string {
+	return filepath.Join(r.Path, "license.tgz")
+}
+
+func (r *Release) tarballJobArchivePath(jobName string) string {
+	return filepath.Join(r.jobsDirPath(), fmt.Sprintf("%s.tgz", jobName))
+}
+
+func (r *Release) tarballPackageArchivePath(packageName string) string {
+	if r.IsCompiled() {
+		return filepath.Join(r.Path, compiledPackagesDir, fmt.Sprintf("%s.tgz", packageName))
+	}
+
+	return filepath.Join(r.packagesDirPath(), fmt.Sprintf("%s.tgz", packageName))
+}
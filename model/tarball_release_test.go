@@ -0,0 +1,98 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarballReleaseOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	extractDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(extractDir)
+
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2.tgz")
+
+	release, err := NewReleaseFromTarball(tarballPath, "", "", extractDir, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(ReleaseTypeTarball, release.Type)
+	assert.Equal("ntp", release.Name)
+	assert.Equal("2", release.Version)
+
+	assert.Len(release.Jobs, 1)
+	assert.Equal("ntpd", release.Jobs[0].Name)
+	assert.Equal(filepath.Join(release.Path, "jobs", "ntpd.tgz"), release.Jobs[0].Path)
+	assert.NoError(release.Jobs[0].ValidateSHA1())
+
+	assert.False(release.IsCompiled())
+	assert.Len(release.Packages, 1)
+	assert.False(release.Packages[0].IsPrecompiled())
+	assert.Equal(filepath.Join(release.Path, "packages", "ntp-4.2.8p2.tgz"), release.Packages[0].Path)
+	assert.NoError(release.Packages[0].ValidateSHA1())
+
+	assert.NotNil(release.License.Files["LICENSE"])
+
+	// Loading it a second time reuses the extracted tarball
+	again, err := NewReleaseFromTarball(tarballPath, "", "", extractDir, nil)
+	assert.NoError(err)
+	assert.Equal(release.Path, again.Path)
+}
+
+func TestTarballReleaseMismatchedVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	extractDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(extractDir)
+
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2.tgz")
+
+	_, err = NewReleaseFromTarball(tarballPath, "", "3", extractDir, nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), "contains version 2 of release ntp, not 3")
+
+	_, err = NewReleaseFromTarball(tarballPath, "tor", "", extractDir, nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), "contains release ntp, not tor")
+}
+
+func TestTarballCompiledReleaseOk(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	extractDir, err := ioutil.TempDir("", "fissile-tests")
+	assert.NoError(err)
+	defer os.RemoveAll(extractDir)
+
+	tarballPath := filepath.Join(workDir, "../test-assets/release-tarballs/ntp-2-compiled.tgz")
+
+	release, err := NewReleaseFromTarball(tarballPath, "", "", extractDir, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.True(release.IsCompiled())
+	if assert.Len(release.Packages, 1) {
+		pkg := release.Packages[0]
+		assert.True(pkg.IsPrecompiled())
+		assert.Equal("ubuntu-trusty/3421.11", pkg.Stemcell)
+		assert.Equal(filepath.Join(release.Path, "compiled_packages", "ntp-4.2.8p2.tgz"), pkg.Path)
+		assert.NoError(pkg.ValidateSHA1())
+	}
+}
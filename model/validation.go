@@ -0,0 +1,623 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ValidationError is a problem found while validating a role manifest
+type ValidationError struct {
+	Path    string `json:"path" yaml:"path"`       // The node of the manifest, e.g. roles[0].run.scaling
+	Line    int    `json:"line" yaml:"line"`       // The line of the node; 0 if it is not known
+	Message string `json:"message" yaml:"message"` // What is wrong
+}
+
+func (e *ValidationError) Error() string {
+	location := e.Path
+	if e.Line != 0 {
+		location = strings.TrimSuffix(fmt.Sprintf("line %d: %s", e.Line, e.Path), ": ")
+	}
+	if location == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", location, e.Message)
+}
+
+// ValidationErrors is a list of problems, ordered by their location
+type ValidationErrors []*ValidationError
+
+// Len is the number of problems in the list
+func (errs ValidationErrors) Len() int {
+	return len(errs)
+}
+
+// Less reports whether the problem at index i comes before the one at index j
+func (errs ValidationErrors) Less(i, j int) bool {
+	if errs[i].Line != errs[j].Line {
+		return errs[i].Line < errs[j].Line
+	}
+	return strings.Compare(errs[i].Path, errs[j].Path) < 0
+}
+
+// Swap exchanges the problems at index i and index j
+func (errs ValidationErrors) Swap(i, j int) {
+	errs[i], errs[j] = errs[j], errs[i]
+}
+
+// Error lists the problems, one per line
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// builtinTemplateVariables are environment variables of every role container,
+// which templates may use without declaring them
+var builtinTemplateVariables = map[string]bool{
+	"DNS_RECORD_NAME":      true,
+	"HOME":                 true,
+	"HOSTNAME":             true,
+	"IP_ADDRESS":           true,
+	"KUBERNETES_NAMESPACE": true,
+	"KUBERNETES_POD_IP":    true,
+	"MONIT_ADMIN_PASSWORD": true,
+	"MONIT_ADMIN_USER":     true,
+}
+
+// volumeSizeRegexp matches the sizes of volumes, as kube quantities with
+// binary or decimal suffixes, or plain numbers of gigabytes
+var volumeSizeRegexp = regexp.MustCompile(`^\d+(?:\.\d+)?(?:[KMGTPE]i|[kMGTPE])?$`)
+
+// roleManifestValidator collects the problems of a role manifest
+type roleManifestValidator struct {
+	lines  yamlLines
+	errors ValidationErrors
+}
+
+func (v *roleManifestValidator) add(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{
+		Path:    path,
+		Line:    v.lines.lookup(path),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateRoleManifest checks the role manifest against the releases, and
+// returns all problems found; LoadRoleManifest only fails with those that keep
+// it from loading the manifest. The error is only set if the manifest can't be
+// read.
+func ValidateRoleManifest(manifestFilePath string, releases []*Release) (ValidationErrors, error) {
+	manifestContents, err := ioutil.ReadFile(manifestFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	mappedReleases := map[string]*Release{}
+	for _, release := range releases {
+		mappedReleases[release.Name] = release
+	}
+
+	_, errs := validateRoleManifest(manifestContents, mappedReleases, true)
+	return errs, nil
+}
+
+// validateRoleManifest parses the role manifest and checks it against the
+// releases, looking up the jobs of the roles and resolving their links. Without
+// lint, only the problems that keep the manifest from being loaded are looked
+// for: unknown jobs and releases, invalid types and flight stages, and broken
+// dependencies and links. The manifest is returned even if there are problems,
+// unless it can't be parsed at all.
+func validateRoleManifest(manifestContents []byte, releases map[string]*Release, lint bool) (*RoleManifest, ValidationErrors) {
+	v := &roleManifestValidator{lines: indexYAMLLines(manifestContents)}
+
+	manifest := &RoleManifest{}
+	if err := yaml.Unmarshal(manifestContents, manifest); err != nil {
+		// Type errors leave the rest of the manifest loaded, so validation
+		// can go on; syntax errors don't
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			v.addYAMLError(err.Error())
+			return nil, v.errors
+		}
+		for _, message := range typeErr.Errors {
+			v.addYAMLError(message)
+		}
+	}
+
+	variables := map[string]bool{}
+	if lint && manifest.Configuration != nil {
+		for i, variable := range manifest.Configuration.Variables {
+			path := fmt.Sprintf("configuration.variables[%d]", i)
+			if variable.Name == "" {
+				v.add(path, "Variable has no name")
+			} else if variables[variable.Name] {
+				v.add(path, "Variable %s is declared more than once", variable.Name)
+			}
+			variables[variable.Name] = true
+		}
+
+		v.validateTemplates("configuration.templates", manifest.Configuration.Templates, variables)
+	}
+
+	roleNames := map[string]bool{}
+	for i, role := range manifest.Roles {
+		path := fmt.Sprintf("roles[%d]", i)
+
+		if role.Name == "" {
+			v.add(path, "Role has no name")
+		} else if roleNames[role.Name] {
+			v.add(path+".name", "Role name %s is used more than once", role.Name)
+		}
+		roleNames[role.Name] = true
+
+		switch role.Type {
+		case "", RoleTypeBosh, RoleTypeBoshTask:
+		case RoleTypeDocker:
+			// Docker roles are not built by fissile
+			continue
+		default:
+			v.add(path+".type", "Role %s has an invalid type %s", role.Name, role.Type)
+		}
+
+		v.validateRoleJobs(path, role, releases)
+
+		if role.Run != nil {
+			v.validateFlightStage(path+".run.flight-stage", role)
+		}
+
+		if !lint {
+			continue
+		}
+
+		if role.Run != nil {
+			v.validateRoleRun(path+".run", role)
+			v.validateBootstrapInstance(path+".run.scaling.max", role)
+		}
+
+		if role.Configuration != nil {
+			v.validateTemplates(path+".configuration.templates", role.Configuration.Templates, variables)
+		}
+	}
+
+	for _, err := range checkRoleDependencies(manifest.Roles) {
+		v.add(err.Path, "%s", err.Message)
+	}
+
+	for _, err := range resolveLinks(manifest.Roles) {
+		v.add(err.Path, "%s", err.Message)
+	}
+
+	if lint && manifest.Configuration != nil {
+		v.validateGenerators(manifest.Configuration.Variables, roleNames)
+	}
+
+	sort.Stable(v.errors)
+
+	return manifest, v.errors
+}
+
+func (v *roleManifestValidator) addYAMLError(message string) {
+	line, message := yamlErrorLine(message)
+	v.errors = append(v.errors, &ValidationError{Line: line, Message: message})
+}
+
+func (v *roleManifestValidator) validateRoleJobs(path string, role *Role, releases map[string]*Release) {
+	for i, roleJob := range role.JobNameList {
+		jobPath := fmt.Sprintf("%s.jobs[%d]", path, i)
+
+		if roleJob.Name == "" {
+			v.add(jobPath, "Job in role %s has no name", role.Name)
+			continue
+		}
+
+		release, ok := releases[roleJob.ReleaseName]
+		if !ok {
+			v.add(jobPath+".release_name", "The release %s has not been loaded and is referenced by job %s in role %s", roleJob.ReleaseName, roleJob.Name, role.Name)
+			continue
+		}
+
+		job, err := release.LookupJob(roleJob.Name)
+		if err != nil {
+			v.add(jobPath+".name", "Cannot find job %s in release %s for role %s", roleJob.Name, release.Name, role.Name)
+			continue
+		}
+		roleJob.job = job
+	}
+}
+
+func (v *roleManifestValidator) validateFlightStage(path string, role *Role) {
+	switch role.Run.FlightStage {
+	case "", FlightStagePreFlight, FlightStageFlight, FlightStagePostFlight, FlightStageManual:
+	default:
+		v.add(path, "Role %s has an invalid flight stage %s", role.Name, role.Run.FlightStage)
+	}
+}
+
+func (v *roleManifestValidator) validateRoleRun(path string, role *Role) {
+	run := role.Run
+
+	if run.Scaling != nil {
+		if run.Scaling.Min < 0 {
+			v.add(path+".scaling.min", "Role %s has a negative minimum scale %d", role.Name, run.Scaling.Min)
+		}
+		if run.Scaling.Min > run.Scaling.Max {
+			v.add(path+".scaling", "Role %s has a minimum scale %d greater than its maximum scale %d", role.Name, run.Scaling.Min, run.Scaling.Max)
+		}
+	}
+
+	if run.Memory < 0 {
+		v.add(path+".memory", "Role %s has a negative memory %d", role.Name, run.Memory)
+	}
+	if run.MemoryLimit < 0 {
+		v.add(path+".memory-limit", "Role %s has a negative memory limit %d", role.Name, run.MemoryLimit)
+	} else if run.MemoryLimit > 0 && run.MemoryLimit < run.Memory {
+		v.add(path+".memory-limit", "Role %s has a memory limit %d below its memory %d", role.Name, run.MemoryLimit, run.Memory)
+	}
+	if run.VirtualCPUs < 0 {
+		v.add(path+".virtual-cpus", "Role %s has a negative number of virtual CPUs %g", role.Name, run.VirtualCPUs)
+	}
+	if run.VirtualCPUsLimit < 0 {
+		v.add(path+".virtual-cpus-limit", "Role %s has a negative virtual CPU limit %g", role.Name, run.VirtualCPUsLimit)
+	} else if run.VirtualCPUsLimit > 0 && run.VirtualCPUsLimit < run.VirtualCPUs {
+		v.add(path+".virtual-cpus-limit", "Role %s has a virtual CPU limit %g below its virtual CPUs %g", role.Name, run.VirtualCPUsLimit, run.VirtualCPUs)
+	}
+
+	var exposure PublicExposure
+	if public := run.PublicExposure; public != nil {
+		exposure = public.Type
+		v.validatePublicExposure(path+".public-exposure", role, public)
+	}
+
+	ingressPaths := map[string]bool{}
+	for i, port := range run.ExposedPorts {
+		portPath := fmt.Sprintf("%s.exposed-ports[%d]", path, i)
+		v.validateExposedPort(portPath, port)
+
+		if port.Public && exposure == PublicExposureIngress {
+			if protocol := strings.ToLower(port.Protocol); protocol != "" && protocol != "tcp" {
+				v.add(portPath+".protocol", "Port %s of role %s is exposed through an ingress, but is not a TCP port", port.Name, role.Name)
+			}
+			if strings.Contains(port.External, "-") {
+				v.add(portPath+".external", "Port %s of role %s is exposed through an ingress, but is a port range", port.Name, role.Name)
+			}
+			ingressPath := port.Path
+			if ingressPath == "" {
+				ingressPath = "/"
+			}
+			if ingressPaths[ingressPath] {
+				v.add(portPath, "Port %s of role %s is exposed through an ingress on path %s, like another port", port.Name, role.Name, ingressPath)
+			}
+			ingressPaths[ingressPath] = true
+		}
+	}
+
+	volumeKinds := []struct {
+		key     string
+		volumes []*RoleRunVolume
+	}{
+		{"persistent-volumes", run.PersistentVolumes},
+		{"shared-volumes", run.SharedVolumes},
+		{"ephemeral-volumes", run.EphemeralVolumes},
+		{"host-path-volumes", run.HostPathVolumes},
+	}
+	volumeTags := map[string]bool{}
+	for _, kind := range volumeKinds {
+		for i, volume := range kind.volumes {
+			volumePath := fmt.Sprintf("%s.%s[%d]", path, kind.key, i)
+			v.validateVolume(volumePath, kind.key, volume)
+			if volume.Tag != "" {
+				if volumeTags[volume.Tag] {
+					v.add(volumePath+".tag", "Role %s has more than one volume %s", role.Name, volume.Tag)
+				}
+				volumeTags[volume.Tag] = true
+			}
+		}
+	}
+
+	if run.HealthCheck != nil {
+		healthCheck := run.HealthCheck
+		checks := healthCheck.shorthandChecks()
+		if len(checks) > 1 || (len(checks) == 0 && healthCheck.Liveness == nil && healthCheck.Readiness == nil) {
+			v.add(path+".healthcheck", "Health check for role %s should have exactly one of url, command, or port; got %v", role.Name, checks)
+		}
+		if len(checks) > 0 && healthCheck.Readiness != nil {
+			v.add(path+".healthcheck.readiness", "Health check for role %s has both a readiness check and a readiness section", role.Name)
+		}
+		if healthCheck.Liveness != nil {
+			v.validateHealthProbe(path+".healthcheck.liveness", role, "liveness", healthCheck.Liveness)
+		}
+		if healthCheck.Readiness != nil {
+			v.validateHealthProbe(path+".healthcheck.readiness", role, "readiness", healthCheck.Readiness)
+		}
+	}
+}
+
+// validateBootstrapInstance checks that the jobs of roles without a bootstrap
+// instance don't need one; their templates would never see spec.bootstrap set
+func (v *roleManifestValidator) validateBootstrapInstance(path string, role *Role) {
+	if role.Type == RoleTypeBoshTask || role.HasBootstrapInstance() {
+		return
+	}
+
+	for _, roleJob := range role.JobNameList {
+		if roleJob.job == nil {
+			continue
+		}
+		for _, template := range roleJob.job.Templates {
+			if strings.Contains(template.Content, "spec.bootstrap") {
+				v.add(path, "Role %s may scale to %d pods of a deployment, which have no bootstrap instance, but job %s uses spec.bootstrap; tag the role as clustered",
+					role.Name, role.Run.Scaling.Max, roleJob.Name)
+				break
+			}
+		}
+	}
+}
+
+func (v *roleManifestValidator) validateHealthProbe(path string, role *Role, name string, probe *HealthProbe) {
+	if checks := probe.checks(); len(checks) > 1 {
+		v.add(path, "Health check for role %s should have at most one of url, command, or port for %s; got %v", role.Name, name, checks)
+	}
+	timings := []struct {
+		key   string
+		value int32
+	}{
+		{"initial-delay", probe.InitialDelay},
+		{"period", probe.Period},
+		{"timeout", probe.Timeout},
+		{"failure-threshold", probe.FailureThreshold},
+	}
+	for _, timing := range timings {
+		if timing.value < 0 {
+			v.add(path+"."+timing.key, "Health check for role %s has a negative %s %d for %s", role.Name, timing.key, timing.value, name)
+		}
+	}
+}
+
+func (v *roleManifestValidator) validatePublicExposure(path string, role *Role, public *RoleRunPublic) {
+	switch public.Type {
+	case "", PublicExposureLoadBalancer, PublicExposureNodePort, PublicExposureExternalIPs, PublicExposureIngress:
+	default:
+		v.add(path+".type", "Role %s has an invalid public exposure %s", role.Name, public.Type)
+	}
+
+	if len(public.ExternalIPs) > 0 && public.Type != PublicExposureExternalIPs {
+		v.add(path+".external-ips", "Role %s has external IPs, but is not exposed on external IPs", role.Name)
+	}
+	for i, ip := range public.ExternalIPs {
+		if net.ParseIP(ip) == nil {
+			v.add(fmt.Sprintf("%s.external-ips[%d]", path, i), "Role %s has an invalid external IP %s", role.Name, ip)
+		}
+	}
+
+	if public.Host != "" && public.Type != PublicExposureIngress {
+		v.add(path+".host", "Role %s has an ingress host, but is not exposed through an ingress", role.Name)
+	}
+}
+
+func (v *roleManifestValidator) validateExposedPort(path string, port *RoleRunExposedPort) {
+	if !strings.ContainsAny(strings.ToLower(port.Name), "abcdefghijklmnopqrstuvwxyz0123456789") {
+		v.add(path+".name", "Port name %s does not contain any letters or digits", port.Name)
+	}
+
+	switch strings.ToLower(port.Protocol) {
+	case "", "tcp", "udp":
+	default:
+		v.add(path+".protocol", "Port %s has an invalid protocol %s, expected TCP or UDP", port.Name, port.Protocol)
+	}
+
+	minInternal, maxInternal, err := ParsePortRange(port.Internal, port.Name, "internal")
+	if err != nil {
+		v.add(path+".internal", "%s", err.Error())
+		return
+	}
+
+	if !port.Public {
+		if port.NodePort != "" {
+			v.add(path+".node-port", "Port %s has a node port, but is not public", port.Name)
+		}
+		if port.Path != "" {
+			v.add(path+".path", "Port %s has a path, but is not public", port.Name)
+		}
+	}
+	if port.Path != "" && !strings.HasPrefix(port.Path, "/") {
+		v.add(path+".path", "Port %s has a path %s not starting with /", port.Name, port.Path)
+	}
+	if port.NodePort != "" {
+		minNode, maxNode, err := ParsePortRange(port.NodePort, port.Name, "node")
+		if err != nil {
+			v.add(path+".node-port", "%s", err.Error())
+		} else if maxInternal-minInternal != maxNode-minNode {
+			v.add(path+".node-port", "Port %s has mismatched internal and node port ranges %s and %s", port.Name, port.Internal, port.NodePort)
+		}
+	}
+
+	if port.External == "" {
+		if port.Public {
+			v.add(path+".external", "Port %s is public, but has no external port", port.Name)
+		}
+		return
+	}
+
+	minExternal, maxExternal, err := ParsePortRange(port.External, port.Name, "external")
+	if err != nil {
+		v.add(path+".external", "%s", err.Error())
+		return
+	}
+
+	if maxInternal-minInternal != maxExternal-minExternal {
+		v.add(path, "Port %s has mismatched internal and external port ranges %s and %s", port.Name, port.Internal, port.External)
+	}
+}
+
+func (v *roleManifestValidator) validateVolume(path, kind string, volume *RoleRunVolume) {
+	if volume.Tag == "" {
+		v.add(path, "Volume for %s has no tag", volume.Path)
+		return
+	}
+	if volume.Path == "" {
+		v.add(path, "Volume %s has no path", volume.Tag)
+	}
+
+	claimed := kind == "persistent-volumes" || kind == "shared-volumes"
+	if claimed {
+		if volume.Size == "" || volume.Size == "0" {
+			v.add(path, "Volume %s has no size", volume.Tag)
+		} else if !volumeSizeRegexp.MatchString(volume.Size) {
+			v.add(path+".size", "Volume %s has an invalid size %s", volume.Tag, volume.Size)
+		}
+	} else {
+		if volume.Size != "" {
+			v.add(path+".size", "Volume %s has a size, but is not a persistent or shared volume", volume.Tag)
+		}
+		if volume.StorageClass != "" {
+			v.add(path+".storage-class", "Volume %s has a storage class, but is not a persistent or shared volume", volume.Tag)
+		}
+	}
+	if volume.Memory && kind != "ephemeral-volumes" {
+		v.add(path+".memory", "Volume %s is backed by memory, but is not an ephemeral volume", volume.Tag)
+	}
+	if kind == "host-path-volumes" {
+		if !strings.HasPrefix(volume.HostPath, "/") {
+			v.add(path+".host-path", "Host path volume %s should have an absolute host path, not %q", volume.Tag, volume.HostPath)
+		}
+	} else if volume.HostPath != "" {
+		v.add(path+".host-path", "Volume %s has a host path, but is not a host path volume", volume.Tag)
+	}
+}
+
+func (v *roleManifestValidator) validateGenerators(variables ConfigurationVariableSlice, roleNames map[string]bool) {
+	generatorTypes := map[string]string{}
+	caIDs := map[string]bool{}
+
+	for i, variable := range variables {
+		if variable.Generator == nil {
+			continue
+		}
+		path := fmt.Sprintf("configuration.variables[%d].generator", i)
+		generator := variable.Generator
+
+		if generator.ID == "" {
+			v.add(path, "Generator of variable %s has no id", variable.Name)
+		}
+
+		valueTypes, ok := GeneratorValueTypes[generator.Type]
+		if !ok {
+			v.add(path+".type", "Generator of variable %s has an invalid type %s", variable.Name, generator.Type)
+			continue
+		}
+		if !containsString(valueTypes, generator.ValueType) {
+			v.add(path+".value_type", "Generator of variable %s has an invalid value type %s, expected one of %s",
+				variable.Name, generator.ValueType, strings.Join(valueTypes, ", "))
+		}
+
+		if generatorType, ok := generatorTypes[generator.ID]; ok && generatorType != generator.Type {
+			v.add(path+".type", "Generator %s of variable %s is a %s, but is a %s elsewhere", generator.ID, variable.Name, generator.Type, generatorType)
+		}
+		generatorTypes[generator.ID] = generator.Type
+
+		if generator.Type == GeneratorTypeCACertificate {
+			caIDs[generator.ID] = true
+		}
+
+		if generator.RoleName != "" {
+			if generator.Type != GeneratorTypeCertificate {
+				v.add(path+".role_name", "Generator of variable %s is not a certificate, but has a role name", variable.Name)
+			} else if !roleNames[generator.RoleName] {
+				v.add(path+".role_name", "Generator of variable %s references unknown role %s", variable.Name, generator.RoleName)
+			}
+		}
+		if generator.CA != "" && generator.Type != GeneratorTypeCertificate {
+			v.add(path+".ca", "Generator of variable %s is not a certificate, but has a ca", variable.Name)
+		}
+	}
+
+	// Certificates name their CA, unless there is only one
+	for i, variable := range variables {
+		if variable.Generator == nil || variable.Generator.Type != GeneratorTypeCertificate {
+			continue
+		}
+		path := fmt.Sprintf("configuration.variables[%d].generator", i)
+		switch ca := variable.Generator.CA; {
+		case ca != "" && !caIDs[ca]:
+			v.add(path+".ca", "Certificate of variable %s is signed by %s, which is not a CA certificate generator", variable.Name, ca)
+		case ca == "" && len(caIDs) == 0:
+			v.add(path, "Certificate of variable %s needs a CA certificate generator, found none", variable.Name)
+		case ca == "" && len(caIDs) > 1:
+			v.add(path, "Certificate of variable %s needs a ca, as there are %d CA certificate generators", variable.Name, len(caIDs))
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *roleManifestValidator) validateTemplates(path string, templates map[string]string, variables map[string]bool) {
+	for name, template := range templates {
+		templatePath := fmt.Sprintf("%s.%s", path, name)
+
+		varsInTemplate, err := parseTemplate(template)
+		if err != nil {
+			v.add(templatePath, "Template %s is invalid: %s", name, err.Error())
+			continue
+		}
+
+		for _, variable := range varsInTemplate {
+			if !variables[variable] && !builtinTemplateVariables[variable] {
+				v.add(templatePath, "Template %s references undeclared variable %s", name, variable)
+			}
+		}
+	}
+}
+
+// ParsePortRange converts a port range string to a starting and an ending port number
+// port ranges can be single integers (e.g. 8080) or they can be ranges (e.g. 10001-10010)
+func ParsePortRange(portRange, name, description string) (int32, int32, error) {
+	idx := strings.Index(portRange, "-")
+	if idx < 0 {
+		portNum, err := parsePort(portRange)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Port %s has invalid %s port %s: %s", name, description, portRange, err)
+		}
+		return portNum, portNum, nil
+	}
+
+	minPort, err := parsePort(portRange[:idx])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Port %s has invalid %s starting port %s: %s", name, description, portRange[:idx], err)
+	}
+	maxPort, err := parsePort(portRange[idx+1:])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Port %s has invalid %s ending port %s: %s", name, description, portRange[idx+1:], err)
+	}
+	if minPort > maxPort {
+		return 0, 0, fmt.Errorf("Port %s has invalid %s port range %s", name, description, portRange)
+	}
+	return minPort, maxPort, nil
+}
+
+// parsePort converts a port number, which must be between 1 and 65535
+func parsePort(port string) (int32, error) {
+	portNum, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if portNum < 1 || portNum > 65535 {
+		return 0, fmt.Errorf("port number %d is out of range", portNum)
+	}
+	return int32(portNum), nil
+}
@@ -0,0 +1,358 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRoleManifestOK(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	assert.NoError(err)
+
+	for _, manifestName := range []string{"tor-good.yml", "exposed-ports.yml", "generators.yml", "public-exposure.yml"} {
+		roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests", manifestName)
+		errs, err := ValidateRoleManifest(roleManifestPath, []*Release{release})
+		assert.NoError(err)
+		assert.Empty(errs, "Unexpected problems in %s", manifestName)
+	}
+}
+
+func TestValidateRoleManifestCollectsAllProblems(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	torReleasePathBoshCache := filepath.Join(torReleasePath, "bosh-cache")
+	release, err := NewDevRelease(torReleasePath, "", "", torReleasePathBoshCache, nil)
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/validation-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, []*Release{release})
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 8: roles[0].jobs[0].consumes.tor: Job new_hostname in role myrole does not consume a link tor",
+		"line 10: roles[0].jobs[1].name: Cannot find job foo in release tor for role myrole",
+		"line 13: roles[0].run.flight-stage: Role myrole has an invalid flight stage taxiing",
+		"line 14: roles[0].run.scaling: Role myrole has a minimum scale 3 greater than its maximum scale 1",
+		"line 18: roles[0].run.exposed-ports[0]: Port http has mismatched internal and external port ranges 8080-8081 and 80",
+		"line 22: roles[0].run.exposed-ports[1].name: Port name --- does not contain any letters or digits",
+		"line 23: roles[0].run.exposed-ports[1].protocol: Port --- has an invalid protocol SCTP, expected TCP or UDP",
+		"line 24: roles[0].run.exposed-ports[1].internal: Port --- has invalid internal port 70000: port number 70000 is out of range",
+		"line 27: roles[0].run.persistent-volumes[0]: Volume store has no size",
+		"line 31: roles[0].configuration.templates.properties.tor.hostname: Template properties.tor.hostname references undeclared variable MISSING",
+		"line 32: roles[1].name: Role name myrole is used more than once",
+		"line 36: roles[1].jobs[0].release_name: The release notor has not been loaded and is referenced by job tor in role myrole",
+		"line 41: configuration.templates.properties.tor.private_key: Template properties.tor.private_key references undeclared variable UNDECLARED",
+	}, actual)
+}
+
+func TestValidateRoleManifestGenerators(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/generators-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 6: configuration.variables[0].generator: Generator of variable NO_ID has no id",
+		"line 12: configuration.variables[1].generator.type: Generator of variable TOKEN has an invalid type Token",
+		"line 18: configuration.variables[2].generator.value_type: Generator of variable SSH_KEY has an invalid value type password, expected one of private_key, public_key, fingerprint",
+		"line 22: configuration.variables[3].generator.type: Generator ssh of variable SSH_PASSWORD is a Password, but is a SSH elsewhere",
+		"line 25: configuration.variables[4].generator: Certificate of variable TLS_CERT needs a CA certificate generator, found none",
+		"line 29: configuration.variables[4].generator.role_name: Generator of variable TLS_CERT references unknown role missing",
+	}, actual)
+}
+
+func TestValidateRoleManifestPublicExposure(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/public-exposure-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 7: roles[0].run.public-exposure.type: Role myrole has an invalid public exposure floating-ip",
+		"line 8: roles[0].run.public-exposure.external-ips: Role myrole has external IPs, but is not exposed on external IPs",
+		"line 9: roles[0].run.public-exposure.external-ips[0]: Role myrole has an invalid external IP 10.0.0.300",
+		"line 10: roles[0].run.public-exposure.host: Role myrole has an ingress host, but is not exposed through an ingress",
+		"line 15: roles[0].run.exposed-ports[0].node-port: Port http has mismatched internal and node port ranges 8080 and 30080-30081",
+		"line 20: roles[0].run.exposed-ports[1].path: Port metrics has a path, but is not public",
+		"line 20: roles[0].run.exposed-ports[1].path: Port metrics has a path metrics not starting with /",
+		"line 31: roles[1].run.exposed-ports[1]: Port https of role web is exposed through an ingress on path /, like another port",
+		"line 32: roles[1].run.exposed-ports[1].protocol: Port https of role web is exposed through an ingress, but is not a TCP port",
+		"line 33: roles[1].run.exposed-ports[1].external: Port https of role web is exposed through an ingress, but is a port range",
+	}, actual)
+}
+
+func TestValidateRoleManifestResources(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/resources-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 7: roles[0].run.memory-limit: Role myrole has a memory limit 256 below its memory 512",
+		"line 9: roles[0].run.virtual-cpus-limit: Role myrole has a virtual CPU limit 1.5 below its virtual CPUs 2",
+		"line 13: roles[1].run.memory: Role other has a negative memory -1",
+		"line 14: roles[1].run.virtual-cpus: Role other has a negative number of virtual CPUs -0.5",
+	}, actual)
+}
+
+func TestValidateRoleManifestHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/healthcheck-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 8: roles[0].run.healthcheck.readiness: Health check for role myrole has both a readiness check and a readiness section",
+		"line 10: roles[0].run.healthcheck.liveness: Health check for role myrole should have at most one of url, command, or port for liveness; got [command port]",
+		"line 13: roles[0].run.healthcheck.liveness.period: Health check for role myrole has a negative period -10 for liveness",
+		"line 17: roles[1].run.healthcheck: Health check for role other should have exactly one of url, command, or port; got []",
+	}, actual)
+}
+
+func TestValidateRoleManifestVolumes(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/volumes-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 9: roles[0].run.persistent-volumes[0].size: Volume data has an invalid size 5 gallons",
+		"line 10: roles[0].run.persistent-volumes[0].memory: Volume data is backed by memory, but is not an ephemeral volume",
+		"line 17: roles[0].run.ephemeral-volumes[0].size: Volume scratch has a size, but is not a persistent or shared volume",
+		"line 18: roles[0].run.ephemeral-volumes[0].storage-class: Volume scratch has a storage class, but is not a persistent or shared volume",
+		"line 20: roles[0].run.ephemeral-volumes[1].tag: Role myrole has more than one volume data",
+		"line 24: roles[0].run.host-path-volumes[0].host-path: Host path volume socket should have an absolute host path, not \"var/run/docker.sock\"",
+	}, actual)
+}
+
+func TestValidateRoleManifestCertificateCAs(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/generators-ca-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 16: configuration.variables[2].generator: Certificate of variable TLS_CERT needs a ca, as there are 2 CA certificate generators",
+		"line 25: configuration.variables[3].generator.ca: Certificate of variable SIGNED_CERT is signed by tls, which is not a CA certificate generator",
+		"line 31: configuration.variables[4].generator.ca: Generator of variable PASSWORD is not a certificate, but has a ca",
+	}, actual)
+}
+
+func TestValidateRoleManifestBootstrapInstance(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	release := &Release{Name: "bootstrap", Jobs: Jobs{
+		{Name: "leader", Templates: []*JobTemplate{{Content: "<% if spec.bootstrap %>init<% end %>"}}},
+		{Name: "worker", Templates: []*JobTemplate{{Content: "work"}}},
+	}}
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/bootstrap-bad.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, []*Release{release})
+	assert.NoError(err)
+
+	var actual []string
+	for _, e := range errs {
+		actual = append(actual, e.Error())
+	}
+
+	assert.Equal([]string{
+		"line 10: roles[0].run.scaling.max: Role scaled may scale to 3 pods of a deployment, which have no bootstrap instance, but job leader uses spec.bootstrap; tag the role as clustered",
+	}, actual)
+}
+
+func TestValidateRoleManifestSyntaxError(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/tor-bad-syntax.yml")
+	errs, err := ValidateRoleManifest(roleManifestPath, nil)
+	assert.NoError(err)
+	if assert.Len(errs, 1) {
+		assert.Equal(3, errs[0].Line)
+	}
+}
+
+func TestIndexYAMLLines(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := indexYAMLLines([]byte(`---
+# A comment
+roles:
+- name: myrole
+  jobs:
+    - name: tor
+      release_name: tor
+  scripts: [a.sh]
+  description: |
+    name: not a key
+- name: other
+  run:
+    exposed-ports:
+    -
+      name: http
+configuration:
+  "quoted: key": value
+`))
+
+	assert.Equal(yamlLines{
+		"roles":                              3,
+		"roles[0]":                           4,
+		"roles[0].name":                      4,
+		"roles[0].jobs":                      5,
+		"roles[0].jobs[0]":                   6,
+		"roles[0].jobs[0].name":              6,
+		"roles[0].jobs[0].release_name":      7,
+		"roles[0].scripts":                   8,
+		"roles[0].description":               9,
+		"roles[1]":                           11,
+		"roles[1].name":                      11,
+		"roles[1].run":                       12,
+		"roles[1].run.exposed-ports":         13,
+		"roles[1].run.exposed-ports[0]":      14,
+		"roles[1].run.exposed-ports[0].name": 15,
+		"configuration":                      16,
+		"configuration.quoted: key":          17,
+	}, lines)
+
+	assert.Equal(15, lines.lookup("roles[1].run.exposed-ports[0].name"))
+	assert.Equal(14, lines.lookup("roles[1].run.exposed-ports[0].internal"))
+	assert.Equal(0, lines.lookup("missing"))
+}
+
+func TestParsePortRange(t *testing.T) {
+	assert := assert.New(t)
+
+	samples := []struct {
+		name  string
+		input string
+		min   int32
+		max   int32
+		err   string
+	}{
+		{
+			name:  "single port",
+			input: "1234",
+			min:   1234,
+			max:   1234,
+		},
+		{
+			name:  "port range",
+			input: "1234-5678",
+			min:   1234,
+			max:   5678,
+		},
+		{
+			name:  "invalid number",
+			input: "garbage",
+			err:   `Port invalid number has invalid description port garbage: strconv.ParseInt: parsing "garbage": invalid syntax`,
+		},
+		{
+			name:  "empty port range",
+			input: "",
+			err:   `Port empty port range has invalid description port : strconv.ParseInt: parsing "": invalid syntax`,
+		},
+		{
+			name:  "invalid start port",
+			input: "trash-1",
+			err:   `Port invalid start port has invalid description starting port trash: strconv.ParseInt: parsing "trash": invalid syntax`,
+		},
+		{
+			name:  "invalid end port",
+			input: "1-junk",
+			err:   `Port invalid end port has invalid description ending port junk: strconv.ParseInt: parsing "junk": invalid syntax`,
+		},
+		{
+			name:  "inverted port range",
+			input: "5678-1234",
+			err:   `Port inverted port range has invalid description port range 5678-1234`,
+		},
+	}
+
+	for _, sample := range samples {
+		min, max, err := ParsePortRange(sample.input, sample.name, "description")
+		if sample.err != "" {
+			assert.EqualError(err, sample.err, "Expected error in case %s", sample.name)
+		} else if assert.NoError(err, "Unexpected error in case %s", sample.name) {
+			assert.Equal(sample.min, min, "Unexpected start port in %s", sample.name)
+			assert.Equal(sample.max, max, "Unexpected end port in %s", sample.name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// yamlLines maps the paths of the nodes of a YAML document (for example
+// roles[2].run.exposed-ports[0].internal) to the lines they start on
+type yamlLines map[string]int
+
+// yamlLinesFrame is a mapping or sequence whose children are being indexed
+type yamlLinesFrame struct {
+	path        string
+	indent      int  // The indentation of the line that opened the frame
+	childIndent int  // The indentation of the children, -1 until the first one is seen
+	sequence    bool // Whether the children are sequence items
+	fromKey     bool // Whether the frame is the value of a mapping key
+	items       int  // The number of sequence items seen so far
+}
+
+// indexYAMLLines determines the line numbers of the nodes of a YAML document.
+// It only understands the block style used by role manifests and job specs
+// (flow collections are treated as scalars), which is enough to point the
+// user at the right place when reporting problems.
+func indexYAMLLines(contents []byte) yamlLines {
+	lines := yamlLines{}
+	stack := []*yamlLinesFrame{{indent: -1, childIndent: -1}}
+
+	// blockScalarIndent is set while skipping the contents of a literal or
+	// folded block scalar; they are indented further than its key
+	blockScalarIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		content := strings.TrimLeft(text, " ")
+		indent := len(text) - len(content)
+
+		if blockScalarIndent >= 0 {
+			if content == "" || indent > blockScalarIndent {
+				continue
+			}
+			blockScalarIndent = -1
+		}
+
+		if content == "" || strings.HasPrefix(content, "#") || content == "---" || content == "..." {
+			continue
+		}
+
+		isItem := content == "-" || strings.HasPrefix(content, "- ")
+
+		// Find the frame this line belongs to
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			if top.childIndent < 0 {
+				if indent > top.indent || (isItem && top.fromKey && indent == top.indent) {
+					top.childIndent = indent
+					top.sequence = isItem
+					break
+				}
+			} else if indent == top.childIndent && isItem == top.sequence {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		top := stack[len(stack)-1]
+		if top.childIndent < 0 {
+			top.childIndent = indent
+			top.sequence = isItem
+		}
+
+		if isItem {
+			path := fmt.Sprintf("%s[%d]", top.path, top.items)
+			top.items++
+			lines[path] = lineNumber
+
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			if rest == "" {
+				stack = append(stack, &yamlLinesFrame{path: path, indent: indent, childIndent: -1})
+				continue
+			}
+			if _, _, ok := yamlKeyValue(rest); !ok {
+				// A scalar item (nested sequences on one line are not indexed)
+				continue
+			}
+
+			// The item is a mapping starting on the same line
+			restIndent := indent + len(content) - len(rest)
+			top = &yamlLinesFrame{path: path, indent: indent, childIndent: restIndent}
+			stack = append(stack, top)
+			content, indent = rest, restIndent
+		}
+
+		key, value, ok := yamlKeyValue(content)
+		if !ok || top.sequence {
+			// Continuation of a multi-line plain scalar
+			continue
+		}
+
+		path := key
+		if top.path != "" {
+			path = top.path + "." + key
+		}
+		lines[path] = lineNumber
+
+		switch {
+		case value == "" || strings.HasPrefix(value, "#"):
+			stack = append(stack, &yamlLinesFrame{path: path, indent: indent, childIndent: -1, fromKey: true})
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			blockScalarIndent = indent
+		}
+	}
+
+	return lines
+}
+
+// yamlKeyValue splits a "key: value" line; ok is false if the line has no key
+func yamlKeyValue(content string) (key, value string, ok bool) {
+	if content[0] == '"' || content[0] == '\'' {
+		end := strings.IndexByte(content[1:], content[0])
+		if end < 0 {
+			return "", "", false
+		}
+		rest := strings.TrimLeft(content[end+2:], " ")
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return content[1 : end+1], strings.TrimSpace(rest[1:]), true
+	}
+
+	if idx := strings.Index(content, ": "); idx > 0 {
+		return content[:idx], strings.TrimSpace(content[idx+2:]), true
+	}
+	if strings.HasSuffix(content, ":") {
+		return content[:len(content)-1], "", true
+	}
+
+	return "", "", false
+}
+
+// lookup returns the line of the node at the path, or of its closest
+// ancestor found in the document; it returns 0 if nothing is found
+func (l yamlLines) lookup(path string) int {
+	for path != "" {
+		if line, ok := l[path]; ok {
+			return line
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			break
+		}
+		path = path[:cut]
+	}
+
+	return 0
+}
@@ -0,0 +1,33 @@
+set -e # exit immediately if a simple command exits with a non-zero status
+set -u # report the usage of uninitialized variables
+
+# This is the openSUSE equivalent of ubuntu-prerequisites.sh; the package
+# list mirrors the Debian packages installed there, using the openSUSE names.
+
+rpms="gcc gcc-c++ make patch libopenssl-devel lsof strace bind-utils \
+tcpdump iputils curl wget libcurl4 libcurl-devel bison readline-devel \
+libxml2-2 libxml2-devel libxslt1 libxslt-devel zip unzip \
+nfs-client flex psmisc apparmor-utils iptables sysstat \
+rsync openssh traceroute ncurses-devel quota \
+libaio1 gdb libcap2 libcap-progs libcap-devel libbz2-devel \
+cmake libuuid-devel libgcrypt-devel ca-certificates \
+sg3_utils mg htop runit parted \
+cronie libyaml-devel gettext-runtime git-core tar gzip which shadow"
+
+# Offline builds provide the packages (with all dependencies) next to this
+# script, instead of downloading them
+offline_dir="$(dirname "$0")/offline"
+
+if [ -d "${offline_dir}" ]; then
+  mkdir -p /tmp/offline-packages
+  tar -xzf "${offline_dir}/opensuse-packages.tgz" -C /tmp/offline-packages
+  rpm -Uvh --replacepkgs /tmp/offline-packages/*.rpm
+  rm -rf /tmp/offline-packages
+else
+  zypper --non-interactive refresh
+  zypper --non-interactive install --no-recommends $rpms
+  zypper --non-interactive clean --all
+fi
+
+# Add the vcap:vcap user to match CF
+useradd -m -U --comment 'hcf user' vcap
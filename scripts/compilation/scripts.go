@@ -3,11 +3,15 @@ package compilation
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
+	"strings"
 )
 
 const (
 	// UbuntuBase is the name of the Ubuntu base image
 	UbuntuBase = "ubuntu"
+	// OpenSUSEBase is the name of the openSUSE base image
+	OpenSUSEBase = "opensuse"
 	// FakeBase is the name of the fake base image
 	FakeBase = "fake"
 	// FailBase is used to force package compile to fail when testing.
@@ -19,6 +23,29 @@ const (
 	PrerequisitesScript = "prerequisites"
 )
 
+// StemcellOSes lists the base types usable for stemcells, i.e. for the
+// compilation and role base layers, mapped to the default docker image they
+// are built from
+var StemcellOSes = map[string]string{
+	UbuntuBase:   "ubuntu:14.04",
+	OpenSUSEBase: "opensuse:42.2",
+}
+
+// ValidateStemcellOS checks that the base type can be used for stemcells
+func ValidateStemcellOS(baseType string) error {
+	if _, ok := StemcellOSes[baseType]; ok {
+		return nil
+	}
+
+	var names []string
+	for name := range StemcellOSes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("Invalid stemcell OS '%s', expected one of %s", baseType, strings.Join(names, ", "))
+}
+
 // SaveScript will write a script to the disk
 func SaveScript(baseType, scriptType, path string) error {
 	script, err := GetScript(baseType, scriptType)
@@ -25,8 +25,19 @@ anacron software-properties-common libyaml-dev gettext git"
 
 export DEBIAN_FRONTEND=noninteractive
 
-apt-get update
-apt-get install -o Dpkg::Options::="--force-confnew" -f -y --force-yes --no-install-recommends $debs
+# Offline builds provide the packages (with all dependencies) next to this
+# script, instead of downloading them
+offline_dir="$(dirname "$0")/offline"
+
+if [ -d "${offline_dir}" ]; then
+  mkdir -p /tmp/offline-packages
+  tar -xzf "${offline_dir}/ubuntu-packages.tgz" -C /tmp/offline-packages
+  dpkg -i --force-confnew /tmp/offline-packages/*.deb
+  rm -rf /tmp/offline-packages
+else
+  apt-get update
+  apt-get install -o Dpkg::Options::="--force-confnew" -f -y --force-yes --no-install-recommends $debs
+fi
 
 # Add the vcap:vcap user to match CF
 useradd -m --comment 'hcf user' vcap
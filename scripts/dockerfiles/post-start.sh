@@ -21,6 +21,21 @@
   flock -n 9 || exit 1
 
   notyet=$(monit summary | tail -n+3 | grep -v post-start | grep -v 'Accessible\|Running')
+
+  # The roles this role depends on have to be reachable too, through the
+  # services (host:port) listed by run.sh
+  if [ -z "$notyet" ] && [ -s /var/vcap/monit/depends-on ]
+  then
+      while read address
+      do
+	  if [ -n "$address" ] && ! timeout 5 bash -c "exec 3<>/dev/tcp/${address%:*}/${address##*:}" 2>/dev/null
+	  then
+	      notyet="$address"
+	      break
+	  fi
+      done < /var/vcap/monit/depends-on
+  fi
+
   if [ -z "$notyet" ]
   then
       scripts="$(find /var/vcap/jobs/*/bin -name post-start)"
@@ -14,6 +14,13 @@ fi
 # ready yet.
 rm -f /var/vcap/monit/ready /var/vcap/monit/ready.lock
 
+# The services of the roles this role depends on. post-start.sh waits for
+# them to be reachable before running the post-start scripts of the jobs.
+mkdir -p /var/vcap/monit
+cat > /var/vcap/monit/depends-on <<EOF
+{{ range $address := .role.DependencyAddresses }}{{ $address }}
+{{ end }}EOF
+
 # When the container gets restarted, processes may end up with different pids
 find /run -name "*.pid" -delete
 if [ -d /var/vcap/sys/run ]; then
@@ -34,6 +41,65 @@ export MONIT_ADMIN_PASSWORD=$(cat /proc/sys/kernel/random/uuid)
     bash {{ if not (is_abs $script) }}/opt/hcf/startup/{{ end }}{{ $script }}
 {{ end }}
 
+# Fill in the parts of the BOSH instance spec that depend on the pod. Only
+# the pods of stateful sets have an ordinal (the suffix of their name); the
+# availability zone can be set via KUBE_AZ, e.g. by an environment script.
+{{ if .role.IsStateful }}
+spec_index="${HOSTNAME##*-}"
+if ! [[ "${spec_index}" =~ ^[0-9]+$ ]]; then
+    spec_index=0
+fi
+spec_address="${HOSTNAME}.{{ .role.Name }}-pod"
+{{ else }}
+spec_index=0
+spec_address="${IP_ADDRESS}"
+{{ end }}
+# Only the first instance is the bootstrap instance; the pods of deployments
+# that may scale above one instance are all the "first", so none of them is.
+spec_bootstrap=false
+{{ if .role.HasBootstrapInstance }}
+if [ "${spec_index}" == "0" ]; then
+    spec_bootstrap=true
+fi
+{{ end }}
+for config_spec in /var/vcap/jobs-src/*/config_spec.json ; do
+    sed -i \
+        -e "s|{{ .spec.id }}|${HOSTNAME}|g" \
+        -e "s|\"{{ .spec.index }}\"|${spec_index}|g" \
+        -e "s|{{ .spec.az }}|${KUBE_AZ:-}|g" \
+        -e "s|\"{{ .spec.bootstrap }}\"|${spec_bootstrap}|g" \
+        -e "s|{{ .spec.address }}|${spec_address}|g" \
+        -e "s|{{ .spec.deployment }}|${KUBERNETES_NAMESPACE:-}|g" \
+        -e "s|{{ .spec.ip }}|${KUBERNETES_POD_IP:-${IP_ADDRESS}}|g" \
+        "${config_spec}"
+done
+
+# Fill in the instances of the roles providing the links consumed by the jobs.
+# Their number is passed in by kube, as the roles can be scaled without the
+# images being rebuilt; the addresses and the bootstrap instance follow the
+# same rules as the instance spec above.
+{{ range $provider := .role.LinkProviderRoles }}
+link_count="{{ printf "${%s:-%d}" $provider.LinkInstancesEnvVar $provider.InstanceCount }}"
+link_instances=""
+for (( index = 0; index < link_count; index++ )); do
+{{ if $provider.IsStateful }}
+    link_address="{{ $provider.Name }}-${index}.{{ $provider.Name }}-pod"
+{{ else }}
+    link_address="{{ $provider.Name }}"
+{{ end }}
+    link_bootstrap=false
+{{ if $provider.HasBootstrapInstance }}
+    if [ "${index}" == "0" ]; then
+        link_bootstrap=true
+    fi
+{{ end }}
+    link_instances="${link_instances:+${link_instances},}{\"name\":\"{{ $provider.Name }}\",\"index\":${index},\"id\":\"{{ $provider.Name }}-${index}\",\"address\":\"${link_address}\",\"bootstrap\":${link_bootstrap}}"
+done
+for config_spec in /var/vcap/jobs-src/*/config_spec.json ; do
+    sed -i -e "s|\"{{ $provider.LinkInstancesPlaceholder }}\"|[${link_instances}]|g" "${config_spec}"
+done
+{{ end }}
+
 /opt/hcf/configgin/configgin \
 	--jobs /opt/hcf/job_config.json \
 	--env2conf /opt/hcf/env2conf.yml
@@ -50,7 +116,12 @@ chmod 775 /var/vcap/sys/run
 
 {{ if eq .role.Type "bosh-task" }}
     # Start rsyslog and cron
-    service rsyslog start
+    if [ -x /etc/init.d/rsyslog ]
+    then
+        service rsyslog start
+    else
+        /usr/sbin/rsyslogd
+    fi
     cron
 {{ else }}
     # rsyslog and cron are started via monit
@@ -0,0 +1,201 @@
+package offline
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChecksumsFile lists the SHA256 checksums of the artifacts which have no
+// pinned checksum, in the format written by sha256sum. The one embedded into
+// fissile takes precedence over the one in the assets directory, which can
+// only add checksums of artifacts fissile doesn't know.
+const ChecksumsFile = "SHA256SUMS"
+
+// Artifact is an external file needed to build the stemcell and compilation
+// layers. Online builds download it; offline builds take it from a local
+// directory, or from the assets embedded into fissile (see make/offline-assets).
+type Artifact struct {
+	Name        string // The file name, in the assets directory and the embedded assets
+	SHA256      string // The pinned checksum; if empty, it has to be listed in ChecksumsFile
+	Description string // Where to get the artifact from
+}
+
+// DumbInit is the init process used by the role images
+var DumbInit = Artifact{
+	Name:        "dumb-init_1.1.3_amd64.deb",
+	SHA256:      "34995cf69c88311e9475b4d101186b1d5f4d653f222e41c6e5643ff4e6f56f54",
+	Description: "https://github.com/Yelp/dumb-init/releases/download/v1.1.3/dumb-init_1.1.3_amd64.deb",
+}
+
+// PackagesArtifact is the tarball of the OS packages (including all their
+// dependencies) installed into the stemcell and compilation layers
+func PackagesArtifact(stemcellOS string) Artifact {
+	return Artifact{
+		Name:        fmt.Sprintf("%s-packages.tgz", stemcellOS),
+		Description: fmt.Sprintf("a tarball of the %s packages installed by the stemcell and compilation layers, with all dependencies", stemcellOS),
+	}
+}
+
+// Artifacts lists the artifacts needed to build the layers for a stemcell OS
+func Artifacts(stemcellOS string) []Artifact {
+	return []Artifact{
+		DumbInit,
+		PackagesArtifact(stemcellOS),
+	}
+}
+
+// embeddedAsset returns the contents of an asset embedded into fissile
+var embeddedAsset = Asset
+
+// Assets are the contents of the artifacts, keyed by their names
+type Assets map[string][]byte
+
+// Load gathers all artifacts needed for the stemcell OS, looking in assetsDir
+// first (if given) and then in the embedded assets. Each artifact is verified
+// against its pinned or embedded checksum, so that the assets directory can't
+// swap in different artifacts; the checksums of the assets directory are only
+// used for artifacts without either. All missing or invalid artifacts are
+// reported in one error, so that they can be fixed before any image gets
+// built.
+func Load(assetsDir, stemcellOS string) (Assets, error) {
+	checksums, err := loadChecksums(assetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := Assets{}
+	var problems []string
+
+	for _, artifact := range Artifacts(stemcellOS) {
+		contents, err := readArtifact(assetsDir, artifact.Name)
+		if err != nil {
+			return nil, err
+		}
+		if contents == nil {
+			problems = append(problems, fmt.Sprintf("%s is missing (%s)", artifact.Name, artifact.Description))
+			continue
+		}
+
+		expected := artifact.SHA256
+		if expected == "" {
+			expected = checksums[artifact.Name]
+		}
+		if expected == "" {
+			problems = append(problems, fmt.Sprintf("%s has no checksum in %s", artifact.Name, ChecksumsFile))
+			continue
+		}
+
+		if actual := fmt.Sprintf("%x", sha256.Sum256(contents)); actual != expected {
+			problems = append(problems, fmt.Sprintf("%s has checksum %s, expected %s", artifact.Name, actual, expected))
+			continue
+		}
+
+		assets[artifact.Name] = contents
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("Offline build assets are missing or invalid:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return assets, nil
+}
+
+// SaveTo writes all assets into the directory
+func (a Assets) SaveTo(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for name, contents := range a {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			return fmt.Errorf("Error writing offline asset %s: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// readArtifact returns the contents of the artifact, or nil if it can't be
+// found in either the assets directory or the embedded assets
+func readArtifact(assetsDir, name string) ([]byte, error) {
+	if assetsDir != "" {
+		contents, err := ioutil.ReadFile(filepath.Join(assetsDir, name))
+		if err == nil {
+			return contents, nil
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Error reading offline asset %s: %s", name, err.Error())
+		}
+	}
+
+	if contents, err := embeddedAsset(name); err == nil {
+		return contents, nil
+	}
+
+	return nil, nil
+}
+
+// loadChecksums reads the checksums of the embedded assets and of the assets
+// directory; the latter can't override the former
+func loadChecksums(assetsDir string) (map[string]string, error) {
+	checksums := map[string]string{}
+
+	if contents, err := embeddedAsset(ChecksumsFile); err == nil {
+		if err := parseChecksums(contents, checksums); err != nil {
+			return nil, fmt.Errorf("Error parsing embedded %s: %s", ChecksumsFile, err.Error())
+		}
+	}
+
+	if assetsDir == "" {
+		return checksums, nil
+	}
+
+	checksumsPath := filepath.Join(assetsDir, ChecksumsFile)
+	contents, err := ioutil.ReadFile(checksumsPath)
+	if os.IsNotExist(err) {
+		return checksums, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	assetsChecksums := map[string]string{}
+	if err := parseChecksums(contents, assetsChecksums); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %s", checksumsPath, err.Error())
+	}
+
+	for name, checksum := range assetsChecksums {
+		if _, ok := checksums[name]; !ok {
+			checksums[name] = checksum
+		}
+	}
+
+	return checksums, nil
+}
+
+// parseChecksums reads lines of the form "<sha256>  <name>", as written by
+// sha256sum (a "*" before the name marks binary mode)
+func parseChecksums(contents []byte, checksums map[string]string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid line '%s'", line)
+		}
+
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+
+	return scanner.Err()
+}
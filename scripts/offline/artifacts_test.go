@@ -0,0 +1,52 @@
+package offline
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadPrefersEmbeddedChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	packagesSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("packages")))
+	swappedSHA256 := fmt.Sprintf("%x", sha256.Sum256([]byte("swapped packages")))
+
+	// Only the packages have their checksum in the embedded SHA256SUMS; they
+	// have no pinned one
+	defer func(asset func(string) ([]byte, error)) { embeddedAsset = asset }(embeddedAsset)
+	embeddedAsset = func(name string) ([]byte, error) {
+		if name == ChecksumsFile {
+			return []byte(fmt.Sprintf("%s  ubuntu-packages.tgz\n", packagesSHA256)), nil
+		}
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+
+	assetsDir, err := ioutil.TempDir("", "fissile-offline-assets")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(assetsDir)
+
+	// The assets directory lists the checksum of the artifact it swaps in
+	checksums := fmt.Sprintf("%s  ubuntu-packages.tgz\n", swappedSHA256)
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, ChecksumsFile), []byte(checksums), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, "ubuntu-packages.tgz"), []byte("swapped packages"), 0644))
+
+	_, err = Load(assetsDir, "ubuntu")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), fmt.Sprintf("ubuntu-packages.tgz has checksum %s, expected %s", swappedSHA256, packagesSHA256),
+			"The embedded checksum should take precedence")
+	}
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(assetsDir, "ubuntu-packages.tgz"), []byte("packages"), 0644))
+	_, err = Load(assetsDir, "ubuntu")
+	if assert.Error(err, "dumb-init is still missing") {
+		assert.NotContains(err.Error(), "ubuntu-packages.tgz")
+	}
+}
@@ -0,0 +1,137 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/hpcloud/fissile/model"
+)
+
+const (
+	// CertificateKeyBits is the size of the keys of generated certificates
+	CertificateKeyBits = 2048
+	// CAValidity is how long generated CA certificates are valid
+	CAValidity = 10 * 365 * 24 * time.Hour
+	// CertificateValidity is how long generated certificates are valid
+	CertificateValidity = 2 * 365 * 24 * time.Hour
+)
+
+// certificateAuthority signs the generated certificates
+type certificateAuthority struct {
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+// generateCA creates a self-signed CA certificate
+func generateCA(commonName string) (*certificateAuthority, map[string]string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, CertificateKeyBits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newCertificateTemplate(commonName, CAValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &certificateAuthority{certificate: certificate, key: key}, encodeCertificate(der, key), nil
+}
+
+// parseCA loads a CA from its PEM encoded certificate and private key
+func parseCA(certificatePEM, keyPEM string) (*certificateAuthority, error) {
+	certificateBlock, _ := pem.Decode([]byte(certificatePEM))
+	if certificateBlock == nil {
+		return nil, fmt.Errorf("no PEM encoded certificate found")
+	}
+	certificate, err := x509.ParseCertificate(certificateBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificateAuthority{certificate: certificate, key: key}, nil
+}
+
+// generateCertificate creates a certificate signed by the CA, valid for both
+// servers and clients. The first subject name is also used as the common name.
+func (ca *certificateAuthority) generateCertificate(id string, subjectNames []string) (map[string]string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, CertificateKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	commonName := id
+	if len(subjectNames) > 0 {
+		commonName = subjectNames[0]
+	}
+
+	template, err := newCertificateTemplate(commonName, CertificateValidity)
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, name := range subjectNames {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeCertificate(der, key), nil
+}
+
+func newCertificateTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour) // Allow for some clock skew
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(validity),
+	}, nil
+}
+
+func encodeCertificate(der []byte, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		model.ValueTypeCertificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		model.ValueTypePrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+}
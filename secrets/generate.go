@@ -0,0 +1,243 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+)
+
+const (
+	// PasswordLength is the number of characters of generated passwords
+	PasswordLength = 32
+
+	passwordCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Values are the values of configuration variables, keyed by variable name
+type Values map[string]string
+
+// generatorGroup is a set of variables sharing the same generated secret
+type generatorGroup struct {
+	id        string
+	kind      string
+	generator *model.ConfigurationVariableGenerator // The generator of the first variable
+	variables []*model.ConfigurationVariable
+}
+
+// Generate produces values for all configuration variables that have a
+// generator. Secrets are kept from the existing values if all variables of
+// their generator have one, unless rotate is set; a new CA certificate causes
+// all certificates it signs to be regenerated. The subject alternative names
+// of certificates come from the service names of their role, as given by
+// serviceNames, followed by their explicit subject names.
+func Generate(variables model.ConfigurationVariableSlice, serviceNames map[string][]string, existing Values, rotate bool) (Values, error) {
+	groups, err := groupVariables(variables)
+	if err != nil {
+		return nil, err
+	}
+
+	var caIDs []string
+	for _, group := range groups {
+		if group.kind == model.GeneratorTypeCACertificate {
+			caIDs = append(caIDs, group.id)
+		}
+	}
+
+	values := Values{}
+	cas := map[string]*certificateAuthority{}
+	rotatedCAs := map[string]bool{}
+
+	for _, group := range groups {
+		var caID string
+		if group.kind == model.GeneratorTypeCertificate {
+			if caID, err = group.signingCA(caIDs); err != nil {
+				return nil, err
+			}
+		}
+
+		if !rotate && !rotatedCAs[caID] && group.hasValues(existing) {
+			for _, variable := range group.variables {
+				values[variable.Name] = existing[variable.Name]
+			}
+			if group.kind == model.GeneratorTypeCACertificate {
+				if cas[group.id], err = group.loadCA(existing); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		var secret map[string]string
+		switch group.kind {
+		case model.GeneratorTypePassword:
+			secret, err = generatePassword()
+		case model.GeneratorTypeSSH:
+			secret, err = generateSSHKey()
+		case model.GeneratorTypeCACertificate:
+			if !group.hasValueType(model.ValueTypeCertificate) || !group.hasValueType(model.ValueTypePrivateKey) {
+				return nil, fmt.Errorf("CA certificate %s needs variables for both its certificate and its private key", group.id)
+			}
+			var ca *certificateAuthority
+			ca, secret, err = generateCA(group.id)
+			cas[group.id] = ca
+			rotatedCAs[group.id] = true
+		case model.GeneratorTypeCertificate:
+			subjectNames := append(append([]string{}, serviceNames[group.generator.RoleName]...), group.generator.SubjectNames...)
+			secret, err = cas[caID].generateCertificate(group.id, subjectNames)
+		default:
+			return nil, fmt.Errorf("Generator %s has an invalid type %s", group.id, group.kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error generating %s: %s", group.id, err.Error())
+		}
+
+		for _, variable := range group.variables {
+			value, ok := secret[variable.Generator.ValueType]
+			if !ok {
+				return nil, fmt.Errorf("Generator %s of variable %s has an invalid value type %s", group.id, variable.Name, variable.Generator.ValueType)
+			}
+			values[variable.Name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// signingCA returns the id of the CA certificate signing a certificate: the
+// one named by its generator, or else the only one there is
+func (g *generatorGroup) signingCA(caIDs []string) (string, error) {
+	if len(caIDs) == 0 {
+		return "", fmt.Errorf("Certificate %s can't be generated without a CA certificate", g.id)
+	}
+	if g.generator.CA == "" {
+		if len(caIDs) > 1 {
+			return "", fmt.Errorf("Certificate %s needs a ca, as there is more than one CA certificate: %s", g.id, strings.Join(caIDs, ", "))
+		}
+		return caIDs[0], nil
+	}
+	for _, id := range caIDs {
+		if id == g.generator.CA {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("Certificate %s is signed by %s, which is not a CA certificate", g.id, g.generator.CA)
+}
+
+// groupVariables collects the variables with generators by generator ID. CA
+// certificates come first, as certificates need them for signing.
+func groupVariables(variables model.ConfigurationVariableSlice) ([]*generatorGroup, error) {
+	var groups []*generatorGroup
+	groupsByID := map[string]*generatorGroup{}
+
+	for _, variable := range variables {
+		generator := variable.Generator
+		if generator == nil {
+			continue
+		}
+		if generator.ID == "" {
+			return nil, fmt.Errorf("Generator of variable %s has no id", variable.Name)
+		}
+
+		group, ok := groupsByID[generator.ID]
+		if !ok {
+			group = &generatorGroup{id: generator.ID, kind: generator.Type, generator: generator}
+			groupsByID[generator.ID] = group
+			groups = append(groups, group)
+		} else if group.kind != generator.Type {
+			return nil, fmt.Errorf("Generator %s of variable %s is a %s, but is a %s elsewhere", generator.ID, variable.Name, generator.Type, group.kind)
+		}
+		group.variables = append(group.variables, variable)
+	}
+
+	ordered := make([]*generatorGroup, 0, len(groups))
+	for _, group := range groups {
+		if group.kind == model.GeneratorTypeCACertificate {
+			ordered = append(ordered, group)
+		}
+	}
+	for _, group := range groups {
+		if group.kind != model.GeneratorTypeCACertificate {
+			ordered = append(ordered, group)
+		}
+	}
+
+	return ordered, nil
+}
+
+func (g *generatorGroup) hasValues(existing Values) bool {
+	for _, variable := range g.variables {
+		if _, ok := existing[variable.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *generatorGroup) hasValueType(valueType string) bool {
+	for _, variable := range g.variables {
+		if variable.Generator.ValueType == valueType {
+			return true
+		}
+	}
+	return false
+}
+
+// valueOf returns the existing value of the first variable with the value type
+func (g *generatorGroup) valueOf(existing Values, valueType string) string {
+	for _, variable := range g.variables {
+		if variable.Generator.ValueType == valueType {
+			return existing[variable.Name]
+		}
+	}
+	return ""
+}
+
+func (g *generatorGroup) loadCA(existing Values) (*certificateAuthority, error) {
+	ca, err := parseCA(g.valueOf(existing, model.ValueTypeCertificate), g.valueOf(existing, model.ValueTypePrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("Error loading existing CA certificate %s: %s", g.id, err.Error())
+	}
+	return ca, nil
+}
+
+func generatePassword() (map[string]string, error) {
+	max := big.NewInt(int64(len(passwordCharacters)))
+	password := make([]byte, PasswordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		password[i] = passwordCharacters[n.Int64()]
+	}
+
+	return map[string]string{model.ValueTypePassword: string(password)}, nil
+}
+
+// WriteEnvFile writes the values in the env file format read by
+// --defaults-file, sorted by name. Newlines are escaped, so that PEM encoded
+// keys and certificates fit on one line.
+func (v Values) WriteEnvFile(writer io.Writer) error {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := v[name]
+		if strings.Contains(value, "\n") {
+			value = fmt.Sprintf(`"%s"`, strings.Replace(strings.TrimRight(value, "\n"), "\n", `\n`, -1))
+		}
+		if _, err := fmt.Fprintf(writer, "%s=%s\n", name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hpcloud/fissile/model"
+
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+)
+
+func generatorVariable(name, id, generatorType, valueType string) *model.ConfigurationVariable {
+	return &model.ConfigurationVariable{
+		Name: name,
+		Generator: &model.ConfigurationVariableGenerator{
+			ID:        id,
+			Type:      generatorType,
+			ValueType: valueType,
+		},
+	}
+}
+
+func parseCertificate(assert *assert.Assertions, certificatePEM string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(certificatePEM))
+	if !assert.NotNil(block, "No PEM block found") {
+		return nil
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if !assert.NoError(err) {
+		return nil
+	}
+	return certificate
+}
+
+func TestGeneratePasswordAndSSH(t *testing.T) {
+	assert := assert.New(t)
+
+	variables := model.ConfigurationVariableSlice{
+		generatorVariable("PASSWORD", "password", model.GeneratorTypePassword, model.ValueTypePassword),
+		generatorVariable("SAME_PASSWORD", "password", model.GeneratorTypePassword, model.ValueTypePassword),
+		generatorVariable("SSH_KEY", "ssh", model.GeneratorTypeSSH, model.ValueTypePrivateKey),
+		generatorVariable("SSH_KEY_PUBLIC", "ssh", model.GeneratorTypeSSH, model.ValueTypePublicKey),
+		generatorVariable("SSH_KEY_FINGERPRINT", "ssh", model.GeneratorTypeSSH, model.ValueTypeFingerprint),
+		&model.ConfigurationVariable{Name: "PLAIN"},
+	}
+
+	values, err := Generate(variables, nil, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Len(values, 5, "Variables without a generator should be skipped")
+	assert.Len(values["PASSWORD"], PasswordLength)
+	assert.Equal(values["PASSWORD"], values["SAME_PASSWORD"], "Variables with the same id should share the password")
+
+	block, _ := pem.Decode([]byte(values["SSH_KEY"]))
+	if assert.NotNil(block) {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if assert.NoError(err) {
+			publicKey := marshalSSHPublicKey(&key.PublicKey)
+			assert.Equal("ssh-rsa "+base64.StdEncoding.EncodeToString(publicKey), values["SSH_KEY_PUBLIC"])
+			assert.Equal(sshFingerprint(publicKey), values["SSH_KEY_FINGERPRINT"])
+		}
+	}
+	assert.Regexp("^([0-9a-f]{2}:){15}[0-9a-f]{2}$", values["SSH_KEY_FINGERPRINT"])
+
+	other, err := Generate(variables, nil, nil, false)
+	if assert.NoError(err) {
+		assert.NotEqual(values["PASSWORD"], other["PASSWORD"])
+	}
+}
+
+func TestGenerateCertificates(t *testing.T) {
+	assert := assert.New(t)
+
+	cert := generatorVariable("TLS_CERT", "tls", model.GeneratorTypeCertificate, model.ValueTypeCertificate)
+	cert.Generator.RoleName = "myrole"
+	cert.Generator.SubjectNames = []string{"myrole.example.com", "10.0.0.1"}
+	variables := model.ConfigurationVariableSlice{
+		cert,
+		generatorVariable("TLS_KEY", "tls", model.GeneratorTypeCertificate, model.ValueTypePrivateKey),
+		generatorVariable("CA_CERT", "ca", model.GeneratorTypeCACertificate, model.ValueTypeCertificate),
+		generatorVariable("CA_KEY", "ca", model.GeneratorTypeCACertificate, model.ValueTypePrivateKey),
+	}
+	serviceNames := map[string][]string{"myrole": {"myrole", "myrole-pod", "*.myrole-pod"}}
+
+	values, err := Generate(variables, serviceNames, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	caCertificate := parseCertificate(assert, values["CA_CERT"])
+	certificate := parseCertificate(assert, values["TLS_CERT"])
+	if caCertificate == nil || certificate == nil {
+		return
+	}
+
+	assert.True(caCertificate.IsCA)
+	assert.Equal("myrole", certificate.Subject.CommonName)
+	assert.Equal([]string{"myrole", "myrole-pod", "*.myrole-pod", "myrole.example.com"}, certificate.DNSNames)
+	if assert.Len(certificate.IPAddresses, 1) {
+		assert.Equal("10.0.0.1", certificate.IPAddresses[0].String())
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCertificate)
+	_, err = certificate.Verify(x509.VerifyOptions{
+		DNSName:   "myrole-0.myrole-pod",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(err, "The certificate should be signed by the CA")
+}
+
+func TestGenerateCertificatesWithSeveralCAs(t *testing.T) {
+	assert := assert.New(t)
+
+	cert := generatorVariable("TLS_CERT", "tls", model.GeneratorTypeCertificate, model.ValueTypeCertificate)
+	cert.Generator.CA = "internal-ca"
+	variables := model.ConfigurationVariableSlice{
+		generatorVariable("CA_CERT", "ca", model.GeneratorTypeCACertificate, model.ValueTypeCertificate),
+		generatorVariable("CA_KEY", "ca", model.GeneratorTypeCACertificate, model.ValueTypePrivateKey),
+		generatorVariable("INTERNAL_CA_CERT", "internal-ca", model.GeneratorTypeCACertificate, model.ValueTypeCertificate),
+		generatorVariable("INTERNAL_CA_KEY", "internal-ca", model.GeneratorTypeCACertificate, model.ValueTypePrivateKey),
+		cert,
+	}
+
+	values, err := Generate(variables, nil, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	certificate := parseCertificate(assert, values["TLS_CERT"])
+	caCertificate := parseCertificate(assert, values["CA_CERT"])
+	internalCACertificate := parseCertificate(assert, values["INTERNAL_CA_CERT"])
+	if certificate == nil || caCertificate == nil || internalCACertificate == nil {
+		return
+	}
+	assert.NoError(certificate.CheckSignatureFrom(internalCACertificate), "The certificate should be signed by its CA")
+	assert.Error(certificate.CheckSignatureFrom(caCertificate))
+
+	// Rotating another CA keeps the certificate
+	existing := Values{}
+	for name, value := range values {
+		existing[name] = value
+	}
+	delete(existing, "CA_KEY")
+	kept, err := Generate(variables, nil, existing, false)
+	if assert.NoError(err) {
+		assert.NotEqual(values["CA_CERT"], kept["CA_CERT"])
+		assert.Equal(values["TLS_CERT"], kept["TLS_CERT"])
+	}
+
+	// Without a ca, the CA to sign with is ambiguous
+	cert.Generator.CA = ""
+	_, err = Generate(variables, nil, nil, false)
+	assert.EqualError(err, "Certificate tls needs a ca, as there is more than one CA certificate: ca, internal-ca")
+
+	cert.Generator.CA = "tls"
+	_, err = Generate(variables, nil, nil, false)
+	assert.EqualError(err, "Certificate tls is signed by tls, which is not a CA certificate")
+}
+
+func TestGenerateKeepsExistingValues(t *testing.T) {
+	assert := assert.New(t)
+
+	variables := model.ConfigurationVariableSlice{
+		generatorVariable("PASSWORD", "password", model.GeneratorTypePassword, model.ValueTypePassword),
+		generatorVariable("OTHER_PASSWORD", "other", model.GeneratorTypePassword, model.ValueTypePassword),
+		generatorVariable("CA_CERT", "ca", model.GeneratorTypeCACertificate, model.ValueTypeCertificate),
+		generatorVariable("CA_KEY", "ca", model.GeneratorTypeCACertificate, model.ValueTypePrivateKey),
+		generatorVariable("TLS_CERT", "tls", model.GeneratorTypeCertificate, model.ValueTypeCertificate),
+	}
+
+	values, err := Generate(variables, nil, nil, false)
+	if !assert.NoError(err) {
+		return
+	}
+
+	existing := Values{}
+	for name, value := range values {
+		existing[name] = value
+	}
+	existing["PASSWORD"] = "kept"
+	delete(existing, "OTHER_PASSWORD")
+
+	kept, err := Generate(variables, nil, existing, false)
+	if assert.NoError(err) {
+		assert.Equal("kept", kept["PASSWORD"])
+		assert.Len(kept["OTHER_PASSWORD"], PasswordLength, "Missing values should be generated")
+		assert.Equal(values["CA_CERT"], kept["CA_CERT"])
+		assert.Equal(values["TLS_CERT"], kept["TLS_CERT"])
+	}
+
+	// Certificates must be regenerated with their CA
+	delete(existing, "CA_KEY")
+	regenerated, err := Generate(variables, nil, existing, false)
+	if assert.NoError(err) {
+		assert.Equal("kept", regenerated["PASSWORD"])
+		assert.NotEqual(values["CA_CERT"], regenerated["CA_CERT"])
+		assert.NotEqual(values["TLS_CERT"], regenerated["TLS_CERT"])
+	}
+
+	rotated, err := Generate(variables, nil, existing, true)
+	if assert.NoError(err) {
+		assert.NotEqual("kept", rotated["PASSWORD"])
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Generate(model.ConfigurationVariableSlice{
+		generatorVariable("TLS_CERT", "tls", model.GeneratorTypeCertificate, model.ValueTypeCertificate),
+	}, nil, nil, false)
+	assert.EqualError(err, "Certificate tls can't be generated without a CA certificate")
+
+	_, err = Generate(model.ConfigurationVariableSlice{
+		generatorVariable("CA_CERT", "ca", model.GeneratorTypeCACertificate, model.ValueTypeCertificate),
+	}, nil, nil, false)
+	assert.EqualError(err, "CA certificate ca needs variables for both its certificate and its private key")
+
+	_, err = Generate(model.ConfigurationVariableSlice{
+		generatorVariable("PASSWORD", "password", model.GeneratorTypePassword, model.ValueTypePassword),
+		generatorVariable("SSH_KEY", "password", model.GeneratorTypeSSH, model.ValueTypePrivateKey),
+	}, nil, nil, false)
+	assert.EqualError(err, "Generator password of variable SSH_KEY is a SSH, but is a Password elsewhere")
+
+	_, err = Generate(model.ConfigurationVariableSlice{
+		generatorVariable("PASSWORD", "password", model.GeneratorTypePassword, model.ValueTypeCertificate),
+	}, nil, nil, false)
+	assert.EqualError(err, "Generator password of variable PASSWORD has an invalid value type certificate")
+
+	_, err = Generate(model.ConfigurationVariableSlice{
+		generatorVariable("TOKEN", "token", "Token", "token"),
+	}, nil, nil, false)
+	assert.EqualError(err, "Generator token has an invalid type Token")
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	assert := assert.New(t)
+
+	values := Values{
+		"PASSWORD": "hunter2",
+		"CERT":     "-----BEGIN CERTIFICATE-----\nabc=\n-----END CERTIFICATE-----\n",
+	}
+
+	buffer := &bytes.Buffer{}
+	if !assert.NoError(values.WriteEnvFile(buffer)) {
+		return
+	}
+	assert.Equal(`CERT="-----BEGIN CERTIFICATE-----\nabc=\n-----END CERTIFICATE-----"
+PASSWORD=hunter2
+`, buffer.String())
+
+	tempDir, err := ioutil.TempDir("", "fissile-secrets")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	envFilePath := filepath.Join(tempDir, "secrets.env")
+	assert.NoError(ioutil.WriteFile(envFilePath, buffer.Bytes(), 0600))
+
+	actual, err := godotenv.Read(envFilePath)
+	if assert.NoError(err) {
+		assert.Equal("hunter2", actual["PASSWORD"])
+		assert.Equal(strings.TrimSuffix(values["CERT"], "\n"), actual["CERT"])
+	}
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hpcloud/fissile/model"
+)
+
+// SSHKeyBits is the size of generated SSH keys
+const SSHKeyBits = 2048
+
+// generateSSHKey creates a RSA key pair, with the public key in the format of
+// authorized_keys files and its MD5 fingerprint (as shown by ssh-keygen -l -E md5)
+func generateSSHKey() (map[string]string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, SSHKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	publicKey := marshalSSHPublicKey(&key.PublicKey)
+
+	return map[string]string{
+		model.ValueTypePrivateKey:  string(privateKey),
+		model.ValueTypePublicKey:   fmt.Sprintf("ssh-rsa %s", base64.StdEncoding.EncodeToString(publicKey)),
+		model.ValueTypeFingerprint: sshFingerprint(publicKey),
+	}, nil
+}
+
+// marshalSSHPublicKey encodes a RSA public key in the SSH wire format (RFC 4253,
+// section 6.6): the key type, the exponent and the modulus
+func marshalSSHPublicKey(key *rsa.PublicKey) []byte {
+	buffer := &bytes.Buffer{}
+	writeSSHString(buffer, []byte("ssh-rsa"))
+	writeSSHString(buffer, sshMPInt(big.NewInt(int64(key.E))))
+	writeSSHString(buffer, sshMPInt(key.N))
+	return buffer.Bytes()
+}
+
+// writeSSHString writes a length prefixed string (RFC 4251, section 5)
+func writeSSHString(buffer *bytes.Buffer, data []byte) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(data)))
+	buffer.Write(data)
+}
+
+// sshMPInt encodes a positive multiple precision integer (RFC 4251, section 5);
+// a leading zero byte keeps numbers with the high bit set positive
+func sshMPInt(n *big.Int) []byte {
+	data := n.Bytes()
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		data = append([]byte{0}, data...)
+	}
+	return data
+}
+
+// sshFingerprint is the MD5 hash of the wire format of a public key, as colon
+// separated hex digits
+func sshFingerprint(publicKey []byte) string {
+	sum := md5.Sum(publicKey)
+	digits := make([]string, len(sum))
+	for i, b := range sum {
+		digits[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(digits, ":")
+}